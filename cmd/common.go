@@ -11,12 +11,26 @@ import (
 	"github.com/kubeshark/kubeshark/config"
 	"github.com/kubeshark/kubeshark/errormessage"
 	"github.com/kubeshark/kubeshark/internal/connect"
+	"github.com/kubeshark/kubeshark/internal/upload"
 	"github.com/kubeshark/kubeshark/kubernetes"
 	"github.com/kubeshark/kubeshark/misc"
 	"github.com/kubeshark/kubeshark/misc/fsUtils"
 	"github.com/rs/zerolog/log"
 )
 
+func init() {
+	config.K8sSecretGetter = func(namespace string, name string, key string) (string, error) {
+		kubernetesProvider, err := getKubernetesProviderForCli(true, true)
+		if err != nil {
+			return "", err
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+		return kubernetesProvider.GetSecretValue(ctx, namespace, name, key)
+	}
+}
+
 func startProxyReportErrorIfAny(kubernetesProvider *kubernetes.Provider, ctx context.Context, serviceName string, podName string, proxyPortLabel string, srcPort uint16, dstPort uint16, healthCheck string) {
 	httpServer, err := kubernetes.StartProxy(kubernetesProvider, config.Config.Tap.Proxy.Host, srcPort, config.Config.Tap.Release.Namespace, serviceName)
 	if err != nil {
@@ -115,3 +129,14 @@ func dumpLogsIfNeeded(ctx context.Context, kubernetesProvider *kubernetes.Provid
 		log.Error().Err(err).Msg("Failed to dump logs.")
 	}
 }
+
+// uploadToCloudStorage uploads the files to the bucket and prefix the hub
+// keeps its snapshots in.
+func uploadToCloudStorage(ctx context.Context, files []string) error {
+	resolvedConfig, err := config.Config.WithResolvedSecrets()
+	if err != nil {
+		return err
+	}
+
+	return upload.Files(ctx, resolvedConfig.Tap.Snapshots.Cloud, files)
+}
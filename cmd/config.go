@@ -6,6 +6,7 @@ import (
 	"github.com/creasty/defaults"
 	"github.com/kubeshark/kubeshark/config"
 	"github.com/kubeshark/kubeshark/config/configStructs"
+	"github.com/kubeshark/kubeshark/kubernetes"
 	"github.com/kubeshark/kubeshark/misc"
 	"github.com/kubeshark/kubeshark/utils"
 	"github.com/rs/zerolog/log"
@@ -29,6 +30,14 @@ var configCmd = &cobra.Command{
 
 			log.Info().Str("config-path", config.ConfigFilePath).Msg("Template file written to config path.")
 		} else {
+			if config.Config.Config.Effective {
+				// Resolving the kube context applies its overrides.
+				if _, err := kubernetes.NewProvider(config.Config.KubeConfigPath(), config.Config.Kube.Context); err != nil {
+					log.Error().Err(err).Msg("Failed resolving the kube context.")
+					return nil
+				}
+			}
+
 			template, err := utils.PrettyYaml(config.Config)
 			if err != nil {
 				log.Error().Err(err).Msg("Failed converting config with defaults to YAML.")
@@ -52,4 +61,5 @@ func init() {
 	}
 
 	configCmd.Flags().BoolP(configStructs.RegenerateConfigName, "r", defaultConfig.Config.Regenerate, fmt.Sprintf("Regenerate the config file with default values to path %s", config.GetConfigFilePath(nil)))
+	configCmd.Flags().Bool(configStructs.EffectiveConfigName, defaultConfig.Config.Effective, "Print the config with the overrides of the current kube context applied")
 }
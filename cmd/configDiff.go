@@ -0,0 +1,214 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sort"
+
+	"github.com/creasty/defaults"
+	"github.com/kubeshark/kubeshark/config"
+	"github.com/kubeshark/kubeshark/config/configStructs"
+	"github.com/kubeshark/kubeshark/kubernetes"
+	"github.com/kubeshark/kubeshark/kubernetes/helm"
+	"github.com/kubeshark/kubeshark/utils"
+	"github.com/rs/zerolog/log"
+	"github.com/spf13/cobra"
+)
+
+const (
+	configDifferenceChanged      = "changed"
+	configDifferenceLocalOnly    = "local-only"
+	configDifferenceDeployedOnly = "deployed-only"
+)
+
+type configDifference struct {
+	Path     string      `json:"path"`
+	Kind     string      `json:"kind"`
+	Local    interface{} `json:"local"`
+	Deployed interface{} `json:"deployed"`
+}
+
+var configDiffCmd = &cobra.Command{
+	Use:   "diff",
+	Short: "Show the differences between the local config and the deployed release",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		runConfigDiff()
+		return nil
+	},
+}
+
+func init() {
+	configCmd.AddCommand(configDiffCmd)
+
+	defaultTapConfig := configStructs.TapConfig{}
+	if err := defaults.Set(&defaultTapConfig); err != nil {
+		log.Debug().Err(err).Send()
+	}
+
+	configDiffCmd.Flags().StringP(configStructs.ReleaseNamespaceLabel, "s", defaultTapConfig.Release.Namespace, "Release namespace of Kubeshark")
+}
+
+func runConfigDiff() {
+	kubernetesProvider, err := getKubernetesProviderForCli(true, true)
+	if err != nil {
+		return
+	}
+
+	deployedValues, err := helm.NewHelm(
+		config.Config.Tap.Release.Repo,
+		config.Config.Tap.Release.Name,
+		config.Config.Tap.Release.Namespace,
+	).GetValues()
+	if err != nil {
+		log.Error().
+			Err(err).
+			Str("release", config.Config.Tap.Release.Name).
+			Str("namespace", config.Config.Tap.Release.Namespace).
+			Msg("Failed getting the values of the deployed release.")
+		return
+	}
+
+	// The release holds resolved secrets, so compare against resolved ones.
+	resolvedConfig, err := config.Config.WithResolvedSecrets()
+	if err != nil {
+		log.Error().Err(err).Send()
+		return
+	}
+
+	localValues, err := utils.ToValues(resolvedConfig)
+	if err != nil {
+		log.Error().Err(err).Msg("Failed converting the local config.")
+		return
+	}
+
+	// Round-trip through JSON so numbers and empty collections compare alike.
+	deployedValues, err = utils.ToValues(deployedValues)
+	if err != nil {
+		log.Error().Err(err).Msg("Failed converting the deployed values.")
+		return
+	}
+
+	fmt.Printf("Helm release %s (namespace %s):\n", config.Config.Tap.Release.Name, config.Config.Tap.Release.Namespace)
+	printConfigDifferences(diffValues(localValues, deployedValues))
+
+	liveValues, err := kubernetes.GetConfigMap(kubernetesProvider)
+	if err != nil {
+		log.Error().Err(err).Msg("Failed getting the live config map.")
+		return
+	}
+
+	localLiveValues, err := liveConfigValues()
+	if err != nil {
+		log.Error().Err(err).Send()
+		return
+	}
+
+	var liveDifferences []configDifference
+	for _, key := range liveConfigKeys {
+		liveValue, ok := liveValues[key]
+		switch {
+		case !ok:
+			liveDifferences = append(liveDifferences, configDifference{Path: key, Kind: configDifferenceLocalOnly, Local: localLiveValues[key]})
+		case liveValue != localLiveValues[key]:
+			liveDifferences = append(liveDifferences, configDifference{Path: key, Kind: configDifferenceChanged, Local: localLiveValues[key], Deployed: liveValue})
+		}
+	}
+
+	fmt.Printf("\nConfig map %s%s:\n", kubernetes.SELF_RESOURCES_PREFIX, kubernetes.SUFFIX_CONFIG_MAP)
+	printConfigDifferences(liveDifferences)
+}
+
+// flattenValues maps every leaf of values to its dotted path. Lists are
+// compared as a whole, empty collections are treated as unset.
+func flattenValues(prefix string, value interface{}, flat map[string]interface{}) {
+	switch typed := value.(type) {
+	case map[string]interface{}:
+		if len(typed) == 0 {
+			flat[prefix] = nil
+			return
+		}
+		for key, nested := range typed {
+			path := key
+			if prefix != "" {
+				path = prefix + "." + key
+			}
+			flattenValues(path, nested, flat)
+		}
+	case []interface{}:
+		if len(typed) == 0 {
+			flat[prefix] = nil
+			return
+		}
+		flat[prefix] = typed
+	default:
+		flat[prefix] = typed
+	}
+}
+
+func diffValues(local map[string]interface{}, deployed map[string]interface{}) (differences []configDifference) {
+	localFlat := map[string]interface{}{}
+	deployedFlat := map[string]interface{}{}
+	flattenValues("", local, localFlat)
+	flattenValues("", deployed, deployedFlat)
+
+	paths := make([]string, 0, len(localFlat))
+	for path := range localFlat {
+		paths = append(paths, path)
+	}
+	for path := range deployedFlat {
+		if _, ok := localFlat[path]; !ok {
+			paths = append(paths, path)
+		}
+	}
+	sort.Strings(paths)
+
+	for _, path := range paths {
+		localValue, inLocal := localFlat[path]
+		deployedValue, inDeployed := deployedFlat[path]
+
+		switch {
+		case !inDeployed:
+			if localValue != nil {
+				differences = append(differences, configDifference{Path: path, Kind: configDifferenceLocalOnly, Local: localValue})
+			}
+		case !inLocal:
+			if deployedValue != nil {
+				differences = append(differences, configDifference{Path: path, Kind: configDifferenceDeployedOnly, Deployed: deployedValue})
+			}
+		case !reflect.DeepEqual(localValue, deployedValue):
+			differences = append(differences, configDifference{Path: path, Kind: configDifferenceChanged, Local: localValue, Deployed: deployedValue})
+		}
+	}
+
+	return
+}
+
+func printConfigDifferences(differences []configDifference) {
+	if len(differences) == 0 {
+		fmt.Println("  no differences")
+		return
+	}
+
+	secretPaths := config.SecretPaths()
+
+	for _, difference := range differences {
+		isSecret := utils.Contains(secretPaths, difference.Path)
+		format := func(value interface{}) string {
+			if text, ok := value.(string); ok && isSecret {
+				value = config.MaskSecret(text)
+			}
+			formatted, _ := json.Marshal(value)
+			return string(formatted)
+		}
+
+		switch difference.Kind {
+		case configDifferenceChanged:
+			fmt.Printf("  %s %s: %s -> %s\n", fmt.Sprintf(utils.Yellow, "~"), difference.Path, format(difference.Deployed), format(difference.Local))
+		case configDifferenceLocalOnly:
+			fmt.Printf("  %s %s: %s (local only)\n", fmt.Sprintf(utils.Green, "+"), difference.Path, format(difference.Local))
+		case configDifferenceDeployedOnly:
+			fmt.Printf("  %s %s: %s (deployed only)\n", fmt.Sprintf(utils.Red, "-"), difference.Path, format(difference.Deployed))
+		}
+	}
+}
@@ -0,0 +1,46 @@
+package cmd
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestDiffValues(t *testing.T) {
+	local := map[string]interface{}{
+		"tap": map[string]interface{}{
+			"docker":     map[string]interface{}{"tag": "v52.4", "registry": "docker.io/kubeshark"},
+			"namespaces": []interface{}{"default"},
+			"labels":     map[string]interface{}{},
+		},
+		"license": "",
+	}
+	deployed := map[string]interface{}{
+		"tap": map[string]interface{}{
+			"docker":     map[string]interface{}{"tag": "v52.3", "registry": "docker.io/kubeshark"},
+			"namespaces": []interface{}{},
+			"extra":      true,
+		},
+	}
+
+	expected := []configDifference{
+		{Path: "tap.docker.tag", Kind: configDifferenceChanged, Local: "v52.4", Deployed: "v52.3"},
+		{Path: "tap.extra", Kind: configDifferenceDeployedOnly, Deployed: true},
+		{Path: "tap.namespaces", Kind: configDifferenceChanged, Local: []interface{}{"default"}},
+		{Path: "license", Kind: configDifferenceLocalOnly, Local: ""},
+	}
+
+	actual := diffValues(local, deployed)
+	byPath := map[string]configDifference{}
+	for _, difference := range actual {
+		byPath[difference.Path] = difference
+	}
+
+	if len(actual) != len(expected) {
+		t.Fatalf("unexpected differences - expected: %v, actual: %v", expected, actual)
+	}
+	for _, difference := range expected {
+		if !reflect.DeepEqual(byPath[difference.Path], difference) {
+			t.Errorf("unexpected difference for %s - expected: %v, actual: %v", difference.Path, difference, byPath[difference.Path])
+		}
+	}
+}
@@ -0,0 +1,26 @@
+package cmd
+
+import (
+	"github.com/kubeshark/kubeshark/config"
+	"github.com/rs/zerolog/log"
+	"github.com/spf13/cobra"
+)
+
+var configEncryptCmd = &cobra.Command{
+	Use:   "encrypt",
+	Short: "Encrypt the secret values of the config file with the key set in the encryption section",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		count, err := config.EncryptConfigFile()
+		if err != nil {
+			log.Error().Err(err).Msg("Failed encrypting the config file.")
+			return nil
+		}
+
+		log.Info().Int("encrypted", count).Str("config-path", config.ConfigFilePath).Msg("Config file secrets encrypted.")
+		return nil
+	},
+}
+
+func init() {
+	configCmd.AddCommand(configEncryptCmd)
+}
@@ -0,0 +1,132 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/kubeshark/kubeshark/config"
+	"github.com/kubeshark/kubeshark/config/configStructs"
+	"github.com/kubeshark/kubeshark/utils"
+	"github.com/rs/zerolog/log"
+	"github.com/spf13/cobra"
+)
+
+const helmValuesStdout = "-"
+
+var configImportCmd = &cobra.Command{
+	Use:   "import",
+	Short: "Merge a Helm values file into the config file",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		runConfigImport()
+		return nil
+	},
+}
+
+var configExportCmd = &cobra.Command{
+	Use:   "export",
+	Short: "Convert the config into a Helm values file",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		runConfigExport()
+		return nil
+	},
+}
+
+func init() {
+	configCmd.AddCommand(configImportCmd)
+	configCmd.AddCommand(configExportCmd)
+
+	configImportCmd.Flags().String(configStructs.HelmValuesConfigName, "", "Path of the Helm values file to import")
+	if err := configImportCmd.MarkFlagRequired(configStructs.HelmValuesConfigName); err != nil {
+		log.Debug().Err(err).Send()
+	}
+
+	configExportCmd.Flags().String(configStructs.HelmValuesConfigName, "", "Path to write the Helm values file to, stdout if omitted")
+	configExportCmd.Flags().Lookup(configStructs.HelmValuesConfigName).NoOptDefVal = helmValuesStdout
+}
+
+func runConfigImport() {
+	valuesPath := config.Config.Config.Helm.Values
+	buf, err := os.ReadFile(valuesPath)
+	if err != nil {
+		log.Error().Err(err).Str("path", valuesPath).Msg("Failed reading the Helm values file.")
+		return
+	}
+
+	existing, err := os.ReadFile(config.ConfigFilePath)
+	if err != nil && !os.IsNotExist(err) {
+		log.Error().Err(err).Str("config-path", config.ConfigFilePath).Msg("Failed reading the config file.")
+		return
+	}
+
+	if os.IsNotExist(err) {
+		importedConfig, unknown, err := config.ConfigFromHelmValues(buf)
+		if err != nil {
+			log.Error().Err(err).Str("path", valuesPath).Msg("Failed converting the Helm values file.")
+			return
+		}
+		logUnsupportedHelmValues(unknown)
+
+		if err := config.WriteConfig(importedConfig); err != nil {
+			log.Error().Err(err).Send()
+			return
+		}
+	} else {
+		// Only the keys of the values file are set, the rest of the config
+		// file is kept as is.
+		merged, unknown, err := config.MergeHelmValues(existing, buf)
+		if err != nil {
+			log.Error().Err(err).Str("path", valuesPath).Msg("Failed converting the Helm values file.")
+			return
+		}
+		logUnsupportedHelmValues(unknown)
+
+		backupPath, err := config.WriteConfigData(merged)
+		if err != nil {
+			log.Error().Err(err).Send()
+			return
+		}
+		log.Info().Str("backup", backupPath).Msg("Previous config file was backed up.")
+	}
+
+	log.Info().Str("helm-values", valuesPath).Str("config-path", config.ConfigFilePath).Msg("Helm values imported into the config file.")
+}
+
+func logUnsupportedHelmValues(unknown []string) {
+	for _, key := range unknown {
+		log.Warn().Str("key", key).Msg("Helm value isn't supported by the CLI config, it's ignored.")
+	}
+}
+
+func runConfigExport() {
+	// Marshalled the same way the values are passed to the chart on install.
+	values, err := utils.ToValues(config.Config)
+	if err != nil {
+		log.Error().Err(err).Msg("Failed converting the config to Helm values.")
+		return
+	}
+
+	for _, path := range config.SecretPaths() {
+		if value, err := config.GetConfigValue(&config.Config, path); err == nil && config.IsSecretRef(fmt.Sprint(value)) {
+			log.Warn().Str("key", path).Msg("Secret reference is exported as is, the chart expects the resolved value.")
+		}
+	}
+
+	template, err := utils.PrettyYaml(values)
+	if err != nil {
+		log.Error().Err(err).Msg("Failed converting Helm values to YAML.")
+		return
+	}
+
+	valuesPath := config.Config.Config.Helm.Values
+	if valuesPath == "" || valuesPath == helmValuesStdout {
+		fmt.Print(template)
+		return
+	}
+
+	if err := os.WriteFile(valuesPath, []byte(template), 0600); err != nil {
+		log.Error().Err(err).Str("path", valuesPath).Msg("Failed writing the Helm values file.")
+		return
+	}
+
+	log.Info().Str("helm-values", valuesPath).Msg("Config exported as Helm values.")
+}
@@ -0,0 +1,80 @@
+package cmd
+
+import (
+	"fmt"
+	"reflect"
+
+	"github.com/kubeshark/kubeshark/config"
+	"github.com/kubeshark/kubeshark/utils"
+	"github.com/rs/zerolog/log"
+	"github.com/spf13/cobra"
+)
+
+var configGetCmd = &cobra.Command{
+	Use:   "get <key>",
+	Short: "Print the effective value of a config key (e.g. tap.docker.tag)",
+	Args:  cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		value, err := config.GetConfigValue(&config.Config, args[0])
+		if err != nil {
+			log.Error().Err(err).Send()
+			return nil
+		}
+
+		switch reflect.ValueOf(value).Kind() {
+		case reflect.Slice, reflect.Map:
+			template, err := utils.PrettyYaml(value)
+			if err != nil {
+				log.Error().Err(err).Send()
+				return nil
+			}
+			fmt.Print(template)
+		default:
+			fmt.Println(value)
+		}
+
+		return nil
+	},
+}
+
+var configSetCmd = &cobra.Command{
+	Use:   "set <key> <value> [<value>...]",
+	Short: "Set a config key in the config file (e.g. tap.resources.sniffer.limits.memory 4Gi)",
+	Args:  cobra.MinimumNArgs(2),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if err := config.SetConfigFileValue(args[0], args[1:]); err != nil {
+			log.Error().Err(err).Str("key", args[0]).Msg("Failed setting the config key.")
+			return nil
+		}
+
+		log.Info().Str("key", args[0]).Strs("value", args[1:]).Str("config-path", config.ConfigFilePath).Msg("Config key set.")
+		return nil
+	},
+}
+
+var configUnsetCmd = &cobra.Command{
+	Use:   "unset <key>",
+	Short: "Remove a config key from the config file, restoring its default",
+	Args:  cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		removed, err := config.UnsetConfigFileValue(args[0])
+		if err != nil {
+			log.Error().Err(err).Str("key", args[0]).Msg("Failed unsetting the config key.")
+			return nil
+		}
+
+		if !removed {
+			log.Info().Str("key", args[0]).Str("config-path", config.ConfigFilePath).Msg("Config key isn't set in the config file.")
+			return nil
+		}
+
+		log.Info().Str("key", args[0]).Str("config-path", config.ConfigFilePath).Msg("Config key unset.")
+		return nil
+	},
+}
+
+func init() {
+	configCmd.AddCommand(configGetCmd)
+	configCmd.AddCommand(configSetCmd)
+	configCmd.AddCommand(configUnsetCmd)
+}
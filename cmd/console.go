@@ -89,7 +89,7 @@ func runConsoleWithoutProxy() {
 		if saToken != "" {
 			headers.Set(utils.CLI_AUTH_HEADER, saToken)
 		} else {
-			headers.Set(utils.LICENSE_KEY_HEADER, config.Config.License)
+			headers.Set(utils.LICENSE_KEY_HEADER, config.Config.LicenseKey())
 		}
 
 		c, _, err := websocket.DefaultDialer.Dial(u.String(), headers)
@@ -0,0 +1,315 @@
+package cmd
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/kubeshark/kubeshark/config"
+	"github.com/kubeshark/kubeshark/misc"
+	"github.com/kubeshark/kubeshark/utils"
+	"github.com/rs/zerolog/log"
+)
+
+const (
+	// hubToolsPath is where the Hub serves its MCP tools, listing them on a
+	// GET and calling them on a POST to the call path
+	hubToolsPath    = "/mcp"
+	hubToolCallPath = "/mcp/tools/call"
+
+	hubSnapshotCompleted = "completed"
+	hubSnapshotFailed    = "failed"
+
+	hubPollInterval = 2 * time.Second
+	// hubProgressInterval is how often the progress of the Hub is reported
+	hubProgressInterval = 10 * time.Second
+	// hubStreamHeaderTimeout bounds the wait for the Hub to answer a transfer,
+	// which may take a while to process once the body is sent
+	hubStreamHeaderTimeout = 5 * time.Minute
+	// transferProgressInterval is how often transfers report their progress
+	transferProgressInterval = 2 * time.Second
+)
+
+// hubSnapshot is a snapshot on the Hub.
+type hubSnapshot struct {
+	ID        string    `json:"id"`
+	Name      string    `json:"name"`
+	Status    string    `json:"status"`
+	Size      int64     `json:"size"`
+	Nodes     []string  `json:"nodes,omitempty"`
+	Start     time.Time `json:"start"`
+	End       time.Time `json:"end"`
+	CreatedAt time.Time `json:"createdAt"`
+	Error     string    `json:"error,omitempty"`
+}
+
+// hubDissection is the progress of the dissection of a snapshot.
+type hubDissection struct {
+	Status   string  `json:"status"`
+	Progress float64 `json:"progress"`
+	Error    string  `json:"error,omitempty"`
+}
+
+// hubAPIError is an error status the Hub API answered with.
+type hubAPIError struct {
+	statusCode int
+	message    string
+	header     http.Header
+}
+
+func (err *hubAPIError) Error() string {
+	return fmt.Sprintf("Hub API error (%d): %s", err.statusCode, err.message)
+}
+
+// hubClient calls the Hub API through the proxy to the front service,
+// authenticating with the minted ServiceAccount token or the License-Key.
+type hubClient struct {
+	frontURL string
+	apiURL   string
+	client   *http.Client
+	// streamClient transfers files, which can take longer than the
+	// timeout of client
+	streamClient *http.Client
+	// tools are the MCP tools the Hub provides, listed on the first call
+	tools map[string]hubMCPTool
+}
+
+func newHubClient() (*hubClient, error) {
+	mcpURL, err := establishProxyConnection(30 * time.Second)
+	if err != nil {
+		return nil, fmt.Errorf("failed connecting to Kubeshark: %w", err)
+	}
+
+	tokenSource := hubTokenSource(false)
+	apiURL := strings.TrimSuffix(mcpURL, "/mcp")
+	return &hubClient{
+		frontURL: strings.TrimSuffix(apiURL, "/api"),
+		apiURL:   apiURL,
+		client:   utils.NewHubHTTPClientWithTokenSource(30*time.Second, tokenSource, config.Config.LicenseKey()),
+		streamClient: &http.Client{
+			CheckRedirect: utils.StopOnSSORedirect,
+			Transport: utils.HubAuthTransportWithTokenSource(tokenSource, config.Config.LicenseKey(), &http.Transport{
+				TLSHandshakeTimeout:   10 * time.Second,
+				ResponseHeaderTimeout: hubStreamHeaderTimeout,
+			}),
+		},
+	}, nil
+}
+
+// snapshotLink is where the UI shows the snapshot.
+func (hub *hubClient) snapshotLink(id string) string {
+	return fmt.Sprintf("%s/?snapshot=%s", hub.frontURL, url.QueryEscape(id))
+}
+
+// do sends the request, failing on an error status. The caller closes the
+// body of the response.
+func (hub *hubClient) do(client *http.Client, request *http.Request) (*http.Response, error) {
+	utils.AddIgnoreCaptureHeader(request)
+	response, err := client.Do(request)
+	if err != nil {
+		return nil, err
+	}
+
+	if utils.IsAuthRequired(response) {
+		response.Body.Close()
+		return nil, utils.ErrHubAuthRequired
+	}
+	if response.StatusCode >= 400 {
+		body, _ := io.ReadAll(io.LimitReader(response.Body, 4096))
+		response.Body.Close()
+		return nil, &hubAPIError{statusCode: response.StatusCode, message: strings.TrimSpace(string(body)), header: response.Header}
+	}
+
+	return response, nil
+}
+
+// call sends the value as JSON if not nil, and decodes the response into
+// the result if not nil.
+func (hub *hubClient) call(ctx context.Context, method string, path string, value interface{}, result interface{}) error {
+	var body io.Reader
+	if value != nil {
+		encoded, err := json.Marshal(value)
+		if err != nil {
+			return err
+		}
+		body = bytes.NewReader(encoded)
+	}
+
+	request, err := http.NewRequestWithContext(ctx, method, hub.apiURL+path, body)
+	if err != nil {
+		return err
+	}
+	if value != nil {
+		request.Header.Set("Content-Type", "application/json")
+	}
+
+	response, err := hub.do(hub.client, request)
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+
+	if result == nil {
+		return nil
+	}
+	if err := json.NewDecoder(response.Body).Decode(result); err != nil {
+		return fmt.Errorf("unexpected Hub API response: %w", err)
+	}
+	return nil
+}
+
+// callTool calls an MCP tool of the Hub, the way the MCP server does, and
+// decodes its result into the result if not nil. The Hub must list the tool,
+// taking the arguments, so a Hub that doesn't fails clearly.
+func (hub *hubClient) callTool(ctx context.Context, name string, args map[string]any, result interface{}) error {
+	if hub.tools == nil {
+		var hubMCP hubMCPResponse
+		if err := hub.call(ctx, http.MethodGet, hubToolsPath, nil, &hubMCP); err != nil {
+			return fmt.Errorf("failed listing the Hub tools: %w", err)
+		}
+		hub.tools = map[string]hubMCPTool{}
+		for _, tool := range hubMCP.Tools {
+			hub.tools[tool.Name] = tool
+		}
+	}
+
+	tool, ok := hub.tools[name]
+	if !ok {
+		return fmt.Errorf("the Hub doesn't provide the %s tool, upgrade %s", name, misc.Software)
+	}
+	if err := checkHubToolArguments(tool, args); err != nil {
+		return err
+	}
+
+	var body json.RawMessage
+	if err := hub.call(ctx, http.MethodPost, hubToolCallPath, map[string]any{"name": name, "arguments": args}, &body); err != nil {
+		return fmt.Errorf("%s failed: %w", name, err)
+	}
+	return decodeHubToolResult(name, body, result)
+}
+
+// checkHubToolArguments fails on the arguments the input schema of the tool
+// doesn't list.
+func checkHubToolArguments(tool hubMCPTool, args map[string]any) error {
+	var schema struct {
+		Properties map[string]json.RawMessage `json:"properties"`
+	}
+	if len(tool.InputSchema) == 0 || json.Unmarshal(tool.InputSchema, &schema) != nil || schema.Properties == nil {
+		return nil
+	}
+
+	for arg := range args {
+		if _, ok := schema.Properties[arg]; !ok {
+			return fmt.Errorf("the %s tool of the Hub doesn't take %s, upgrade %s", tool.Name, arg, misc.Software)
+		}
+	}
+	return nil
+}
+
+// decodeHubToolResult decodes the result of a tool, either the JSON the Hub
+// answered with or the JSON text of an MCP tool result.
+func decodeHubToolResult(name string, body json.RawMessage, result interface{}) error {
+	var toolResult struct {
+		Content []mcpContent `json:"content"`
+		IsError bool         `json:"isError"`
+	}
+	if json.Unmarshal(body, &toolResult) == nil && len(toolResult.Content) > 0 {
+		var texts []string
+		for _, content := range toolResult.Content {
+			texts = append(texts, content.Text)
+		}
+		if toolResult.IsError {
+			return fmt.Errorf("%s failed: %s", name, strings.Join(texts, "\n"))
+		}
+		body = json.RawMessage(texts[0])
+	}
+
+	if result == nil {
+		return nil
+	}
+	if text, ok := result.(*string); ok && json.Unmarshal(body, text) != nil {
+		// A text result
+		*text = string(body)
+		return nil
+	}
+	if err := json.Unmarshal(body, result); err != nil {
+		return fmt.Errorf("unexpected result of %s: %w", name, err)
+	}
+	return nil
+}
+
+// awaitDissection starts the dissection of the snapshot, and waits for it
+// to complete.
+func (hub *hubClient) awaitDissection(ctx context.Context, id string) error {
+	args := map[string]any{"snapshot_id": id}
+	if err := hub.callTool(ctx, "start_snapshot_dissection", args, nil); err != nil {
+		return fmt.Errorf("failed starting the dissection: %w", err)
+	}
+
+	ticker := time.NewTicker(hubPollInterval)
+	defer ticker.Stop()
+	lastReport := time.Now()
+	for {
+		var dissection hubDissection
+		if err := hub.callTool(ctx, "get_snapshot_dissection_status", args, &dissection); err != nil {
+			return err
+		}
+
+		switch dissection.Status {
+		case hubSnapshotCompleted:
+			return nil
+		case hubSnapshotFailed:
+			return fmt.Errorf("the dissection failed: %s", dissection.Error)
+		}
+		if time.Since(lastReport) >= hubProgressInterval {
+			log.Info().Str("snapshot", id).Str("progress", fmt.Sprintf("%.0f%%", dissection.Progress)).Msg("Dissecting...")
+			lastReport = time.Now()
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
+
+// transferProgress counts the bytes written through it, logging the
+// progress of the transfer every transferProgressInterval.
+type transferProgress struct {
+	action     string
+	file       string
+	total      int64
+	done       int64
+	lastReport time.Time
+}
+
+func newTransferProgress(action string, file string, done int64, total int64) *transferProgress {
+	return &transferProgress{action: action, file: file, done: done, total: total, lastReport: time.Now()}
+}
+
+func (progress *transferProgress) Write(p []byte) (int, error) {
+	progress.done += int64(len(p))
+	if time.Since(progress.lastReport) >= transferProgressInterval {
+		progress.report()
+		progress.lastReport = time.Now()
+	}
+	return len(p), nil
+}
+
+func (progress *transferProgress) String() string {
+	if progress.total <= 0 {
+		return formatByteSize(progress.done)
+	}
+	return fmt.Sprintf("%s / %s (%d%%)", formatByteSize(progress.done), formatByteSize(progress.total), progress.done*100/progress.total)
+}
+
+func (progress *transferProgress) report() {
+	log.Info().Str("file", progress.file).Str("progress", progress.String()).Msg(progress.action)
+}
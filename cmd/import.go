@@ -0,0 +1,172 @@
+package cmd
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/creasty/defaults"
+	"github.com/kubeshark/gopacket/pcapgo"
+	"github.com/kubeshark/kubeshark/config"
+	"github.com/kubeshark/kubeshark/config/configStructs"
+	"github.com/kubeshark/kubeshark/utils"
+	"github.com/rs/zerolog/log"
+	"github.com/spf13/cobra"
+)
+
+const (
+	pcapContentType   = "application/vnd.tcpdump.pcap"
+	pcapngContentType = "application/x-pcapng"
+
+	// hubImportPath is where captures are streamed to the Hub
+	hubImportPath = "/snapshots/import"
+)
+
+// importExtensions are trimmed off the file name to name the snapshot
+var importExtensions = []string{".gz", ".zst", ".pcapng", ".pcap", ".cap"}
+
+var importCmd = &cobra.Command{
+	Use:   "import <file>",
+	Short: "Import a PCAP file into the Hub as a snapshot, and dissect it",
+	Long: `Import a PCAP file into the Hub as a snapshot, and dissect it.
+
+Captures from outside the cluster, such as from load balancers or laptops,
+can be analyzed in the UI alongside the live traffic. The file can be a pcap
+or pcapng capture, compressed with gzip or zstd or not. With --cloud, the file
+is uploaded to the cloud storage of tap.snapshots.cloud as well.`,
+	Example: "  kubeshark import lb.pcapng.gz --as-snapshot lb-incident",
+	Args:    cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		path := args[0]
+		contentType, err := checkImportFile(path)
+		if err != nil {
+			return err
+		}
+
+		name := config.Config.Import.As.Snapshot
+		if name == "" {
+			name = importSnapshotName(path)
+		}
+
+		hub, err := newHubClient()
+		if err != nil {
+			return err
+		}
+
+		ctx := cmd.Context()
+		snapshot, err := importPcapFile(ctx, hub, path, name, contentType)
+		if err != nil {
+			return err
+		}
+		log.Info().Str("snapshot", snapshot.ID).Str("name", snapshot.Name).Msg("Imported, dissecting...")
+
+		if config.Config.Import.Cloud {
+			if err := uploadToCloudStorage(ctx, []string{path}); err != nil {
+				return fmt.Errorf("failed uploading %s to the cloud storage: %w", path, err)
+			}
+		}
+
+		if err := hub.awaitDissection(ctx, snapshot.ID); err != nil {
+			return err
+		}
+
+		log.Info().Str("url", hub.snapshotLink(snapshot.ID)).Msg(fmt.Sprintf(utils.Green, "The snapshot is dissected, it's available at:"))
+		return nil
+	},
+}
+
+// checkImportFile reads the first packet of the file to tell it's a capture
+// before uploading it, and returns its content type.
+func checkImportFile(path string) (string, error) {
+	reader, closer, err := openPcapFile(path)
+	if err != nil {
+		return "", err
+	}
+	defer closer.Close()
+
+	if _, _, err := reader.ReadPacketData(); errors.Is(err, io.EOF) {
+		return "", fmt.Errorf("%s has no packets", path)
+	} else if err != nil {
+		return "", fmt.Errorf("%s isn't a valid capture: %w", path, err)
+	}
+
+	if _, ok := reader.(*pcapgo.NgReader); ok {
+		return pcapngContentType, nil
+	}
+	return pcapContentType, nil
+}
+
+// importSnapshotName names the snapshot after the file.
+func importSnapshotName(path string) string {
+	name := filepath.Base(path)
+	for _, extension := range importExtensions {
+		name = strings.TrimSuffix(name, extension)
+	}
+	return name
+}
+
+// importPcapFile streams the file to the Hub, decompressed, reporting the
+// progress in bytes of the file read.
+func importPcapFile(ctx context.Context, hub *hubClient, path string, name string, contentType string) (*hubSnapshot, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	fileInfo, err := file.Stat()
+	if err != nil {
+		return nil, err
+	}
+
+	progress := newTransferProgress("Uploading...", path, 0, fileInfo.Size())
+	body, release, err := decompressPcapStream(bufio.NewReader(io.TeeReader(file, progress)), path)
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+
+	query := url.Values{"name": {name}, "filename": {filepath.Base(path)}}
+	request, err := http.NewRequestWithContext(ctx, http.MethodPost, hub.apiURL+hubImportPath+"?"+query.Encode(), body)
+	if err != nil {
+		return nil, err
+	}
+	request.Header.Set("Content-Type", contentType)
+
+	response, err := hub.do(hub.streamClient, request)
+	if err != nil {
+		return nil, fmt.Errorf("failed importing %s: %w", path, err)
+	}
+	defer response.Body.Close()
+	progress.report()
+
+	var snapshot hubSnapshot
+	if err := json.NewDecoder(response.Body).Decode(&snapshot); err != nil {
+		return nil, fmt.Errorf("unexpected Hub API response: %w", err)
+	}
+	if snapshot.Status == hubSnapshotFailed {
+		return nil, fmt.Errorf("the Hub failed importing %s: %s", path, snapshot.Error)
+	}
+
+	return &snapshot, nil
+}
+
+func init() {
+	rootCmd.AddCommand(importCmd)
+
+	defaultImportConfig := configStructs.ImportConfig{}
+	if err := defaults.Set(&defaultImportConfig); err != nil {
+		log.Debug().Err(err).Send()
+	}
+
+	importCmd.Flags().String(configStructs.AsSnapshotImportName, defaultImportConfig.As.Snapshot, "Name of the snapshot, the file name if not set")
+	importCmd.Flags().Bool(configStructs.CloudImportName, defaultImportConfig.Cloud, "Upload the file to the cloud storage of tap.snapshots.cloud as well")
+}
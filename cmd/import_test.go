@@ -0,0 +1,125 @@
+package cmd
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/kubeshark/gopacket"
+	"github.com/kubeshark/gopacket/layers"
+	"github.com/kubeshark/gopacket/pcapgo"
+)
+
+func TestImportPcapFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "lb.pcap.gz")
+	file, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	gzipWriter := gzip.NewWriter(file)
+	writer := pcapgo.NewWriter(gzipWriter)
+	if err := writer.WriteFileHeader(maxSnaplen, layers.LinkTypeEthernet); err != nil {
+		t.Fatal(err)
+	}
+	data := newTestTCPPacket(t, net.ParseIP("10.0.2.9"), net.ParseIP("10.0.1.5"), []byte("GET / HTTP/1.1\r\n\r\n"))
+	if err := writer.WritePacket(gopacket.CaptureInfo{Timestamp: time.Now(), CaptureLength: len(data), Length: len(data)}, data); err != nil {
+		t.Fatal(err)
+	}
+	if err := gzipWriter.Close(); err != nil {
+		t.Fatal(err)
+	}
+	file.Close()
+
+	contentType, err := checkImportFile(path)
+	if err != nil || contentType != pcapContentType {
+		t.Fatalf("unexpected content type - %s, %v", contentType, err)
+	}
+	if name := importSnapshotName(path); name != "lb" {
+		t.Errorf("unexpected snapshot name - %s", name)
+	}
+
+	var uploaded []byte
+	var uploadedType string
+	var calls []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.Method == http.MethodPost && r.URL.Path == "/api"+hubImportPath:
+			if r.URL.Query().Get("name") != "lb" {
+				http.Error(w, "unexpected name", http.StatusBadRequest)
+				return
+			}
+			uploaded, _ = io.ReadAll(r.Body)
+			uploadedType = r.Header.Get("Content-Type")
+			_ = json.NewEncoder(w).Encode(hubSnapshot{ID: "snap-1", Name: "lb", Status: "imported"})
+		case r.Method == http.MethodGet && r.URL.Path == "/api/mcp":
+			var tools []hubMCPTool
+			for _, name := range []string{"start_snapshot_dissection", "get_snapshot_dissection_status"} {
+				tools = append(tools, hubMCPTool{Name: name, InputSchema: json.RawMessage(`{"type":"object","properties":{"snapshot_id":{"type":"string"}}}`)})
+			}
+			_ = json.NewEncoder(w).Encode(hubMCPResponse{Tools: tools})
+		case r.Method == http.MethodPost && r.URL.Path == "/api/mcp/tools/call":
+			var call struct {
+				Name      string         `json:"name"`
+				Arguments map[string]any `json:"arguments"`
+			}
+			_ = json.NewDecoder(r.Body).Decode(&call)
+			calls = append(calls, fmt.Sprintf("%s(%v)", call.Name, call.Arguments["snapshot_id"]))
+			switch call.Name {
+			case "get_snapshot_dissection_status":
+				// Answered as an MCP tool result
+				status, _ := json.Marshal(hubDissection{Status: hubSnapshotCompleted, Progress: 100})
+				_ = json.NewEncoder(w).Encode(map[string]any{"content": []mcpContent{{Type: "text", Text: string(status)}}})
+			default:
+				_, _ = w.Write([]byte("{}"))
+			}
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+
+	hub := &hubClient{frontURL: server.URL, apiURL: server.URL + "/api", client: server.Client(), streamClient: server.Client()}
+	snapshot, err := importPcapFile(t.Context(), hub, path, "lb", contentType)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if snapshot.ID != "snap-1" {
+		t.Errorf("unexpected snapshot - %+v", snapshot)
+	}
+	if !bytes.HasPrefix(uploaded, []byte{0xd4, 0xc3, 0xb2, 0xa1}) || uploadedType != pcapContentType {
+		t.Errorf("expected the capture to be streamed decompressed - %d bytes of %s", len(uploaded), uploadedType)
+	}
+
+	if err := hub.awaitDissection(t.Context(), snapshot.ID); err != nil {
+		t.Errorf("unexpected dissection error - %v", err)
+	}
+	expected := []string{"start_snapshot_dissection(snap-1)", "get_snapshot_dissection_status(snap-1)"}
+	if !reflect.DeepEqual(calls, expected) {
+		t.Errorf("unexpected tool calls - expected: %v, actual: %v", expected, calls)
+	}
+}
+
+func TestHubToolArguments(t *testing.T) {
+	tool := hubMCPTool{Name: "list_snapshots", InputSchema: json.RawMessage(`{"type":"object","properties":{"source":{"type":"string"}}}`)}
+	if err := checkHubToolArguments(tool, map[string]any{"source": "cloud"}); err != nil {
+		t.Errorf("unexpected error - %v", err)
+	}
+	if err := checkHubToolArguments(tool, map[string]any{"kfl": "http"}); err == nil {
+		t.Error("expected an error for an argument the tool doesn't take")
+	}
+
+	var dissection hubDissection
+	if err := decodeHubToolResult("get_snapshot_dissection_status", json.RawMessage(`{"content":[{"type":"text","text":"no such snapshot"}],"isError":true}`), &dissection); err == nil {
+		t.Error("expected the error of the tool result")
+	}
+}
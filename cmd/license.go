@@ -11,7 +11,7 @@ var licenseCmd = &cobra.Command{
 	Use:   "license",
 	Short: "Print the license loaded string",
 	RunE: func(cmd *cobra.Command, args []string) error {
-		fmt.Println(config.Config.License)
+		fmt.Println(config.Config.LicenseKey())
 		return nil
 	},
 }
@@ -32,6 +32,13 @@ var logsCmd = &cobra.Command{
 
 		if dumpLogsErr := fsUtils.DumpLogs(ctx, kubernetesProvider, config.Config.Logs.FilePath(), config.Config.Logs.Grep); dumpLogsErr != nil {
 			log.Error().Err(dumpLogsErr).Msg("Failed to dump logs.")
+			return nil
+		}
+
+		if config.Config.Logs.Upload {
+			if err := uploadToCloudStorage(ctx, []string{config.Config.Logs.FilePath()}); err != nil {
+				return fmt.Errorf("failed to upload the logs: %w", err)
+			}
 		}
 
 		return nil
@@ -48,4 +55,5 @@ func init() {
 
 	logsCmd.Flags().StringP(configStructs.FileLogsName, "f", defaultLogsConfig.FileStr, fmt.Sprintf("Path for zip file (default current <pwd>\\%s_logs.zip)", misc.Program))
 	logsCmd.Flags().StringP(configStructs.GrepLogsName, "g", defaultLogsConfig.Grep, "Regexp to do grepping on the logs")
+	logsCmd.Flags().Bool(configStructs.UploadLogsName, defaultLogsConfig.Upload, "Upload the zip file to the cloud storage of tap.snapshots.cloud")
 }
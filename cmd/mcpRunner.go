@@ -198,7 +198,7 @@ func runMCPWithConfig(setFlags []string, directURL string, allowDestructive bool
 	tokenSource := hubTokenSource(urlMode)
 
 	server := &mcpServer{
-		httpClient:       utils.NewHubHTTPClientWithTokenSource(30*time.Second, tokenSource, config.Config.License),
+		httpClient:       utils.NewHubHTTPClientWithTokenSource(30*time.Second, tokenSource, config.Config.LicenseKey()),
 		tokenSource:      tokenSource,
 		stdin:            os.Stdin,
 		stdout:           os.Stdout,
@@ -227,7 +227,7 @@ func (s *mcpServer) validateDirectURL() error {
 	s.directURL = urlStr
 
 	// Use a short timeout for validation
-	client := utils.NewHubHTTPClientWithTokenSource(10*time.Second, s.tokenSource, config.Config.License)
+	client := utils.NewHubHTTPClientWithTokenSource(10*time.Second, s.tokenSource, config.Config.LicenseKey())
 
 	// Try to reach the MCP API base endpoint which returns tool definitions
 	testURL := fmt.Sprintf("%s/api/mcp", urlStr)
@@ -878,7 +878,7 @@ func (s *mcpServer) callDownloadFile(args map[string]any) (string, bool) {
 	// This client sets only connection-level timeouts and lets the body stream without a deadline.
 	downloadClient := &http.Client{
 		CheckRedirect: utils.StopOnSSORedirect,
-		Transport: utils.HubAuthTransportWithTokenSource(s.tokenSource, config.Config.License, &http.Transport{
+		Transport: utils.HubAuthTransportWithTokenSource(s.tokenSource, config.Config.LicenseKey(), &http.Transport{
 			TLSHandshakeTimeout:   10 * time.Second,
 			ResponseHeaderTimeout: 30 * time.Second,
 		}),
@@ -1212,7 +1212,7 @@ func establishProxyConnection(timeout time.Duration) (string, error) {
 
 // fetchAndDisplayTools fetches tools from the Kubeshark API and displays them
 func fetchAndDisplayTools(hubURL string, timeout time.Duration, tokenSource func() string) {
-	client := utils.NewHubHTTPClientWithTokenSource(timeout, tokenSource, config.Config.License)
+	client := utils.NewHubHTTPClientWithTokenSource(timeout, tokenSource, config.Config.LicenseKey())
 
 	// Fetch tools list from /api/mcp endpoint
 	resp, err := client.Get(strings.TrimSuffix(hubURL, "/mcp") + "/mcp")
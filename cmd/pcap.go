@@ -0,0 +1,14 @@
+package cmd
+
+import (
+	"github.com/spf13/cobra"
+)
+
+var pcapCmd = &cobra.Command{
+	Use:   "pcap",
+	Short: "Inspect PCAP files locally, such as the ones pcapdump writes",
+}
+
+func init() {
+	rootCmd.AddCommand(pcapCmd)
+}
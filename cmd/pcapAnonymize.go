@@ -0,0 +1,294 @@
+package cmd
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/json"
+	"net"
+	"os"
+
+	"github.com/kubeshark/gopacket"
+	"github.com/kubeshark/gopacket/layers"
+)
+
+// redactedHTTPHeaders are the HTTP headers --redact-http blanks out
+var redactedHTTPHeaders = [][]byte{
+	[]byte("authorization:"),
+	[]byte("proxy-authorization:"),
+	[]byte("cookie:"),
+	[]byte("set-cookie:"),
+}
+
+// pcapAnonymizer rewrites packets so captures can leave the organization.
+// IP addresses are remapped prefix-preserving (addresses sharing a prefix
+// keep sharing a prefix of the same length), MAC addresses are scrubbed, and
+// payloads can be truncated and stripped of credentials. The remapping is
+// keyed by a random key, so it's consistent within a capture and can only be
+// reversed with the mapping it records.
+type pcapAnonymizer struct {
+	key          []byte
+	payloadBytes int
+	redactHTTP   bool
+
+	// remapped caches the anonymized IPs by the original ones
+	remapped map[string][]byte
+	// ips and macs map the anonymized addresses to the original ones
+	ips  map[string]string
+	macs map[string]string
+	// interfaces maps the generic pcapng interface names to the original ones
+	interfaces map[string]string
+}
+
+func newPcapAnonymizer(payloadBytes int, redactHTTP bool) (*pcapAnonymizer, error) {
+	key := make([]byte, 32)
+	if _, err := rand.Read(key); err != nil {
+		return nil, err
+	}
+
+	return &pcapAnonymizer{
+		key:          key,
+		payloadBytes: payloadBytes,
+		redactHTTP:   redactHTTP,
+		remapped:     map[string][]byte{},
+		ips:          map[string]string{},
+		macs:         map[string]string{},
+		interfaces:   map[string]string{},
+	}, nil
+}
+
+// anonymizeIP remaps the address in place. Every bit is flipped depending on
+// the bits preceding it, which keeps the prefixes.
+func (anonymizer *pcapAnonymizer) anonymizeIP(ip []byte) {
+	if len(ip) != net.IPv4len && len(ip) != net.IPv6len {
+		return
+	}
+	if net.IP(ip).IsUnspecified() || net.IP(ip).Equal(net.IPv4bcast) {
+		return
+	}
+
+	original := net.IP(bytes.Clone(ip)).String()
+	if anonymized, ok := anonymizer.remapped[original]; ok {
+		copy(ip, anonymized)
+		return
+	}
+
+	source := bytes.Clone(ip)
+	prefix := make([]byte, len(ip)+2)
+	mac := hmac.New(sha256.New, anonymizer.key)
+	for bit := 0; bit < len(ip)*8; bit++ {
+		binary.BigEndian.PutUint16(prefix, uint16(bit))
+		mac.Reset()
+		mac.Write(prefix)
+		if mac.Sum(nil)[0]&1 == 1 {
+			ip[bit/8] ^= 0x80 >> (bit % 8)
+		}
+		// The next bit depends on the original bits so far
+		prefix[2+bit/8] |= source[bit/8] & (0x80 >> (bit % 8))
+	}
+
+	anonymizer.remapped[original] = bytes.Clone(ip)
+	anonymizer.ips[net.IP(ip).String()] = original
+}
+
+// anonymizeMAC scrubs the address in place to a locally administered one,
+// keeping broadcast and the multicast bit.
+func (anonymizer *pcapAnonymizer) anonymizeMAC(mac []byte) {
+	if len(mac) != 6 || bytes.Equal(mac, layers.EthernetBroadcast) || bytes.Equal(mac, make([]byte, 6)) {
+		return
+	}
+
+	original := net.HardwareAddr(bytes.Clone(mac)).String()
+	multicast := mac[0] & 0x01
+	hash := hmac.New(sha256.New, anonymizer.key)
+	hash.Write([]byte("mac"))
+	hash.Write(mac)
+
+	copy(mac, hash.Sum(nil)[:6])
+	mac[0] = mac[0]&0xfc | 0x02 | multicast
+
+	anonymizer.macs[net.HardwareAddr(mac).String()] = original
+}
+
+// redactHTTPHeaders blanks out the values of the credential headers in place,
+// keeping the payload length so the TCP sequence numbers stay valid.
+func redactHTTPHeaders(payload []byte) {
+	lower := bytes.ToLower(payload)
+	for _, header := range redactedHTTPHeaders {
+		for start := 0; start < len(lower); {
+			index := bytes.Index(lower[start:], header)
+			if index < 0 {
+				break
+			}
+			index += start
+			start = index + len(header)
+
+			if index > 0 && lower[index-1] != '\n' {
+				continue
+			}
+
+			end := bytes.IndexByte(payload[start:], '\r')
+			if end < 0 {
+				end = bytes.IndexByte(payload[start:], '\n')
+			}
+			if end < 0 {
+				end = len(payload) - start
+			}
+			value := bytes.TrimLeft(payload[start:start+end], " \t")
+			for i := range value {
+				value[i] = '*'
+			}
+		}
+	}
+}
+
+// offsetIn returns where the sub slice starts in data.
+func offsetIn(data []byte, sub []byte) int {
+	return cap(data) - cap(sub)
+}
+
+// apply returns the anonymized copy of the packet.
+func (anonymizer *pcapAnonymizer) apply(linkType layers.LinkType, ci gopacket.CaptureInfo, data []byte) (gopacket.CaptureInfo, []byte) {
+	data = bytes.Clone(data)
+	packet := gopacket.NewPacket(data, linkType, gopacket.DecodeOptions{NoCopy: true}, gopacket.UnknownCgroupID, 0)
+
+	var pseudoHeader func(protocol layers.IPProtocol, length int) []byte
+	var ipv4Headers [][]byte
+	for _, layer := range packet.Layers() {
+		switch l := layer.(type) {
+		case *layers.Ethernet:
+			anonymizer.anonymizeMAC(l.Contents[0:6])
+			anonymizer.anonymizeMAC(l.Contents[6:12])
+		case *layers.LinuxSLL:
+			if l.AddrLen == 6 {
+				anonymizer.anonymizeMAC(l.Contents[6:12])
+			}
+		case *layers.ARP:
+			if l.HwAddressSize == 6 {
+				anonymizer.anonymizeMAC(l.SourceHwAddress)
+				anonymizer.anonymizeMAC(l.DstHwAddress)
+			}
+			anonymizer.anonymizeIP(l.SourceProtAddress)
+			anonymizer.anonymizeIP(l.DstProtAddress)
+		case *layers.IPv4:
+			if len(l.Contents) < 20 {
+				break
+			}
+			anonymizer.anonymizeIP(l.Contents[12:16])
+			anonymizer.anonymizeIP(l.Contents[16:20])
+			ipv4Headers = append(ipv4Headers, l.Contents)
+			addresses := l.Contents[12:20]
+			pseudoHeader = func(protocol layers.IPProtocol, length int) []byte {
+				return append(bytes.Clone(addresses), 0, byte(protocol), byte(length>>8), byte(length))
+			}
+		case *layers.IPv6:
+			if len(l.Contents) < 40 {
+				break
+			}
+			anonymizer.anonymizeIP(l.Contents[8:24])
+			anonymizer.anonymizeIP(l.Contents[24:40])
+			addresses := l.Contents[8:40]
+			pseudoHeader = func(protocol layers.IPProtocol, length int) []byte {
+				header := append(bytes.Clone(addresses), 0, 0, 0, 0, 0, 0, 0, byte(protocol))
+				binary.BigEndian.PutUint16(header[34:36], uint16(length))
+				return header
+			}
+		}
+	}
+
+	for _, header := range ipv4Headers {
+		setChecksum(header, 10, nil, header)
+	}
+
+	var transport []byte
+	var payload []byte
+	var checksumOffset int
+	var protocol layers.IPProtocol
+	if tcp, ok := packet.TransportLayer().(*layers.TCP); ok && len(tcp.Contents) >= 20 {
+		transport, payload, checksumOffset, protocol = tcp.Contents, tcp.Payload, 16, layers.IPProtocolTCP
+		if anonymizer.redactHTTP {
+			redactHTTPHeaders(tcp.Payload)
+		}
+	} else if udp, ok := packet.TransportLayer().(*layers.UDP); ok && len(udp.Contents) >= 8 {
+		transport, payload, checksumOffset, protocol = udp.Contents, udp.Payload, 6, layers.IPProtocolUDP
+		if udp.Checksum == 0 && packet.Layer(layers.LayerTypeIPv4) != nil {
+			// No checksum over IPv4
+			pseudoHeader = nil
+		}
+	}
+
+	if transport != nil {
+		start := offsetIn(data, transport)
+		segment := data[start : start+len(transport)+len(payload)]
+		// Checksums can only be computed over whole segments
+		if pseudoHeader != nil && ci.CaptureLength >= ci.Length {
+			setChecksum(segment, checksumOffset, pseudoHeader(protocol, len(segment)), segment)
+		}
+
+		if anonymizer.payloadBytes > 0 && len(payload) > anonymizer.payloadBytes {
+			data = data[:offsetIn(data, payload)+anonymizer.payloadBytes]
+		}
+	}
+
+	ci.CaptureLength = len(data)
+	return ci, data
+}
+
+// setChecksum writes the internet checksum of the pseudo header and data at
+// the offset of the header.
+func setChecksum(header []byte, offset int, pseudoHeader []byte, data []byte) {
+	header[offset], header[offset+1] = 0, 0
+
+	var sum uint32
+	for _, chunk := range [][]byte{pseudoHeader, data} {
+		for i := 0; i+1 < len(chunk); i += 2 {
+			sum += uint32(chunk[i])<<8 | uint32(chunk[i+1])
+		}
+		if len(chunk)%2 == 1 {
+			sum += uint32(chunk[len(chunk)-1]) << 8
+		}
+	}
+	for sum > 0xffff {
+		sum = sum>>16 + sum&0xffff
+	}
+
+	checksum := ^uint16(sum)
+	if checksum == 0 && pseudoHeader != nil {
+		checksum = 0xffff
+	}
+	binary.BigEndian.PutUint16(header[offset:], checksum)
+}
+
+// pcapAnonymizationMapping lets the remapping be reversed
+type pcapAnonymizationMapping struct {
+	IPs        map[string]string `json:"ips"`
+	MACs       map[string]string `json:"macs"`
+	Interfaces map[string]string `json:"interfaces,omitempty"`
+	Hosts      map[string]string `json:"hosts,omitempty"`
+}
+
+// writeMapping writes the anonymized to original addresses, and the names
+// of the remapped hosts, to a file only the user can read.
+func (anonymizer *pcapAnonymizer) writeMapping(path string, hosts []hostEntry) error {
+	mapping := pcapAnonymizationMapping{
+		IPs:        anonymizer.ips,
+		MACs:       anonymizer.macs,
+		Interfaces: anonymizer.interfaces,
+		Hosts:      map[string]string{},
+	}
+
+	for _, host := range hosts {
+		if anonymized, ok := anonymizer.remapped[host.IP.String()]; ok {
+			mapping.Hosts[net.IP(anonymized).String()] = host.Name
+		}
+	}
+
+	data, err := json.MarshalIndent(mapping, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	return os.WriteFile(path, data, 0600)
+}
@@ -0,0 +1,136 @@
+package cmd
+
+import (
+	"bytes"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/kubeshark/gopacket"
+	"github.com/kubeshark/gopacket/layers"
+)
+
+func newTestTCPPacket(t *testing.T, src net.IP, dst net.IP, payload []byte) []byte {
+	return newTestTCPSegment(t, src, dst, &layers.TCP{SrcPort: 43210, DstPort: 80, Seq: 1, PSH: true, ACK: true, Window: 512}, payload)
+}
+
+func newTestTCPSegment(t *testing.T, src net.IP, dst net.IP, tcp *layers.TCP, payload []byte) []byte {
+	eth := &layers.Ethernet{
+		SrcMAC:       net.HardwareAddr{0x0a, 0x58, 0x0a, 0xf4, 0x00, 0x05},
+		DstMAC:       net.HardwareAddr{0x0a, 0x58, 0x0a, 0xf4, 0x00, 0x01},
+		EthernetType: layers.EthernetTypeIPv4,
+	}
+	ip := &layers.IPv4{Version: 4, TTL: 64, Protocol: layers.IPProtocolTCP, SrcIP: src, DstIP: dst}
+	if err := tcp.SetNetworkLayerForChecksum(ip); err != nil {
+		t.Fatal(err)
+	}
+
+	buf := gopacket.NewSerializeBuffer()
+	options := gopacket.SerializeOptions{FixLengths: true, ComputeChecksums: true}
+	if err := gopacket.SerializeLayers(buf, options, eth, ip, tcp, gopacket.Payload(payload)); err != nil {
+		t.Fatal(err)
+	}
+
+	return buf.Bytes()
+}
+
+func decodeTestTCPPacket(t *testing.T, data []byte) (*layers.Ethernet, *layers.IPv4, *layers.TCP) {
+	packet := gopacket.NewPacket(data, layers.LinkTypeEthernet, gopacket.Default, gopacket.UnknownCgroupID, 0)
+	eth, _ := packet.Layer(layers.LayerTypeEthernet).(*layers.Ethernet)
+	ip, _ := packet.Layer(layers.LayerTypeIPv4).(*layers.IPv4)
+	tcp, _ := packet.Layer(layers.LayerTypeTCP).(*layers.TCP)
+	if eth == nil || ip == nil || tcp == nil {
+		t.Fatalf("failed decoding the packet: %v", packet.ErrorLayer())
+	}
+
+	return eth, ip, tcp
+}
+
+func TestPcapAnonymizerKeepsPrefixes(t *testing.T) {
+	anonymizer, err := newPcapAnonymizer(0, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	first := net.ParseIP("10.244.1.5").To4()
+	second := net.ParseIP("10.244.1.77").To4()
+	other := net.ParseIP("192.168.0.1").To4()
+	anonymizer.anonymizeIP(first)
+	anonymizer.anonymizeIP(second)
+	anonymizer.anonymizeIP(other)
+
+	// 10.244.1.5 and 10.244.1.77 share 25 bits
+	if !bytes.Equal(first.Mask(net.CIDRMask(25, 32)), second.Mask(net.CIDRMask(25, 32))) {
+		t.Errorf("prefix not kept - %s, %s", first, second)
+	}
+	if first.Equal(net.ParseIP("10.244.1.5")) {
+		t.Errorf("address not remapped - %s", first)
+	}
+
+	again := net.ParseIP("10.244.1.5").To4()
+	anonymizer.anonymizeIP(again)
+	if !again.Equal(first) {
+		t.Errorf("inconsistent remapping - expected: %s, actual: %s", first, again)
+	}
+	if anonymizer.ips[first.String()] != "10.244.1.5" {
+		t.Errorf("unexpected mapping - %v", anonymizer.ips)
+	}
+}
+
+func TestPcapAnonymizerApply(t *testing.T) {
+	anonymizer, err := newPcapAnonymizer(0, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	payload := []byte("GET / HTTP/1.1\r\nHost: api\r\nAuthorization: Bearer secret\r\nSet-Cookie: session=secret\r\n\r\n")
+	data := newTestTCPPacket(t, net.ParseIP("10.244.1.5"), net.ParseIP("10.96.0.10"), payload)
+	ci := gopacket.CaptureInfo{Timestamp: time.Now(), CaptureLength: len(data), Length: len(data)}
+
+	anonymizedCi, anonymized := anonymizer.apply(layers.LinkTypeEthernet, ci, data)
+	if anonymizedCi.CaptureLength != len(data) || len(anonymized) != len(data) {
+		t.Fatalf("unexpected length - expected: %d, actual: %d", len(data), len(anonymized))
+	}
+
+	eth, ip, tcp := decodeTestTCPPacket(t, anonymized)
+	if eth.SrcMAC.String() == "0a:58:0a:f4:00:05" || eth.SrcMAC[0]&0x02 == 0 {
+		t.Errorf("MAC not scrubbed - %s", eth.SrcMAC)
+	}
+	if ip.SrcIP.Equal(net.ParseIP("10.244.1.5")) || ip.DstIP.Equal(net.ParseIP("10.96.0.10")) {
+		t.Errorf("IPs not remapped - %s > %s", ip.SrcIP, ip.DstIP)
+	}
+
+	expected := "GET / HTTP/1.1\r\nHost: api\r\nAuthorization: *************\r\nSet-Cookie: **************\r\n\r\n"
+	if string(tcp.Payload) != expected {
+		t.Errorf("unexpected payload - expected: %q, actual: %q", expected, tcp.Payload)
+	}
+
+	// The checksums must match the rewritten packet
+	reencoded := newTestTCPPacket(t, ip.SrcIP, ip.DstIP, tcp.Payload)
+	_, expectedIP, expectedTCP := decodeTestTCPPacket(t, reencoded)
+	if ip.Checksum != expectedIP.Checksum || tcp.Checksum != expectedTCP.Checksum {
+		t.Errorf("unexpected checksums - expected: %x/%x, actual: %x/%x", expectedIP.Checksum, expectedTCP.Checksum, ip.Checksum, tcp.Checksum)
+	}
+}
+
+func TestPcapAnonymizerTruncatesPayload(t *testing.T) {
+	anonymizer, err := newPcapAnonymizer(4, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	data := newTestTCPPacket(t, net.ParseIP("10.244.1.5"), net.ParseIP("10.96.0.10"), []byte("sensitive payload"))
+	ci := gopacket.CaptureInfo{Timestamp: time.Now(), CaptureLength: len(data), Length: len(data)}
+
+	anonymizedCi, anonymized := anonymizer.apply(layers.LinkTypeEthernet, ci, data)
+	// Ethernet, IPv4 and TCP headers, then the kept bytes
+	if expected := 14 + 20 + 20 + 4; len(anonymized) != expected || anonymizedCi.CaptureLength != expected {
+		t.Errorf("unexpected capture length - expected: %d, actual: %d", expected, len(anonymized))
+	}
+	if anonymizedCi.Length != ci.Length {
+		t.Errorf("unexpected length - expected: %d, actual: %d", ci.Length, anonymizedCi.Length)
+	}
+	if !bytes.HasSuffix(anonymized, []byte("sens")) {
+		t.Errorf("unexpected payload - %q", anonymized[54:])
+	}
+}
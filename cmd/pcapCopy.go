@@ -0,0 +1,284 @@
+package cmd
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/kubeshark/kubeshark/kubernetes"
+	"github.com/rs/zerolog/log"
+	"k8s.io/client-go/tools/remotecommand"
+)
+
+const (
+	pcapCopyAttempts   = 5
+	pcapCopyBackoff    = time.Second
+	pcapCopyMaxBackoff = 30 * time.Second
+
+	// pcapPartialSuffix marks a copy in progress, which a later run resumes
+	pcapPartialSuffix = ".part"
+)
+
+var errPcapChecksumMismatch = errors.New("checksum mismatch")
+
+// podFileStat is the size of a worker file and the SHA-256 of its first Size
+// bytes, computed in the sniffer container. Checksum is empty if the
+// container can't compute it.
+type podFileStat struct {
+	Size     int64
+	Checksum string
+}
+
+// pcapCopyFailure is a worker file, or a whole worker if File is empty, that
+// couldn't be fully copied.
+type pcapCopyFailure struct {
+	Pod  string
+	Node string
+	File string
+	Err  error
+}
+
+func podFilePath(pod *PodFileInfo, file string) string {
+	return filepath.Join("data", pod.Pod.Spec.NodeName, srcDir, file)
+}
+
+// execInSniffer runs the command in the sniffer container of the worker pod,
+// streaming its output to stdout.
+func execInSniffer(ctx context.Context, provider *kubernetes.Provider, pod *PodFileInfo, command []string, stdout io.Writer) error {
+	req := provider.GetClientSet().CoreV1().RESTClient().Post().
+		Resource("pods").
+		Name(pod.Pod.Name).
+		Namespace(pod.Pod.Namespace).
+		SubResource("exec").
+		Param("container", "sniffer").
+		Param("stdout", "true").
+		Param("stderr", "true")
+	for _, arg := range command {
+		req = req.Param("command", arg)
+	}
+
+	exec, err := remotecommand.NewSPDYExecutor(provider.GetRestConfig(), "POST", req.URL())
+	if err != nil {
+		return fmt.Errorf("failed to initialize executor for pod %s in namespace %s: %w", pod.Pod.Name, pod.Pod.Namespace, err)
+	}
+
+	var stderrBuf bytes.Buffer
+	err = exec.StreamWithContext(ctx, remotecommand.StreamOptions{
+		Stdout: stdout,
+		Stderr: &stderrBuf,
+	})
+	if err != nil {
+		if stderr := strings.TrimSpace(stderrBuf.String()); stderr != "" {
+			return fmt.Errorf("%w: %s", err, stderr)
+		}
+		return err
+	}
+
+	return nil
+}
+
+// statPodFile reads the size of the worker file, and the checksum of that
+// many bytes since the worker may still be appending to it.
+func statPodFile(ctx context.Context, provider *kubernetes.Provider, pod *PodFileInfo, srcFile string) (stat podFileStat, err error) {
+	path := podFilePath(pod, srcFile)
+
+	var sizeBuf bytes.Buffer
+	if err = execInSniffer(ctx, provider, pod, []string{"stat", "-c", "%s", path}, &sizeBuf); err != nil {
+		return stat, fmt.Errorf("failed to stat %s: %w", path, err)
+	}
+	if stat.Size, err = strconv.ParseInt(strings.TrimSpace(sizeBuf.String()), 10, 64); err != nil {
+		return stat, fmt.Errorf("unexpected size of %s: %w", path, err)
+	}
+
+	var checksumBuf bytes.Buffer
+	checksumCmd := []string{"sh", "-c", `head -c "$1" "$2" | sha256sum`, "sh", strconv.FormatInt(stat.Size, 10), path}
+	if err := execInSniffer(ctx, provider, pod, checksumCmd, &checksumBuf); err != nil {
+		log.Debug().Err(err).Str("file", path).Msg("Couldn't checksum the file on the worker, verifying its size only.")
+		return stat, nil
+	}
+	if fields := strings.Fields(checksumBuf.String()); len(fields) > 0 {
+		stat.Checksum = fields[0]
+	}
+
+	return stat, nil
+}
+
+// copyPodFileRange appends the bytes of the worker file the local file is
+// missing, up to the size in the stat.
+func copyPodFileRange(ctx context.Context, provider *kubernetes.Provider, pod *PodFileInfo, srcFile, destFile string, stat podFileStat) error {
+	offset := int64(0)
+	if info, err := os.Stat(destFile); err == nil {
+		offset = info.Size()
+	}
+	if offset > stat.Size {
+		if err := os.Truncate(destFile, 0); err != nil {
+			return err
+		}
+		offset = 0
+	}
+	if offset == stat.Size {
+		return nil
+	}
+
+	outFile, err := os.OpenFile(destFile, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return fmt.Errorf("failed to create destination file: %w", err)
+	}
+	defer outFile.Close()
+
+	// tail counts from 1, head stops at the stat size if the file grew since
+	copyCmd := []string{"sh", "-c", `tail -c +"$1" "$3" | head -c "$2"`, "sh",
+		strconv.FormatInt(offset+1, 10), strconv.FormatInt(stat.Size-offset, 10), podFilePath(pod, srcFile)}
+
+	return execInSniffer(ctx, provider, pod, copyCmd, outFile)
+}
+
+// verifyCopiedFile compares the local file with the stat of the worker file.
+func verifyCopiedFile(destFile string, stat podFileStat) error {
+	f, err := os.Open(destFile)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	hash := sha256.New()
+	size, err := io.Copy(hash, f)
+	if err != nil {
+		return err
+	}
+	if size != stat.Size {
+		return fmt.Errorf("copied %d of %d bytes", size, stat.Size)
+	}
+
+	if stat.Checksum != "" && hex.EncodeToString(hash.Sum(nil)) != stat.Checksum {
+		return errPcapChecksumMismatch
+	}
+
+	return nil
+}
+
+// copyFileFromPod copies the worker file into a partial file next to
+// destFile and verifies it against the size and checksum computed in the
+// sniffer container, then renames it to destFile. A dropped stream is retried
+// with backoff, resuming from the bytes already copied, and so does a later
+// run from the partial file left by a failed one.
+func copyFileFromPod(ctx context.Context, provider *kubernetes.Provider, pod *PodFileInfo, srcFile, destFile string) error {
+	partial := destFile + pcapPartialSuffix
+	var stat *podFileStat
+	backoff := pcapCopyBackoff
+
+	for attempt := 1; ; attempt++ {
+		err := func() error {
+			attemptCtx, cancel := context.WithTimeout(ctx, maxTimePerFile)
+			defer cancel()
+
+			if stat == nil {
+				fileStat, err := statPodFile(attemptCtx, provider, pod, srcFile)
+				if err != nil {
+					return err
+				}
+				stat = &fileStat
+
+				// A copy of an earlier run is verified again, and completed
+				// if the worker appended to the file since. It's left alone
+				// until then, in case the worker rotated the file away.
+				if _, err := os.Stat(partial); os.IsNotExist(err) {
+					if err := os.Rename(destFile, partial); err != nil && !os.IsNotExist(err) {
+						return err
+					}
+				}
+			}
+
+			if err := copyPodFileRange(attemptCtx, provider, pod, srcFile, partial, *stat); err != nil {
+				return err
+			}
+
+			err := verifyCopiedFile(partial, *stat)
+			if errors.Is(err, errPcapChecksumMismatch) {
+				// The copied bytes can't be trusted, start over
+				os.Remove(partial)
+			}
+			if err != nil {
+				return err
+			}
+			return os.Rename(partial, destFile)
+		}()
+		if err == nil {
+			return nil
+		}
+
+		if attempt == pcapCopyAttempts || ctx.Err() != nil {
+			return fmt.Errorf("giving up after %d attempts: %w", attempt, err)
+		}
+
+		log.Debug().Err(err).Int("attempt", attempt).Msgf("Copying %s from pod %s failed, retrying in %s", srcFile, pod.Pod.Name, backoff)
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(backoff):
+		}
+		backoff = min(backoff*2, pcapCopyMaxBackoff)
+	}
+}
+
+// removeStalePcapPartials removes the partial copies in the directory of
+// worker files older than any file the workers still keep. Those were rotated
+// away, so they can't be resumed anymore.
+func removeStalePcapPartials(dir string, workerPods []*PodFileInfo) {
+	var oldest time.Time
+	for _, pod := range workerPods {
+		if pod.OldestFile.IsZero() {
+			continue
+		}
+		if oldest.IsZero() || pod.OldestFile.Before(oldest) {
+			oldest = pod.OldestFile
+		}
+	}
+	if oldest.IsZero() {
+		return
+	}
+
+	partials, err := filepath.Glob(filepath.Join(dir, "*"+pcapPartialSuffix))
+	if err != nil {
+		return
+	}
+	for _, partial := range partials {
+		fileTime, err := parsePcapFileTime(strings.TrimSuffix(filepath.Base(partial), pcapPartialSuffix))
+		if err != nil || !fileTime.Before(oldest) {
+			continue
+		}
+		if err := os.Remove(partial); err == nil {
+			log.Debug().Str("file", partial).Msg("Removed the partial copy of a file the workers rotated away.")
+		}
+	}
+}
+
+// logPcapCopySummary reports how many files were copied and which couldn't
+// be, returning an error if any is missing from the capture.
+func logPcapCopySummary(copied int, failures []pcapCopyFailure) error {
+	for _, failure := range failures {
+		event := log.Warn().Err(failure.Err).Str("pod", failure.Pod).Str("node", failure.Node)
+		if failure.File == "" {
+			event.Msg("Couldn't list the PCAP files of the worker.")
+		} else {
+			event.Str("file", failure.File).Msg("Couldn't copy the PCAP file.")
+		}
+	}
+
+	if len(failures) == 0 {
+		log.Info().Int("copied", copied).Msg("All PCAP files copied and verified.")
+		return nil
+	}
+
+	log.Warn().Int("copied", copied).Int("failed", len(failures)).Msg("The capture has gaps, some PCAP files couldn't be copied.")
+	return fmt.Errorf("%d PCAP files or workers couldn't be copied", len(failures))
+}
@@ -0,0 +1,71 @@
+package cmd
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestVerifyCopiedFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "copied.pcap")
+	data := []byte("captured packets")
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+	sum := sha256.Sum256(data)
+	checksum := hex.EncodeToString(sum[:])
+
+	if err := verifyCopiedFile(path, podFileStat{Size: int64(len(data)), Checksum: checksum}); err != nil {
+		t.Errorf("unexpected error - err: %v", err)
+	}
+	if err := verifyCopiedFile(path, podFileStat{Size: int64(len(data))}); err != nil {
+		t.Errorf("unexpected error without a checksum - err: %v", err)
+	}
+	if err := verifyCopiedFile(path, podFileStat{Size: int64(len(data)) + 1, Checksum: checksum}); err == nil {
+		t.Error("expected an error for a truncated file")
+	}
+	if err := verifyCopiedFile(path, podFileStat{Size: int64(len(data)), Checksum: "00"}); !errors.Is(err, errPcapChecksumMismatch) {
+		t.Errorf("expected a checksum mismatch - err: %v", err)
+	}
+}
+
+func TestLogPcapCopySummary(t *testing.T) {
+	if err := logPcapCopySummary(3, nil); err != nil {
+		t.Errorf("unexpected error - err: %v", err)
+	}
+
+	failures := []pcapCopyFailure{{Pod: "worker", Node: "node", File: "node-20240101-120000.pcap", Err: errors.New("stream dropped")}}
+	if err := logPcapCopySummary(3, failures); err == nil {
+		t.Error("expected an error for a capture with gaps")
+	}
+}
+
+func TestRemoveStalePcapPartials(t *testing.T) {
+	dir := t.TempDir()
+	stale := filepath.Join(dir, "kubeshark-20240501-120000.pcap"+pcapPartialSuffix)
+	current := filepath.Join(dir, "kubeshark-20240501-140000.pcap"+pcapPartialSuffix)
+	other := filepath.Join(dir, "snapshot.pcap"+pcapPartialSuffix)
+	for _, path := range []string{stale, current, other} {
+		if err := os.WriteFile(path, []byte("partial"), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	removeStalePcapPartials(dir, []*PodFileInfo{
+		{OldestFile: time.Date(2024, 5, 1, 13, 0, 0, 0, time.UTC)},
+		{},
+	})
+
+	if _, err := os.Stat(stale); !os.IsNotExist(err) {
+		t.Errorf("expected the partial copy of a rotated file to be removed - err: %v", err)
+	}
+	for _, path := range []string{current, other} {
+		if _, err := os.Stat(path); err != nil {
+			t.Errorf("expected %s to be kept - err: %v", path, err)
+		}
+	}
+}
@@ -0,0 +1,110 @@
+package cmd
+
+import (
+	"hash/maphash"
+	"time"
+
+	"github.com/kubeshark/gopacket"
+	"github.com/kubeshark/gopacket/layers"
+)
+
+// pcapDedupEntry is a packet seen, in the order they were seen
+type pcapDedupEntry struct {
+	key  uint64
+	seen time.Time
+}
+
+// pcapDeduplicator drops the copies of IP packets seen within the window,
+// like the hub does with detectDuplicates and duplicateTimeframe. Traffic
+// between pods on different nodes is captured on both nodes, with different
+// link layers, TTLs and timestamps, so only the IP packet is compared, with
+// the TTL (or hop limit) and the header checksum left out. Packets must come
+// in timestamp order, which keeps the earliest copy.
+type pcapDeduplicator struct {
+	window  time.Duration
+	seed    maphash.Seed
+	seen    map[uint64]time.Time
+	entries []pcapDedupEntry
+
+	// dropped counts the copies dropped
+	dropped int64
+}
+
+func newPcapDeduplicator(window time.Duration) *pcapDeduplicator {
+	return &pcapDeduplicator{
+		window: window,
+		seed:   maphash.MakeSeed(),
+		seen:   map[uint64]time.Time{},
+	}
+}
+
+// duplicate tells if the packet is a copy of one seen within the window,
+// counting it as dropped if so.
+func (dedup *pcapDeduplicator) duplicate(linkType layers.LinkType, ci gopacket.CaptureInfo, data []byte) bool {
+	dedup.expire(ci.Timestamp)
+
+	key, ok := dedup.key(linkType, data)
+	if !ok {
+		return false
+	}
+
+	if seen, ok := dedup.seen[key]; ok && ci.Timestamp.Sub(seen) <= dedup.window {
+		dedup.dropped++
+		return true
+	}
+
+	dedup.seen[key] = ci.Timestamp
+	dedup.entries = append(dedup.entries, pcapDedupEntry{key: key, seen: ci.Timestamp})
+	return false
+}
+
+// expire forgets the packets seen before the window.
+func (dedup *pcapDeduplicator) expire(now time.Time) {
+	expired := 0
+	for ; expired < len(dedup.entries); expired++ {
+		entry := dedup.entries[expired]
+		if now.Sub(entry.seen) <= dedup.window {
+			break
+		}
+		if dedup.seen[entry.key].Equal(entry.seen) {
+			delete(dedup.seen, entry.key)
+		}
+	}
+
+	dedup.entries = dedup.entries[expired:]
+}
+
+// key hashes the IP packet, leaving the fields routing changes out. Non-IP
+// packets aren't deduplicated.
+func (dedup *pcapDeduplicator) key(linkType layers.LinkType, data []byte) (uint64, bool) {
+	packet := gopacket.NewPacket(data, linkType, gopacket.DecodeOptions{Lazy: true, NoCopy: true}, gopacket.UnknownCgroupID, 0)
+	network := packet.NetworkLayer()
+	if network == nil {
+		return 0, false
+	}
+
+	start := offsetIn(data, network.LayerContents())
+	ip := data[start : start+len(network.LayerContents())+len(network.LayerPayload())]
+
+	var hash maphash.Hash
+	hash.SetSeed(dedup.seed)
+	switch network.LayerType() {
+	case layers.LayerTypeIPv4:
+		if len(ip) < 20 {
+			return 0, false
+		}
+		hash.Write(ip[:8])
+		hash.WriteByte(ip[9])
+		hash.Write(ip[12:])
+	case layers.LayerTypeIPv6:
+		if len(ip) < 40 {
+			return 0, false
+		}
+		hash.Write(ip[:7])
+		hash.Write(ip[8:])
+	default:
+		return 0, false
+	}
+
+	return hash.Sum64(), true
+}
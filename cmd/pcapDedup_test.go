@@ -0,0 +1,46 @@
+package cmd
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	"github.com/kubeshark/gopacket"
+	"github.com/kubeshark/gopacket/layers"
+)
+
+func TestPcapDeduplicator(t *testing.T) {
+	base := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	request := newTestTCPPacket(t, net.ParseIP("10.244.1.5"), net.ParseIP("10.244.2.9"), []byte("GET / HTTP/1.1\r\n\r\n"))
+
+	// The copy from the other node has other MACs and a lower TTL
+	copied := append([]byte(nil), request...)
+	copy(copied[0:12], []byte{2, 0, 0, 0, 0, 1, 2, 0, 0, 0, 0, 2})
+	copied[14+8]--
+
+	dedup := newPcapDeduplicator(200 * time.Millisecond)
+	packets := []struct {
+		data      []byte
+		at        time.Duration
+		duplicate bool
+	}{
+		{request, 0, false},
+		{copied, 3 * time.Millisecond, true},
+		{newTestTCPPacket(t, net.ParseIP("10.244.2.9"), net.ParseIP("10.244.1.5"), []byte("HTTP/1.1 200 OK\r\n\r\n")), 5 * time.Millisecond, false},
+		{copied, time.Second, false},
+	}
+
+	for i, packet := range packets {
+		ci := gopacket.CaptureInfo{Timestamp: base.Add(packet.at), CaptureLength: len(packet.data), Length: len(packet.data)}
+		if duplicate := dedup.duplicate(layers.LinkTypeEthernet, ci, packet.data); duplicate != packet.duplicate {
+			t.Errorf("unexpected result of packet %d - expected: %v, actual: %v", i, packet.duplicate, duplicate)
+		}
+	}
+
+	if dedup.dropped != 1 {
+		t.Errorf("unexpected dropped count - expected: 1, actual: %d", dedup.dropped)
+	}
+	if len(dedup.seen) != 1 {
+		t.Errorf("expected the packets out of the window to be forgotten, %d kept", len(dedup.seen))
+	}
+}
@@ -1,20 +1,21 @@
 package cmd
 
 import (
-	"errors"
+	"context"
 	"fmt"
 	"os"
-	"path/filepath"
+	"os/signal"
+	"slices"
+	"syscall"
 	"time"
 
 	"github.com/creasty/defaults"
+	"github.com/kubeshark/kubeshark/config"
 	"github.com/kubeshark/kubeshark/config/configStructs"
+	"github.com/kubeshark/kubeshark/kubernetes"
 	"github.com/rs/zerolog"
 	"github.com/rs/zerolog/log"
 	"github.com/spf13/cobra"
-	"k8s.io/client-go/kubernetes"
-	"k8s.io/client-go/tools/clientcmd"
-	"k8s.io/client-go/util/homedir"
 )
 
 // pcapDumpCmd represents the consolidated pcapdump command
@@ -22,35 +23,28 @@ var pcapDumpCmd = &cobra.Command{
 	Use:   "pcapdump",
 	Short: "Store all captured traffic (including decrypted TLS) in a PCAP file.",
 	RunE: func(cmd *cobra.Command, args []string) error {
-		// Retrieve the kubeconfig path from the flag
-		kubeconfig, _ := cmd.Flags().GetString(configStructs.PcapKubeconfig)
-
-		// If kubeconfig is not provided, use the default location
-		if kubeconfig == "" {
-			if home := homedir.HomeDir(); home != "" {
-				kubeconfig = filepath.Join(home, ".kube", "config")
-			} else {
-				return errors.New("kubeconfig flag not provided and no home directory available for default config location")
-			}
-		}
-
-		debugEnabled, _ := cmd.Flags().GetBool("debug")
-		if debugEnabled {
-			zerolog.SetGlobalLevel(zerolog.DebugLevel)
-			log.Debug().Msg("Debug logging enabled")
-		} else {
-			zerolog.SetGlobalLevel(zerolog.InfoLevel)
+		changes, err := pcapDumpControlChanges(cmd)
+		if err != nil {
+			return err
 		}
 
-		// Use the current context in kubeconfig
-		config, err := clientcmd.BuildConfigFromFlags("", kubeconfig)
+		kubernetesProvider, err := newPcapDumpProvider(cmd)
 		if err != nil {
-			return fmt.Errorf("Error building kubeconfig: %w", err)
+			return err
 		}
 
-		clientset, err := kubernetes.NewForConfig(config)
-		if err != nil {
-			return fmt.Errorf("Error creating Kubernetes client: %w", err)
+		nodes, _ := cmd.Flags().GetStringSlice(configStructs.PcapNodes)
+
+		// Reconfigure the in-cluster dumping instead of copying if asked to
+		if len(changes) > 0 {
+			if destDir, _ := cmd.Flags().GetString(configStructs.PcapDest); destDir != "" {
+				return fmt.Errorf("--%s can not be used together with --%s", configStructs.PcapDest, configStructs.PcapDumpEnabled)
+			}
+			return reconfigurePcapDump(context.Background(), kubernetesProvider, pcapDumpOptions{
+				ReleaseNamespace: config.Config.Tap.Release.Namespace,
+				ReleaseName:      config.Config.Tap.Release.Name,
+				Nodes:            nodes,
+			}, changes)
 		}
 
 		// Parse the `--time` flag
@@ -65,6 +59,27 @@ var pcapDumpCmd = &cobra.Command{
 			cutoffTime = &tempCutoffTime
 		}
 
+		// Parse the `--from` and `--to` flags
+		fromStr, _ := cmd.Flags().GetString(configStructs.PcapFrom)
+		toStr, _ := cmd.Flags().GetString(configStructs.PcapTo)
+		if fromStr != "" && cutoffTime != nil {
+			return fmt.Errorf("--%s can not be used together with --%s", configStructs.PcapFrom, configStructs.PcapTime)
+		}
+		from, err := parsePcapWindowTime(fromStr)
+		if err != nil {
+			return fmt.Errorf("Invalid --%s: %w", configStructs.PcapFrom, err)
+		}
+		if from == nil {
+			from = cutoffTime
+		}
+		to, err := parsePcapWindowTime(toStr)
+		if err != nil {
+			return fmt.Errorf("Invalid --%s: %w", configStructs.PcapTo, err)
+		}
+		if from != nil && to != nil && !to.After(*from) {
+			return fmt.Errorf("--%s must be after --%s", configStructs.PcapTo, configStructs.PcapFrom)
+		}
+
 		// Test the dest dir if provided
 		destDir, _ := cmd.Flags().GetString(configStructs.PcapDest)
 		if destDir != "" {
@@ -85,8 +100,156 @@ var pcapDumpCmd = &cobra.Command{
 			_ = os.Remove(tempFile.Name())
 		}
 
+		output, _ := cmd.Flags().GetString(configStructs.PcapWrite)
+		if output == pcapOutputStdout && destDir == "" {
+			// Nothing but the stream is kept, stage the copied files aside
+			stagingDir, err := os.MkdirTemp("", "pcapdump-*")
+			if err != nil {
+				return fmt.Errorf("Error creating a staging directory: %w", err)
+			}
+			defer os.RemoveAll(stagingDir)
+			destDir = stagingDir
+		}
+
+		format, _ := cmd.Flags().GetString(configStructs.PcapFormat)
+		if format != pcapFormatPcap && format != pcapFormatPcapng {
+			return fmt.Errorf("Invalid format %s, expected %s or %s", format, pcapFormatPcap, pcapFormatPcapng)
+		}
+
+		compress, _ := cmd.Flags().GetString(configStructs.PcapCompress)
+		if _, ok := pcapCompressExtensions[compress]; compress != "" && !ok {
+			return fmt.Errorf("Invalid compression %s, expected %s or %s", compress, pcapCompressZstd, pcapCompressGzip)
+		}
+
+		var splitSize int64
+		if splitSizeStr, _ := cmd.Flags().GetString(configStructs.PcapSplitSize); splitSizeStr != "" {
+			if splitSize, err = parseByteSize(splitSizeStr); err != nil {
+				return fmt.Errorf("Invalid --%s: %w", configStructs.PcapSplitSize, err)
+			}
+		}
+		var splitTime time.Duration
+		if splitTimeStr, _ := cmd.Flags().GetString(configStructs.PcapSplitTime); splitTimeStr != "" {
+			if splitTime, err = time.ParseDuration(splitTimeStr); err != nil || splitTime <= 0 {
+				return fmt.Errorf("Invalid --%s: %s", configStructs.PcapSplitTime, splitTimeStr)
+			}
+		}
+		if output == pcapOutputStdout && (splitSize > 0 || splitTime > 0) {
+			return fmt.Errorf("A stream to stdout can't be split, --%s and --%s need a local file", configStructs.PcapSplitSize, configStructs.PcapSplitTime)
+		}
+		upload, _ := cmd.Flags().GetBool(configStructs.PcapUpload)
+		if output == pcapOutputStdout && upload {
+			return fmt.Errorf("A stream to stdout can't be uploaded, --%s needs a local file", configStructs.PcapUpload)
+		}
+
+		var anonymizer *pcapAnonymizer
+		payloadBytes, _ := cmd.Flags().GetInt(configStructs.PcapPayloadBytes)
+		redactHTTP, _ := cmd.Flags().GetBool(configStructs.PcapRedactHttp)
+		if anonymize, _ := cmd.Flags().GetBool(configStructs.PcapAnonymize); anonymize {
+			if payloadBytes < 0 {
+				return fmt.Errorf("Invalid --%s: %d", configStructs.PcapPayloadBytes, payloadBytes)
+			}
+			if anonymizer, err = newPcapAnonymizer(payloadBytes, redactHTTP); err != nil {
+				return fmt.Errorf("Error creating the anonymization key: %w", err)
+			}
+		} else if payloadBytes != 0 || redactHTTP {
+			return fmt.Errorf("--%s and --%s need --%s", configStructs.PcapPayloadBytes, configStructs.PcapRedactHttp, configStructs.PcapAnonymize)
+		}
+
+		var dedupWindow time.Duration
+		if dedup, _ := cmd.Flags().GetBool(configStructs.PcapDedup); dedup {
+			timeframe, _ := cmd.Flags().GetString(configStructs.PcapDuplicateTimeframe)
+			if dedupWindow, err = time.ParseDuration(timeframe); err != nil || dedupWindow <= 0 {
+				return fmt.Errorf("Invalid --%s: %s", configStructs.PcapDuplicateTimeframe, timeframe)
+			}
+		}
+
+		bpf, _ := cmd.Flags().GetString(configStructs.PcapBpf)
+		podRegex, _ := cmd.Flags().GetString(configStructs.PcapPodRegex)
+		namespaces, _ := cmd.Flags().GetStringSlice(configStructs.PcapNamespace)
+		filter, err := newPcapFilter(context.Background(), kubernetesProvider, bpf, podRegex, namespaces)
+		if err != nil {
+			return err
+		}
+
+		// Snapshot the pod IPs now, they're meaningless once pods churn
+		hostNamespaces := []string{config.Config.Tap.Release.Namespace}
+		for _, namespace := range namespaces {
+			if !slices.Contains(hostNamespaces, namespace) {
+				hostNamespaces = append(hostNamespaces, namespace)
+			}
+		}
+		hosts, err := snapshotHostEntries(context.Background(), kubernetesProvider, hostNamespaces)
+		if err != nil {
+			log.Warn().Err(err).Msg("Failed mapping IPs to pods, the capture won't resolve them.")
+		}
+
+		options := pcapDumpOptions{
+			ReleaseNamespace: config.Config.Tap.Release.Namespace,
+			ReleaseName:      config.Config.Tap.Release.Name,
+			DestDir:          destDir,
+			Output:           output,
+			From:             from,
+			To:               to,
+			Format:           format,
+			Compress:         compress,
+			SplitSize:        splitSize,
+			SplitTime:        splitTime,
+			Hosts:            hosts,
+			Filter:           filter.withWindow(from, to),
+			Nodes:            nodes,
+			Anonymizer:       anonymizer,
+			DedupWindow:      dedupWindow,
+			Upload:           upload,
+		}
+
+		if follow, _ := cmd.Flags().GetBool(configStructs.PcapFollow); follow {
+			if format != pcapFormatPcap {
+				return fmt.Errorf("--%s writes the %s format only", configStructs.PcapFollow, pcapFormatPcap)
+			}
+			if compress != "" || splitSize > 0 || splitTime > 0 {
+				return fmt.Errorf("--%s rolls with --%s and --%s, and doesn't compress", configStructs.PcapFollow, configStructs.PcapRollSize, configStructs.PcapRollTime)
+			}
+			if anonymizer != nil {
+				return fmt.Errorf("--%s can not be used together with --%s", configStructs.PcapAnonymize, configStructs.PcapFollow)
+			}
+			if dedupWindow > 0 {
+				return fmt.Errorf("--%s can not be used together with --%s", configStructs.PcapDedup, configStructs.PcapFollow)
+			}
+			if upload {
+				return fmt.Errorf("--%s can not be used together with --%s", configStructs.PcapUpload, configStructs.PcapFollow)
+			}
+			if output != "" && output != pcapOutputStdout {
+				return fmt.Errorf("--%s writes into --%s, or to stdout with --%s -", configStructs.PcapFollow, configStructs.PcapDest, configStructs.PcapWrite)
+			}
+
+			followOptions := pcapFollowOptions{Interval: time.Minute}
+			if interval, err := time.ParseDuration(config.Config.PcapDump.PcapTimeInterval); err == nil && interval > 0 {
+				followOptions.Interval = interval
+			}
+			rollSize, _ := cmd.Flags().GetString(configStructs.PcapRollSize)
+			rollTime, _ := cmd.Flags().GetString(configStructs.PcapRollTime)
+			if output == pcapOutputStdout && (rollSize != "" || rollTime != "") {
+				return fmt.Errorf("A stream to stdout doesn't roll, --%s and --%s need a local file", configStructs.PcapRollSize, configStructs.PcapRollTime)
+			}
+			if rollSize != "" {
+				if followOptions.RollSize, err = parseByteSize(rollSize); err != nil {
+					return err
+				}
+			}
+			if rollTime != "" {
+				if followOptions.RollTime, err = time.ParseDuration(rollTime); err != nil {
+					return fmt.Errorf("Invalid --%s: %w", configStructs.PcapRollTime, err)
+				}
+			}
+
+			ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+			defer stop()
+
+			return followPcapFiles(ctx, kubernetesProvider, options, followOptions)
+		}
+
 		log.Info().Msg("Copying PCAP files")
-		err = copyPcapFiles(clientset, config, destDir, cutoffTime)
+		err = copyPcapFiles(kubernetesProvider, options)
 		if err != nil {
 			return err
 		}
@@ -95,6 +258,76 @@ var pcapDumpCmd = &cobra.Command{
 	},
 }
 
+// newPcapDumpProvider connects to the cluster with the kubeconfig and context
+// of the flags, falling back to the kube section of the config like the other
+// commands. The release namespace of the flags applies to the whole run.
+func newPcapDumpProvider(cmd *cobra.Command) (*kubernetes.Provider, error) {
+	kubeconfig, _ := cmd.Flags().GetString(configStructs.PcapKubeconfig)
+	if kubeconfig == "" {
+		kubeconfig = config.Config.KubeConfigPath()
+	}
+	kubeContext, _ := cmd.Flags().GetString(configStructs.PcapContext)
+	if kubeContext == "" {
+		kubeContext = config.Config.Kube.Context
+	}
+
+	debugEnabled, _ := cmd.Flags().GetBool("debug")
+	if debugEnabled {
+		zerolog.SetGlobalLevel(zerolog.DebugLevel)
+		log.Debug().Msg("Debug logging enabled")
+	} else {
+		zerolog.SetGlobalLevel(zerolog.InfoLevel)
+	}
+
+	kubernetesProvider, err := kubernetes.NewProvider(kubeconfig, kubeContext)
+	if err != nil {
+		return nil, fmt.Errorf("Error creating Kubernetes client: %w", err)
+	}
+
+	if config.Config.PcapDump.PcapRelease.Namespace != "" {
+		config.Config.Tap.Release.Namespace = config.Config.PcapDump.PcapRelease.Namespace
+	}
+
+	return kubernetesProvider, nil
+}
+
+// pcapWindowTimeLayouts are the local time layouts accepted besides RFC3339
+var pcapWindowTimeLayouts = []string{
+	"2006-01-02T15:04:05",
+	"2006-01-02 15:04:05",
+	"2006-01-02T15:04",
+	"2006-01-02 15:04",
+	"2006-01-02",
+}
+
+// parsePcapWindowTime parses a time window bound. Times without a zone are
+// in the configured timezone, or the local one if it isn't set.
+func parsePcapWindowTime(value string) (*time.Time, error) {
+	if value == "" {
+		return nil, nil
+	}
+
+	if parsed, err := time.Parse(time.RFC3339Nano, value); err == nil {
+		return &parsed, nil
+	}
+
+	location := time.Local
+	if config.Config.Timezone != "" {
+		var err error
+		if location, err = time.LoadLocation(config.Config.Timezone); err != nil {
+			return nil, fmt.Errorf("invalid timezone %s: %w", config.Config.Timezone, err)
+		}
+	}
+
+	for _, layout := range pcapWindowTimeLayouts {
+		if parsed, err := time.ParseInLocation(layout, value, location); err == nil {
+			return &parsed, nil
+		}
+	}
+
+	return nil, fmt.Errorf("%q is neither RFC3339 nor a local time such as \"2024-05-01 14:30:00\"", value)
+}
+
 func init() {
 	rootCmd.AddCommand(pcapDumpCmd)
 
@@ -105,6 +338,32 @@ func init() {
 
 	pcapDumpCmd.Flags().String(configStructs.PcapTime, "", "Time interval (e.g., 10m, 1h) in the past for which the pcaps are copied")
 	pcapDumpCmd.Flags().String(configStructs.PcapDest, "", "Local destination path for copied PCAP files (can not be used together with --enabled)")
-	pcapDumpCmd.Flags().String(configStructs.PcapKubeconfig, "", "Path for kubeconfig (if not provided the default location will be checked)")
+	pcapDumpCmd.PersistentFlags().String(configStructs.PcapKubeconfig, "", "Path for kubeconfig (if not provided the default location will be checked)")
+	pcapDumpCmd.PersistentFlags().String(configStructs.PcapContext, defaultPcapDumpConfig.PcapContext, "Kube context to use (if not provided kube.context or the current context is used)")
+	pcapDumpCmd.PersistentFlags().StringP(configStructs.ReleaseNamespaceLabel, "s", defaultPcapDumpConfig.PcapRelease.Namespace, "Release namespace of Kubeshark (if not provided tap.release.namespace is used)")
+	pcapDumpCmd.Flags().String(configStructs.PcapFrom, defaultPcapDumpConfig.PcapFrom, "Start of the time window to copy, RFC3339 or local time (e.g. \"2024-05-01 14:30\") in the configured timezone")
+	pcapDumpCmd.Flags().String(configStructs.PcapTo, defaultPcapDumpConfig.PcapTo, "End of the time window to copy, RFC3339 or local time in the configured timezone")
+	pcapDumpCmd.Flags().String(configStructs.PcapFormat, defaultPcapDumpConfig.PcapFormat, "Output format: pcap, or pcapng with an interface per worker node and capture metadata")
+	pcapDumpCmd.Flags().String(configStructs.PcapBpf, defaultPcapDumpConfig.PcapBpf, "Keep only the packets matching the BPF expression (e.g. \"tcp port 5432\")")
+	pcapDumpCmd.Flags().String(configStructs.PcapPodRegex, defaultPcapDumpConfig.PcapPod.Regex, "Keep only the packets to or from the pods matching the regex")
+	pcapDumpCmd.Flags().StringSlice(configStructs.PcapNamespace, defaultPcapDumpConfig.PcapNamespace, "Keep only the packets to or from the pods in the namespaces")
+	pcapDumpCmd.PersistentFlags().StringSlice(configStructs.PcapNodes, defaultPcapDumpConfig.PcapNodes, "Use only the workers on the nodes")
+	pcapDumpCmd.Flags().Bool(configStructs.PcapFollow, defaultPcapDumpConfig.PcapFollow, "Keep syncing the PCAP files as the workers rotate them, resuming from the manifest in the destination directory")
+	pcapDumpCmd.Flags().String(configStructs.PcapRollSize, defaultPcapDumpConfig.PcapRoll.Size, "With --follow, start a new local file once it reaches the size (e.g. 500MB)")
+	pcapDumpCmd.Flags().String(configStructs.PcapRollTime, defaultPcapDumpConfig.PcapRoll.Time, "With --follow, start a new local file once it spans the duration (e.g. 1h)")
+	pcapDumpCmd.Flags().StringP(configStructs.PcapWrite, "w", defaultPcapDumpConfig.PcapWrite, "Write the merged capture to the file, or to stdout with \"-\" (e.g. -w - | wireshark -k -i -)")
+	pcapDumpCmd.Flags().String(configStructs.PcapCompress, defaultPcapDumpConfig.PcapCompress, "Compress the merged capture with zstd or gzip")
+	pcapDumpCmd.Flags().String(configStructs.PcapSplitSize, defaultPcapDumpConfig.PcapSplit.Size, "Split the merged capture into numbered files of about the size (e.g. 1GB) once compressed, with a checksum file")
+	pcapDumpCmd.Flags().String(configStructs.PcapSplitTime, defaultPcapDumpConfig.PcapSplit.Time, "Split the merged capture into numbered files spanning the duration (e.g. 10m), with a checksum file")
+	pcapDumpCmd.Flags().Bool(configStructs.PcapAnonymize, defaultPcapDumpConfig.PcapAnonymize, "Remap the IPs keeping their prefixes and scrub the MACs, writing a private mapping file to reverse it")
+	pcapDumpCmd.Flags().Int(configStructs.PcapPayloadBytes, defaultPcapDumpConfig.PcapPayload.Bytes, "With --anonymize, keep only the first bytes of every TCP and UDP payload (0 keeps them whole)")
+	pcapDumpCmd.Flags().Bool(configStructs.PcapRedactHttp, defaultPcapDumpConfig.PcapRedact.Http, "With --anonymize, blank out the Authorization and Cookie headers of plaintext and decrypted HTTP")
+	pcapDumpCmd.Flags().Bool(configStructs.PcapDedup, defaultPcapDumpConfig.PcapDedup, "Drop the copies of packets captured on more than one node, keeping the earliest")
+	pcapDumpCmd.Flags().String(configStructs.PcapDuplicateTimeframe, defaultPcapDumpConfig.PcapDuplicate.Timeframe, "With --dedup, how far apart copies of a packet may be captured")
+	pcapDumpCmd.Flags().Bool(configStructs.PcapUpload, defaultPcapDumpConfig.PcapUpload, "Upload the merged capture to the cloud storage of tap.snapshots.cloud")
+	pcapDumpCmd.Flags().Bool(configStructs.PcapDumpEnabled, defaultPcapDumpConfig.PcapDumpEnabled, "Enable or disable PCAP dumping on the workers, instead of copying")
+	pcapDumpCmd.Flags().String(configStructs.PcapTimeInterval, defaultPcapDumpConfig.PcapTimeInterval, "Set how often the workers start a new PCAP file, instead of copying")
+	pcapDumpCmd.Flags().String(configStructs.PcapMaxTime, defaultPcapDumpConfig.PcapMaxTime, "Set how long the workers keep PCAP files, instead of copying")
+	pcapDumpCmd.Flags().String(configStructs.PcapMaxSize, defaultPcapDumpConfig.PcapMaxSize, "Set how much disk the PCAP files may take on every worker, instead of copying")
 	pcapDumpCmd.Flags().Bool("debug", false, "Enable debug logging")
 }
@@ -0,0 +1,219 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/kubeshark/kubeshark/config/configStructs"
+	"github.com/kubeshark/kubeshark/kubernetes"
+	"github.com/rs/zerolog/log"
+	"github.com/spf13/cobra"
+)
+
+const (
+	pcapDumpConfirmPollInterval = 5 * time.Second
+	// pcapDumpConfirmGrace is how long past the interval the workers have
+	// to show they picked a change up
+	pcapDumpConfirmGrace = 30 * time.Second
+)
+
+// pcapDumpConfigKeys maps the flags that control in-cluster dumping to the
+// config map keys the workers read.
+var pcapDumpConfigKeys = []struct {
+	flag string
+	key  string
+}{
+	{configStructs.PcapDumpEnabled, kubernetes.CONFIG_PCAP_DUMP_ENABLE},
+	{configStructs.PcapTimeInterval, kubernetes.CONFIG_TIME_INTERVAL},
+	{configStructs.PcapMaxTime, kubernetes.CONFIG_MAX_TIME},
+	{configStructs.PcapMaxSize, kubernetes.CONFIG_MAX_SIZE},
+}
+
+// pcapDumpControlChanges returns the config map values of the control flags
+// set on the command line, validating them first.
+func pcapDumpControlChanges(cmd *cobra.Command) (map[string]string, error) {
+	changes := map[string]string{}
+	for _, control := range pcapDumpConfigKeys {
+		if !cmd.Flags().Changed(control.flag) {
+			continue
+		}
+
+		value := cmd.Flags().Lookup(control.flag).Value.String()
+		switch control.flag {
+		case configStructs.PcapDumpEnabled:
+			if _, err := strconv.ParseBool(value); err != nil {
+				return nil, fmt.Errorf("Invalid --%s: %s", control.flag, value)
+			}
+		case configStructs.PcapTimeInterval, configStructs.PcapMaxTime:
+			if duration, err := time.ParseDuration(value); err != nil || duration <= 0 {
+				return nil, fmt.Errorf("Invalid --%s: %s", control.flag, value)
+			}
+		case configStructs.PcapMaxSize:
+			if _, err := parseByteSize(value); err != nil {
+				return nil, fmt.Errorf("Invalid --%s: %w", control.flag, err)
+			}
+		}
+		changes[control.key] = value
+	}
+
+	return changes, nil
+}
+
+// reconfigurePcapDump applies the changes to the config map of the release,
+// reads it back to check it holds them, and confirms the workers picked them
+// up: when dumping is enabled, every worker must write a new PCAP file within
+// the new interval, and when it's disabled, none may start one after it.
+func reconfigurePcapDump(ctx context.Context, provider *kubernetes.Provider, options pcapDumpOptions, changes map[string]string) error {
+	workerPods, err := listTargetWorkerPods(ctx, provider, options)
+	if err != nil {
+		return err
+	}
+
+	// The files before the change, to tell which ones the workers write after
+	before := map[string][]string{}
+	for _, pod := range workerPods {
+		if err := listFilesInPodDir(ctx, provider, pod, nil, nil); err == nil {
+			before[pod.Pod.Name] = pod.Files
+		}
+	}
+
+	changedAt := time.Now().UTC()
+	for _, control := range pcapDumpConfigKeys {
+		value, ok := changes[control.key]
+		if !ok {
+			continue
+		}
+		if _, err := kubernetes.SetConfig(provider, control.key, value); err != nil {
+			return fmt.Errorf("failed updating %s: %w", control.key, err)
+		}
+	}
+
+	data, err := kubernetes.GetConfigMap(provider)
+	if err != nil {
+		return fmt.Errorf("failed reading the config map back: %w", err)
+	}
+	if mismatches := pcapDumpConfigMismatches(changes, data); len(mismatches) > 0 {
+		return fmt.Errorf("the config map doesn't hold the change: %s", strings.Join(mismatches, ", "))
+	}
+
+	interval, err := time.ParseDuration(data[kubernetes.CONFIG_TIME_INTERVAL])
+	if err != nil || interval <= 0 {
+		interval = time.Minute
+	}
+	timeout := interval + pcapDumpConfirmGrace
+
+	if enabled, _ := strconv.ParseBool(data[kubernetes.CONFIG_PCAP_DUMP_ENABLE]); !enabled {
+		return confirmPcapDumpStopped(ctx, provider, workerPods, changedAt.Add(interval), timeout)
+	}
+
+	log.Info().Str("timeout", timeout.String()).Msg("Waiting for the workers to write a PCAP file with the change...")
+	waitCtx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	pending := workerPods
+	for len(pending) > 0 {
+		var stillPending []*PodFileInfo
+		for _, pod := range pending {
+			if err := listFilesInPodDir(waitCtx, provider, pod, nil, nil); err == nil && hasNewPcapFile(before[pod.Pod.Name], pod.Files) {
+				log.Info().Str("node", pod.Pod.Spec.NodeName).Str("pod", pod.Pod.Name).Msg("Worker is dumping.")
+				continue
+			}
+			stillPending = append(stillPending, pod)
+		}
+		pending = stillPending
+		if len(pending) == 0 {
+			break
+		}
+
+		select {
+		case <-waitCtx.Done():
+			for _, pod := range pending {
+				log.Warn().Str("node", pod.Pod.Spec.NodeName).Str("pod", pod.Pod.Name).Msg("Worker didn't write a PCAP file since the change.")
+			}
+			return fmt.Errorf("%d of %d workers didn't confirm the change", len(pending), len(workerPods))
+		case <-time.After(pcapDumpConfirmPollInterval):
+		}
+	}
+
+	log.Info().Int("workers", len(workerPods)).Msg("All workers picked the change up.")
+	return nil
+}
+
+// confirmPcapDumpStopped waits for the timeout, then checks no worker started
+// a PCAP file after the deadline, by which the workers rotate once.
+func confirmPcapDumpStopped(ctx context.Context, provider *kubernetes.Provider, workerPods []*PodFileInfo, deadline time.Time, timeout time.Duration) error {
+	log.Info().Str("timeout", timeout.String()).Msg("Waiting for the workers to stop dumping...")
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-time.After(timeout):
+	}
+
+	var unconfirmed int
+	for _, pod := range workerPods {
+		if err := listFilesInPodDir(ctx, provider, pod, nil, nil); err != nil {
+			log.Warn().Err(err).Str("node", pod.Pod.Spec.NodeName).Str("pod", pod.Pod.Name).Msg("Couldn't list the PCAP files of the worker.")
+			unconfirmed++
+			continue
+		}
+		if files := pcapFilesStartedAfter(pod.Files, deadline); len(files) > 0 {
+			log.Warn().Str("node", pod.Pod.Spec.NodeName).Str("pod", pod.Pod.Name).Strs("files", files).Msg("Worker is still dumping.")
+			unconfirmed++
+		}
+	}
+	if unconfirmed > 0 {
+		return fmt.Errorf("%d of %d workers didn't confirm the change", unconfirmed, len(workerPods))
+	}
+
+	log.Info().Int("workers", len(workerPods)).Msg("All workers stopped dumping.")
+	return nil
+}
+
+// pcapDumpConfigMismatches lists the changes the config map doesn't hold.
+func pcapDumpConfigMismatches(changes map[string]string, data map[string]string) (mismatches []string) {
+	for _, control := range pcapDumpConfigKeys {
+		value, ok := changes[control.key]
+		if ok && data[control.key] != value {
+			mismatches = append(mismatches, fmt.Sprintf("%s is %q instead of %q", control.key, data[control.key], value))
+		}
+	}
+
+	return mismatches
+}
+
+// pcapFilesStartedAfter returns the worker PCAP files whose name tells they
+// were started after the time.
+func pcapFilesStartedAfter(files []string, after time.Time) (started []string) {
+	for _, file := range files {
+		if fileTime, err := parsePcapFileTime(file); err == nil && fileTime.After(after) {
+			started = append(started, file)
+		}
+	}
+
+	return started
+}
+
+func hasNewPcapFile(before []string, after []string) bool {
+	for _, file := range after {
+		if file != "" && !slices.Contains(before, file) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// getPcapDumpConfigValue reads a key of the config map, returning an empty
+// string if it can't.
+func getPcapDumpConfigValue(provider *kubernetes.Provider, key string) string {
+	value, err := kubernetes.GetConfig(provider, key)
+	if err != nil {
+		log.Debug().Err(err).Str("config", key).Msg("Failed reading the config map.")
+	}
+
+	return value
+}
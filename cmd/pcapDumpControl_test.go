@@ -0,0 +1,83 @@
+package cmd
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/kubeshark/kubeshark/kubernetes"
+	"github.com/spf13/cobra"
+)
+
+func newTestPcapDumpControlCmd() *cobra.Command {
+	cmd := &cobra.Command{}
+	cmd.Flags().Bool("enabled", false, "")
+	cmd.Flags().String("timeInterval", "1m", "")
+	cmd.Flags().String("maxTime", "1h", "")
+	cmd.Flags().String("maxSize", "500MB", "")
+	return cmd
+}
+
+func TestPcapDumpControlChanges(t *testing.T) {
+	cmd := newTestPcapDumpControlCmd()
+	if err := cmd.Flags().Parse([]string{"--enabled=true", "--maxSize", "2GB"}); err != nil {
+		t.Fatal(err)
+	}
+
+	changes, err := pcapDumpControlChanges(cmd)
+	if err != nil {
+		t.Fatalf("unexpected error - err: %v", err)
+	}
+
+	expected := map[string]string{kubernetes.CONFIG_PCAP_DUMP_ENABLE: "true", kubernetes.CONFIG_MAX_SIZE: "2GB"}
+	if !reflect.DeepEqual(changes, expected) {
+		t.Errorf("unexpected changes - expected: %v, actual: %v", expected, changes)
+	}
+
+	cmd = newTestPcapDumpControlCmd()
+	if err := cmd.Flags().Parse([]string{"--timeInterval", "soon"}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := pcapDumpControlChanges(cmd); err == nil {
+		t.Error("expected an error for an invalid interval")
+	}
+}
+
+func TestHasNewPcapFile(t *testing.T) {
+	before := []string{"node-20240101-120000.pcap"}
+
+	if hasNewPcapFile(before, []string{"node-20240101-120000.pcap", ""}) {
+		t.Error("expected no new file")
+	}
+	if !hasNewPcapFile(before, []string{"node-20240101-120000.pcap", "node-20240101-120030.pcap"}) {
+		t.Error("expected a new file")
+	}
+}
+
+func TestPcapDumpConfigMismatches(t *testing.T) {
+	changes := map[string]string{kubernetes.CONFIG_PCAP_DUMP_ENABLE: "true", kubernetes.CONFIG_TIME_INTERVAL: "30s"}
+
+	if mismatches := pcapDumpConfigMismatches(changes, map[string]string{
+		kubernetes.CONFIG_PCAP_DUMP_ENABLE: "true",
+		kubernetes.CONFIG_TIME_INTERVAL:    "30s",
+		kubernetes.CONFIG_MAX_SIZE:         "500MB",
+	}); len(mismatches) != 0 {
+		t.Errorf("unexpected mismatches - mismatches: %v", mismatches)
+	}
+
+	if mismatches := pcapDumpConfigMismatches(changes, map[string]string{
+		kubernetes.CONFIG_PCAP_DUMP_ENABLE: "true",
+		kubernetes.CONFIG_TIME_INTERVAL:    "1m",
+	}); len(mismatches) != 1 {
+		t.Errorf("unexpected mismatches - expected: 1, actual: %v", mismatches)
+	}
+}
+
+func TestPcapFilesStartedAfter(t *testing.T) {
+	files := []string{"node-20240101-120000.pcap", "node-20240101-120100.pcap", "unexpected"}
+
+	started := pcapFilesStartedAfter(files, time.Date(2024, 1, 1, 12, 0, 30, 0, time.UTC))
+	if !reflect.DeepEqual(started, []string{"node-20240101-120100.pcap"}) {
+		t.Errorf("unexpected files - actual: %v", started)
+	}
+}
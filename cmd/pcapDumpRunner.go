@@ -1,7 +1,6 @@
 package cmd
 
 import (
-	"bufio"
 	"bytes"
 	"context"
 	"errors"
@@ -9,124 +8,133 @@ import (
 	"io"
 	"os"
 	"path/filepath"
+	"slices"
+	"sort"
 	"strings"
 	"sync"
 	"time"
 
-	"github.com/kubeshark/gopacket/pcapgo"
+	"github.com/kubeshark/kubeshark/kubernetes"
 	"github.com/rs/zerolog/log"
 	corev1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
-	"k8s.io/client-go/kubernetes"
-	"k8s.io/client-go/rest"
-	"k8s.io/client-go/tools/remotecommand"
 )
 
 const (
-	label                 = "app.kubeshark.com/app=worker"
+	workerAppLabel        = "app.kubeshark.com/app"
 	srcDir                = "pcapdump"
 	maxSnaplen     uint32 = 262144
 	maxTimePerFile        = time.Minute * 5
 )
 
+// pcapOutputStdout writes the merged capture to stdout instead of a file
+const pcapOutputStdout = "-"
+
+// pcapDumpOptions holds the settings of a pcapdump run
+type pcapDumpOptions struct {
+	ReleaseNamespace string
+	ReleaseName      string
+	DestDir          string
+	Output           string
+	From             *time.Time
+	To               *time.Time
+	Format           string
+	Compress         string
+	SplitSize        int64
+	SplitTime        time.Duration
+	Hosts            []hostEntry
+	Filter           *pcapFilter
+	Nodes            []string
+	Anonymizer       *pcapAnonymizer
+	DedupWindow      time.Duration
+	Upload           bool
+}
+
 // PodFileInfo represents information about a pod, its namespace, and associated files
 type PodFileInfo struct {
 	Pod         corev1.Pod
 	SrcDir      string
 	Files       []string
+	OldestFile  time.Time
 	CopiedFiles []string
+	Failures    []pcapCopyFailure
 }
 
-// listWorkerPods fetches all worker pods from multiple namespaces
-func listWorkerPods(ctx context.Context, clientset *kubernetes.Clientset, namespaces []string) ([]*PodFileInfo, error) {
-	var podFileInfos []*PodFileInfo
-	var errs []error
-	labelSelector := label
+// listWorkerPods fetches the worker pods of the Kubeshark release
+func listWorkerPods(ctx context.Context, provider *kubernetes.Provider, namespace string, release string) ([]*PodFileInfo, error) {
+	pods, err := provider.ListPodsByAppLabel(ctx, namespace, map[string]string{
+		workerAppLabel:               "worker",
+		"app.kubernetes.io/instance": release,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list worker pods in namespace %s: %w", namespace, err)
+	}
 
-	for _, namespace := range namespaces {
-		// List all pods matching the label in the current namespace
-		pods, err := clientset.CoreV1().Pods(namespace).List(ctx, metav1.ListOptions{
-			LabelSelector: labelSelector,
+	var podFileInfos []*PodFileInfo
+	for _, pod := range pods {
+		podFileInfos = append(podFileInfos, &PodFileInfo{
+			Pod: pod,
 		})
-		if err != nil {
-			errs = append(errs, fmt.Errorf("failed to list worker pods in namespace %s: %w", namespace, err))
-			continue
-		}
-
-		for _, pod := range pods.Items {
-			podFileInfos = append(podFileInfos, &PodFileInfo{
-				Pod: pod,
-			})
-		}
 	}
 
-	return podFileInfos, errors.Join(errs...)
+	return podFileInfos, nil
 }
 
 // listFilesInPodDir lists all files in the specified directory inside the pod across multiple namespaces
-func listFilesInPodDir(ctx context.Context, clientset *kubernetes.Clientset, config *rest.Config, pod *PodFileInfo, cutoffTime *time.Time) error {
+func listFilesInPodDir(ctx context.Context, provider *kubernetes.Provider, pod *PodFileInfo, from *time.Time, to *time.Time) error {
 	nodeName := pod.Pod.Spec.NodeName
 	srcFilePath := filepath.Join("data", nodeName, srcDir)
 
-	cmd := []string{"ls", srcFilePath}
-	req := clientset.CoreV1().RESTClient().Post().
-		Resource("pods").
-		Name(pod.Pod.Name).
-		Namespace(pod.Pod.Namespace).
-		SubResource("exec").
-		Param("container", "sniffer").
-		Param("stdout", "true").
-		Param("stderr", "true").
-		Param("command", cmd[0]).
-		Param("command", cmd[1])
-
-	exec, err := remotecommand.NewSPDYExecutor(config, "POST", req.URL())
-	if err != nil {
-		return err
-	}
-
 	var stdoutBuf bytes.Buffer
-	var stderrBuf bytes.Buffer
-
-	// Execute the command to list files
-	err = exec.StreamWithContext(ctx, remotecommand.StreamOptions{
-		Stdout: &stdoutBuf,
-		Stderr: &stderrBuf,
-	})
-	if err != nil {
+	if err := execInSniffer(ctx, provider, pod, []string{"ls", srcFilePath}, &stdoutBuf); err != nil {
 		return err
 	}
 
-	// Split the output (file names) into a list
-	files := strings.Split(strings.TrimSpace(stdoutBuf.String()), "\n")
+	// Split the output (file names) into a list, an empty dir lists nothing
+	files := strings.Fields(stdoutBuf.String())
 	if len(files) == 0 {
 		// No files were found in the target dir for this pod
 		return nil
 	}
 
+	for _, file := range files {
+		if fileTime, err := parsePcapFileTime(file); err == nil && (pod.OldestFile.IsZero() || fileTime.Before(pod.OldestFile)) {
+			pod.OldestFile = fileTime
+		}
+	}
+
 	var filteredFiles []string
 	var fileProcessingErrs []error
-	// Filter files based on cutoff time if provided
-	for _, file := range files {
-		if cutoffTime != nil {
-			parts := strings.Split(file, "-")
-			if len(parts) < 2 {
-				continue
-			}
+	// Filter files based on the time window if provided
+	if from != nil || to != nil {
+		type timedFile struct {
+			name string
+			time time.Time
+		}
 
-			timestampStr := parts[len(parts)-2] + parts[len(parts)-1][:6] // Extract YYYYMMDDHHMMSS
-			fileTime, err := time.Parse("20060102150405", timestampStr)
+		var timedFiles []timedFile
+		for _, file := range files {
+			fileTime, err := parsePcapFileTime(file)
 			if err != nil {
-				fileProcessingErrs = append(fileProcessingErrs, fmt.Errorf("failed parse file timestamp %s: %w", file, err))
+				fileProcessingErrs = append(fileProcessingErrs, err)
 				continue
 			}
+			timedFiles = append(timedFiles, timedFile{name: file, time: fileTime})
+		}
+		sort.Slice(timedFiles, func(i, j int) bool { return timedFiles[i].time.Before(timedFiles[j].time) })
 
-			if fileTime.Before(*cutoffTime) {
+		// A file holds the packets from its timestamp until the next file starts
+		for i, file := range timedFiles {
+			if to != nil && file.time.After(*to) {
 				continue
 			}
+			if from != nil && i+1 < len(timedFiles) && !timedFiles[i+1].time.After(*from) {
+				continue
+			}
+			filteredFiles = append(filteredFiles, file.name)
 		}
-		// Add file to filtered list
-		filteredFiles = append(filteredFiles, file)
+	} else {
+		filteredFiles = files
 	}
 
 	pod.SrcDir = srcDir
@@ -135,149 +143,55 @@ func listFilesInPodDir(ctx context.Context, clientset *kubernetes.Clientset, con
 	return errors.Join(fileProcessingErrs...)
 }
 
-// copyFileFromPod copies a single file from a pod to a local destination
-func copyFileFromPod(ctx context.Context, clientset *kubernetes.Clientset, config *rest.Config, pod *PodFileInfo, srcFile, destFile string) error {
-	// Construct the complete path using /data, the node name, srcDir, and srcFile
-	nodeName := pod.Pod.Spec.NodeName
-	srcFilePath := filepath.Join("data", nodeName, srcDir, srcFile)
-
-	// Execute the `cat` command to read the file at the srcFilePath
-	cmd := []string{"cat", srcFilePath}
-	req := clientset.CoreV1().RESTClient().Post().
-		Resource("pods").
-		Name(pod.Pod.Name).
-		Namespace(pod.Pod.Namespace).
-		SubResource("exec").
-		Param("container", "sniffer").
-		Param("stdout", "true").
-		Param("stderr", "true").
-		Param("command", cmd[0]).
-		Param("command", cmd[1])
-
-	exec, err := remotecommand.NewSPDYExecutor(config, "POST", req.URL())
-	if err != nil {
-		return fmt.Errorf("failed to initialize executor for pod %s in namespace %s: %w", pod.Pod.Name, pod.Pod.Namespace, err)
+// parsePcapFileTime parses the timestamp worker PCAP file names end with
+func parsePcapFileTime(file string) (time.Time, error) {
+	parts := strings.Split(file, "-")
+	if len(parts) < 2 || len(parts[len(parts)-1]) < 6 {
+		return time.Time{}, fmt.Errorf("failed parse file timestamp %s: unexpected name", file)
 	}
 
-	// Create the local file to write the content to
-	outFile, err := os.Create(destFile)
+	timestampStr := parts[len(parts)-2] + parts[len(parts)-1][:6] // Extract YYYYMMDDHHMMSS
+	fileTime, err := time.Parse("20060102150405", timestampStr)
 	if err != nil {
-		return fmt.Errorf("failed to create destination file: %w", err)
+		return time.Time{}, fmt.Errorf("failed parse file timestamp %s: %w", file, err)
 	}
-	defer outFile.Close()
-
-	// Capture stderr for error logging
-	var stderrBuf bytes.Buffer
 
-	// Stream the file content from the pod to the local file
-	err = exec.StreamWithContext(ctx, remotecommand.StreamOptions{
-		Stdout: outFile,
-		Stderr: &stderrBuf,
-	})
-	if err != nil {
-		return err
-	}
-
-	return nil
+	return fileTime, nil
 }
 
-func mergePCAPs(outputFile string, inputFiles []string) error {
-	// Create the output file
-	f, err := os.Create(outputFile)
+// listTargetWorkerPods lists the worker pods of the release, restricted to
+// the nodes if any
+func listTargetWorkerPods(ctx context.Context, provider *kubernetes.Provider, options pcapDumpOptions) ([]*PodFileInfo, error) {
+	workerPods, err := listWorkerPods(ctx, provider, options.ReleaseNamespace, options.ReleaseName)
 	if err != nil {
-		return fmt.Errorf("failed to create output file: %w", err)
+		return nil, err
 	}
-	defer f.Close()
-
-	bufWriter := bufio.NewWriterSize(f, 4*1024*1024)
-	defer bufWriter.Flush()
-
-	// Create the PCAP writer
-	writer := pcapgo.NewWriter(bufWriter)
-	err = writer.WriteFileHeader(maxSnaplen, 1)
-	if err != nil {
-		return fmt.Errorf("failed to write PCAP file header: %w", err)
+	if len(workerPods) == 0 {
+		return nil, fmt.Errorf("no workers of the %s release found in the namespace %s", options.ReleaseName, options.ReleaseNamespace)
 	}
 
-	var mergingErrs []error
-
-	for _, inputFile := range inputFiles {
-		// Open the input file
-		file, err := os.Open(inputFile)
-		if err != nil {
-			mergingErrs = append(mergingErrs, fmt.Errorf("failed to open %s: %w", inputFile, err))
-			continue
-		}
-
-		fileInfo, err := file.Stat()
-		if err != nil {
-			mergingErrs = append(mergingErrs, fmt.Errorf("failed to stat file %s: %w", inputFile, err))
-			file.Close()
-			continue
-		}
-
-		if fileInfo.Size() == 0 {
-			// Skip empty files
-			log.Debug().Msgf("Skipped empty file: %s", inputFile)
-			file.Close()
-			continue
-		}
-
-		// Create the PCAP reader for the input file
-		reader, err := pcapgo.NewReader(file)
-		if err != nil {
-			mergingErrs = append(mergingErrs, fmt.Errorf("failed to create pcapng reader for %v: %w", file.Name(), err))
-			file.Close()
-			continue
-		}
-
-		for {
-			// Read packet data
-			data, ci, err := reader.ReadPacketData()
-			if err != nil {
-				if errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
-					break
-				}
-				mergingErrs = append(mergingErrs, fmt.Errorf("error reading packet from file %s: %w", file.Name(), err))
-				break
-			}
-
-			// Write the packet to the output file
-			err = writer.WritePacket(ci, data)
-			if err != nil {
-				log.Error().Err(err).Msgf("Error writing packet to output file")
-				mergingErrs = append(mergingErrs, fmt.Errorf("error writing packet to output file: %w", err))
-				break
+	if len(options.Nodes) > 0 {
+		var nodeWorkerPods []*PodFileInfo
+		for _, pod := range workerPods {
+			if slices.Contains(options.Nodes, pod.Pod.Spec.NodeName) {
+				nodeWorkerPods = append(nodeWorkerPods, pod)
 			}
 		}
-
-		file.Close()
+		if len(nodeWorkerPods) == 0 {
+			return nil, fmt.Errorf("no workers run on the nodes %v", options.Nodes)
+		}
+		workerPods = nodeWorkerPods
 	}
 
-	log.Debug().Err(errors.Join(mergingErrs...))
-
-	return nil
+	return workerPods, nil
 }
 
-func copyPcapFiles(clientset *kubernetes.Clientset, config *rest.Config, destDir string, cutoffTime *time.Time) error {
-	// List all namespaces
-	namespaceList, err := clientset.CoreV1().Namespaces().List(context.TODO(), metav1.ListOptions{})
-	if err != nil {
-		return err
-	}
+func copyPcapFiles(provider *kubernetes.Provider, options pcapDumpOptions) error {
+	dumpTime := time.Now()
 
-	var targetNamespaces []string
-	for _, ns := range namespaceList.Items {
-		targetNamespaces = append(targetNamespaces, ns.Name)
-	}
-
-	// List all worker pods
-	workerPods, err := listWorkerPods(context.Background(), clientset, targetNamespaces)
+	workerPods, err := listTargetWorkerPods(context.Background(), provider, options)
 	if err != nil {
-		if len(workerPods) == 0 {
-			return err
-		}
-		log.Debug().Err(err).Msg("error while listing worker pods")
+		return err
 	}
 
 	var wg sync.WaitGroup
@@ -290,22 +204,21 @@ func copyPcapFiles(clientset *kubernetes.Clientset, config *rest.Config, destDir
 			defer wg.Done()
 
 			// List files for the current pod
-			err := listFilesInPodDir(context.Background(), clientset, config, pod, cutoffTime)
+			err := listFilesInPodDir(context.Background(), provider, pod, options.From, options.To)
 			if err != nil {
 				log.Debug().Err(err).Msgf("error listing files in pod %s", pod.Pod.Name)
+				pod.Failures = append(pod.Failures, pcapCopyFailure{Pod: pod.Pod.Name, Node: pod.Pod.Spec.NodeName, Err: err})
 				return
 			}
 
 			// Copy files from the pod
 			for _, file := range pod.Files {
-				destFile := filepath.Join(destDir, file)
+				destFile := filepath.Join(options.DestDir, file)
 
-				// Add a timeout context for file copy
-				ctx, cancel := context.WithTimeout(context.Background(), maxTimePerFile)
-				err := copyFileFromPod(ctx, clientset, config, pod, file, destFile)
-				cancel()
+				err := copyFileFromPod(context.Background(), provider, pod, file, destFile)
 				if err != nil {
 					log.Debug().Err(err).Msgf("error copying file %s from pod %s in namespace %s", file, pod.Pod.Name, pod.Pod.Namespace)
+					pod.Failures = append(pod.Failures, pcapCopyFailure{Pod: pod.Pod.Name, Node: pod.Pod.Spec.NodeName, File: file, Err: err})
 					continue
 				}
 
@@ -317,27 +230,95 @@ func copyPcapFiles(clientset *kubernetes.Clientset, config *rest.Config, destDir
 
 	// Wait for all goroutines to complete
 	wg.Wait()
+	removeStalePcapPartials(options.DestDir, workerPods)
 
 	var copiedFiles []string
+	var inputs []pcapInput
+	var failures []pcapCopyFailure
 	for _, pod := range workerPods {
 		copiedFiles = append(copiedFiles, pod.CopiedFiles...)
+		failures = append(failures, pod.Failures...)
+		for _, file := range pod.CopiedFiles {
+			inputs = append(inputs, pcapInput{Path: file, Pod: &pod.Pod})
+		}
 	}
 
 	if len(copiedFiles) == 0 {
 		log.Info().Msg("No pcaps available to copy on the workers")
-		return nil
+		return logPcapCopySummary(0, failures)
 	}
 
+	clusterID, err := getClusterID(provider)
+	if err != nil {
+		return fmt.Errorf("failed to get cluster ID: %w", err)
+	}
+
+	// An anonymized capture doesn't tell which cluster it comes from
+	namePrefix := clusterID
+	if options.Anonymizer != nil {
+		namePrefix = "anonymized"
+	}
+
+	timestamp := dumpTime.Format("2006-01-02_15-04")
+	finalMergedFile := options.Output
+	if finalMergedFile == "" {
+		finalMergedFile = filepath.Join(options.DestDir, fmt.Sprintf("%s-%s.%s", namePrefix, timestamp, options.Format))
+	}
+	finalMergedFile = strings.TrimSuffix(finalMergedFile, pcapCompressExtensions[options.Compress])
+
 	// Generate a temporary filename for the merged file
 	tempMergedFile := copiedFiles[0] + "_temp"
 
+	// The files of the series are written under temporary names first
+	var tempFiles, finalFiles []string
+	output := newPcapOutput(func(part int) (io.WriteCloser, error) {
+		if options.Output == pcapOutputStdout {
+			return nopWriteCloser{os.Stdout}, nil
+		}
+		finalFile := pcapSeriesFile(finalMergedFile, part, options.SplitSize > 0 || options.SplitTime > 0, options.Compress)
+		tempFile := fmt.Sprintf("%s%d", tempMergedFile, part)
+		tempFiles = append(tempFiles, tempFile)
+		finalFiles = append(finalFiles, finalFile)
+		return os.Create(tempFile)
+	}, options.Compress, options.SplitSize, options.SplitTime)
+	output.anonymizer = options.Anonymizer
+	if options.DedupWindow > 0 {
+		output.dedup = newPcapDeduplicator(options.DedupWindow)
+	}
+
 	// Merge PCAP files
-	err = mergePCAPs(tempMergedFile, copiedFiles)
+	if options.Format == pcapFormatPcapng {
+		metadata := pcapMetadata{
+			ClusterID: clusterID,
+			To:        dumpTime,
+			Release:   workerRelease(&workerPods[0].Pod),
+			Hosts:     options.Hosts,
+		}
+		if options.From != nil {
+			metadata.From = *options.From
+		}
+		if options.To != nil && options.To.Before(dumpTime) {
+			metadata.To = *options.To
+		}
+		if options.Anonymizer != nil {
+			metadata.ClusterID = ""
+			metadata.Hosts = nil
+		}
+		err = mergePCAPNGTo(output, tempMergedFile, inputs, metadata, options.Filter)
+	} else {
+		err = mergePCAPsTo(output, tempMergedFile, copiedFiles, options.Filter)
+	}
 	if err != nil {
-		os.Remove(tempMergedFile)
+		for _, file := range tempFiles {
+			os.Remove(file)
+		}
 		return fmt.Errorf("error merging files: %w", err)
 	}
 
+	if output.dedup != nil {
+		log.Info().Int64("dropped", output.dedup.dropped).Str("window", options.DedupWindow.String()).Msg("Dropped the packets captured on more than one node.")
+	}
+
 	// Remove the original files after merging
 	for _, file := range copiedFiles {
 		if err = os.Remove(file); err != nil {
@@ -345,24 +326,64 @@ func copyPcapFiles(clientset *kubernetes.Clientset, config *rest.Config, destDir
 		}
 	}
 
-	clusterID, err := getClusterID(clientset)
-	if err != nil {
-		return fmt.Errorf("failed to get cluster ID: %w", err)
+	if options.Anonymizer != nil {
+		mappingFile := strings.TrimSuffix(finalMergedFile, filepath.Ext(finalMergedFile)) + ".anonymization.json"
+		if options.Output == pcapOutputStdout {
+			mappingFile = fmt.Sprintf("%s-%s.anonymization.json", namePrefix, timestamp)
+		}
+		if err := options.Anonymizer.writeMapping(mappingFile, options.Hosts); err != nil {
+			log.Warn().Err(err).Msg("Failed writing the anonymization mapping file.")
+		} else {
+			log.Info().Msgf("Anonymization mapping file created: %s (keep it private, it reverses the remapping)", mappingFile)
+		}
 	}
-	timestamp := time.Now().Format("2006-01-02_15-04")
-	// Rename the temp file to the final name
-	finalMergedFile := filepath.Join(destDir, fmt.Sprintf("%s-%s.pcap", clusterID, timestamp))
-	err = os.Rename(tempMergedFile, finalMergedFile)
-	if err != nil {
-		return err
+
+	if options.Output == pcapOutputStdout {
+		log.Info().Msg("Merged capture written to stdout")
+		return logPcapCopySummary(len(copiedFiles), failures)
+	}
+
+	// Rename the temp files to the final names
+	for i, file := range tempFiles {
+		if err = os.Rename(file, finalFiles[i]); err != nil {
+			return err
+		}
+		log.Info().Msgf("Merged file created: %s", finalFiles[i])
+	}
+	// The anonymization mapping stays local
+	uploadFiles := slices.Clone(finalFiles)
+
+	if output.split() || options.Compress != "" {
+		checksumFile := strings.TrimSuffix(finalMergedFile, filepath.Ext(finalMergedFile)) + ".sha256"
+		if err := writeChecksumFile(checksumFile, finalFiles, output.checksums); err != nil {
+			log.Warn().Err(err).Msg("Failed writing the checksum file.")
+		} else {
+			log.Info().Msgf("Checksum file created: %s (verify with sha256sum -c)", checksumFile)
+			uploadFiles = append(uploadFiles, checksumFile)
+		}
+	}
+
+	if len(options.Hosts) > 0 && options.Anonymizer == nil {
+		hostsFile := strings.TrimSuffix(finalMergedFile, filepath.Ext(finalMergedFile)) + ".hosts"
+		if err := writeHostsFile(hostsFile, options.Hosts); err != nil {
+			log.Warn().Err(err).Msg("Failed writing the hosts file.")
+		} else {
+			log.Info().Msgf("Hosts file created: %s (load it in Wireshark to resolve pod IPs)", hostsFile)
+			uploadFiles = append(uploadFiles, hostsFile)
+		}
+	}
+
+	if options.Upload {
+		if err := uploadToCloudStorage(context.Background(), uploadFiles); err != nil {
+			return err
+		}
 	}
 
-	log.Info().Msgf("Merged file created: %s", finalMergedFile)
-	return nil
+	return logPcapCopySummary(len(copiedFiles), failures)
 }
 
-func getClusterID(clientset *kubernetes.Clientset) (string, error) {
-	namespace, err := clientset.CoreV1().Namespaces().Get(context.TODO(), "kube-system", metav1.GetOptions{})
+func getClusterID(provider *kubernetes.Provider) (string, error) {
+	namespace, err := provider.GetClientSet().CoreV1().Namespaces().Get(context.TODO(), "kube-system", metav1.GetOptions{})
 	if err != nil {
 		return "", fmt.Errorf("failed to get kube-system namespace UID: %w", err)
 	}
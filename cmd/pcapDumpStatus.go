@@ -0,0 +1,134 @@
+package cmd
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/kubeshark/kubeshark/config"
+	"github.com/kubeshark/kubeshark/config/configStructs"
+	"github.com/kubeshark/kubeshark/kubernetes"
+	"github.com/spf13/cobra"
+)
+
+var pcapDumpStatusCmd = &cobra.Command{
+	Use:   "status",
+	Short: "Show the PCAP dumping settings and the files kept on every node",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		provider, err := newPcapDumpProvider(cmd)
+		if err != nil {
+			return err
+		}
+
+		nodes, _ := cmd.Flags().GetStringSlice(configStructs.PcapNodes)
+		return printPcapDumpStatus(context.Background(), provider, pcapDumpOptions{
+			ReleaseNamespace: config.Config.Tap.Release.Namespace,
+			ReleaseName:      config.Config.Tap.Release.Name,
+			Nodes:            nodes,
+		})
+	},
+}
+
+// pcapDirStatus is what a worker keeps in its PCAP dump directory
+type pcapDirStatus struct {
+	Files  int
+	Usage  int64
+	Oldest time.Time
+	Newest time.Time
+}
+
+// statPcapDir reads the files and the disk usage of the PCAP dump directory
+// of the worker.
+func statPcapDir(ctx context.Context, provider *kubernetes.Provider, pod *PodFileInfo) (status pcapDirStatus, err error) {
+	if err = listFilesInPodDir(ctx, provider, pod, nil, nil); err != nil {
+		return
+	}
+
+	for _, file := range pod.Files {
+		fileTime, err := parsePcapFileTime(file)
+		if err != nil {
+			continue
+		}
+		status.Files++
+		if status.Oldest.IsZero() || fileTime.Before(status.Oldest) {
+			status.Oldest = fileTime
+		}
+		if fileTime.After(status.Newest) {
+			status.Newest = fileTime
+		}
+	}
+
+	var usageBuf bytes.Buffer
+	dir := filepath.Join("data", pod.Pod.Spec.NodeName, srcDir)
+	if err = execInSniffer(ctx, provider, pod, []string{"du", "-sk", dir}, &usageBuf); err != nil {
+		return
+	}
+	if fields := strings.Fields(usageBuf.String()); len(fields) > 0 {
+		kilobytes, err := strconv.ParseInt(fields[0], 10, 64)
+		if err != nil {
+			return status, fmt.Errorf("unexpected disk usage of %s: %w", dir, err)
+		}
+		status.Usage = kilobytes * 1024
+	}
+
+	return
+}
+
+func printPcapDumpStatus(ctx context.Context, provider *kubernetes.Provider, options pcapDumpOptions) error {
+	workerPods, err := listTargetWorkerPods(ctx, provider, options)
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("Enabled: %s, time interval: %s, max time: %s, max size: %s\n\n",
+		getPcapDumpConfigValue(provider, kubernetes.CONFIG_PCAP_DUMP_ENABLE),
+		getPcapDumpConfigValue(provider, kubernetes.CONFIG_TIME_INTERVAL),
+		getPcapDumpConfigValue(provider, kubernetes.CONFIG_MAX_TIME),
+		getPcapDumpConfigValue(provider, kubernetes.CONFIG_MAX_SIZE),
+	)
+
+	writer := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(writer, "NODE\tWORKER\tFILES\tDISK USAGE\tOLDEST FILE\tRETAINED")
+	for _, pod := range workerPods {
+		status, err := statPcapDir(ctx, provider, pod)
+		if err != nil {
+			fmt.Fprintf(writer, "%s\t%s\t-\t-\t-\t%v\n", pod.Pod.Spec.NodeName, pod.Pod.Name, err)
+			continue
+		}
+
+		oldest, retained := "-", "-"
+		if status.Files > 0 {
+			oldest = status.Oldest.Local().Format(time.DateTime)
+			retained = status.Newest.Sub(status.Oldest).Round(time.Second).String()
+		}
+		fmt.Fprintf(writer, "%s\t%s\t%d\t%s\t%s\t%s\n", pod.Pod.Spec.NodeName, pod.Pod.Name, status.Files, formatByteSize(status.Usage), oldest, retained)
+	}
+
+	return writer.Flush()
+}
+
+// formatByteSize formats sizes the way parseByteSize reads them.
+func formatByteSize(size int64) string {
+	units := []string{"B", "KB", "MB", "GB", "TB"}
+	value := float64(size)
+	unit := 0
+	for value >= 1000 && unit < len(units)-1 {
+		value /= 1000
+		unit++
+	}
+
+	if unit == 0 {
+		return fmt.Sprintf("%d%s", size, units[unit])
+	}
+	return fmt.Sprintf("%.1f%s", value, units[unit])
+}
+
+func init() {
+	pcapDumpCmd.AddCommand(pcapDumpStatusCmd)
+}
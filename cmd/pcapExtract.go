@@ -0,0 +1,655 @@
+package cmd
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/creasty/defaults"
+	"github.com/kubeshark/gopacket"
+	"github.com/kubeshark/gopacket/layers"
+	"github.com/kubeshark/gopacket/pcapgo"
+	"github.com/kubeshark/kubeshark/config"
+	"github.com/kubeshark/kubeshark/config/configStructs"
+	"github.com/kubeshark/kubeshark/kubernetes"
+	"github.com/rs/zerolog/log"
+	"github.com/spf13/cobra"
+	core "k8s.io/api/core/v1"
+	discoveryv1 "k8s.io/api/discovery/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+const (
+	pcapWorkloadPod     = "pod"
+	pcapWorkloadService = "svc"
+	pcapWorkloadNode    = "node"
+
+	// pcapExtractDuplicateWindow drops the copies of packets captured on both
+	// nodes of a conversation, like pcapdump --dedup does by default
+	pcapExtractDuplicateWindow = 200 * time.Millisecond
+)
+
+// pcapWorkloadKinds maps the kinds accepted in front of a name to the kind
+// they stand for
+var pcapWorkloadKinds = map[string]string{
+	"pod":      pcapWorkloadPod,
+	"pods":     pcapWorkloadPod,
+	"po":       pcapWorkloadPod,
+	"svc":      pcapWorkloadService,
+	"service":  pcapWorkloadService,
+	"services": pcapWorkloadService,
+	"node":     pcapWorkloadNode,
+	"nodes":    pcapWorkloadNode,
+	"no":       pcapWorkloadNode,
+}
+
+var pcapExtractCmd = &cobra.Command{
+	Use:   "extract <file>...",
+	Short: "Extract a single conversation out of PCAP files, with its TCP streams in order",
+	Long: `Extract a single conversation out of PCAP files, compressed ones included.
+
+The conversation is either a flow, or the traffic of a pod, optionally only
+the part with a peer. Pods, services and nodes are resolved to their current
+IPs through the cluster, so they must still exist. Services stand for their
+cluster IPs and the IPs of their endpoints.
+
+TCP segments are written in sequence order, with retransmissions and copies
+captured on several nodes left out. Reordered segments keep their timestamps.`,
+	Example: `  kubeshark pcap extract dump.pcapng --flow 10.0.1.5:443-10.0.2.9:51234
+  kubeshark pcap extract dump.pcapng --pod checkout-abc --peer svc/payments --payload-dir payloads`,
+	Args: cobra.MinimumNArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		pcapConfig := config.Config.Pcap
+		if (pcapConfig.Flow == "") == (pcapConfig.Pod == "") {
+			return fmt.Errorf("Set either --%s or --%s", configStructs.FlowPcapName, configStructs.PodPcapName)
+		}
+		if pcapConfig.Peer != "" && pcapConfig.Pod == "" {
+			return fmt.Errorf("--%s requires --%s", configStructs.PeerPcapName, configStructs.PodPcapName)
+		}
+
+		var matcher *pcapFlowMatcher
+		var err error
+		if pcapConfig.Flow != "" {
+			matcher, err = parsePcapFlow(pcapConfig.Flow)
+		} else {
+			matcher, err = resolvePcapConversation(cmd.Context(), pcapConfig.Pod, pcapConfig.Peer)
+		}
+		if err != nil {
+			return err
+		}
+
+		extractor := newPcapExtractor(matcher)
+		for _, path := range args {
+			if err := extractor.addFile(path); err != nil {
+				return err
+			}
+		}
+		if len(extractor.packets) == 0 {
+			return fmt.Errorf("No packets of the conversation were found")
+		}
+
+		packets := extractor.reassemble()
+		if err := extractor.write(pcapConfig.Write, packets); err != nil {
+			return err
+		}
+		if pcapConfig.Payload.Dir != "" {
+			if err := writePcapPayloads(pcapConfig.Payload.Dir, packets); err != nil {
+				return err
+			}
+		}
+
+		log.Info().
+			Int("packets", len(packets)).
+			Int("dropped", len(extractor.packets)-len(packets)).
+			Str("output", pcapConfig.Write).
+			Msg("Extracted the conversation.")
+		return nil
+	},
+}
+
+// pcapFlowEndpoint is a side of a conversation: any of its IPs, or any IP if
+// none, and its port if not 0.
+type pcapFlowEndpoint struct {
+	ips  map[string]struct{}
+	port uint16
+}
+
+func (endpoint pcapFlowEndpoint) match(ip string, port uint16) bool {
+	if endpoint.port != 0 && endpoint.port != port {
+		return false
+	}
+	if len(endpoint.ips) == 0 {
+		return true
+	}
+	_, ok := endpoint.ips[ip]
+	return ok
+}
+
+// pcapFlowMatcher selects the packets between its endpoints, in either
+// direction.
+type pcapFlowMatcher struct {
+	a pcapFlowEndpoint
+	b pcapFlowEndpoint
+}
+
+func (matcher *pcapFlowMatcher) match(src string, srcPort uint16, dst string, dstPort uint16) bool {
+	return (matcher.a.match(src, srcPort) && matcher.b.match(dst, dstPort)) ||
+		(matcher.a.match(dst, dstPort) && matcher.b.match(src, srcPort))
+}
+
+// parsePcapFlow parses a flow such as 10.0.1.5:443-10.0.2.9:51234, IPv6
+// addresses are bracketed.
+func parsePcapFlow(flow string) (*pcapFlowMatcher, error) {
+	a, b, ok := strings.Cut(flow, "-")
+	if !ok {
+		return nil, fmt.Errorf("Invalid flow %s, expected <ip>:<port>-<ip>:<port>", flow)
+	}
+
+	matcher := &pcapFlowMatcher{}
+	for _, side := range []struct {
+		address  string
+		endpoint *pcapFlowEndpoint
+	}{{a, &matcher.a}, {b, &matcher.b}} {
+		host, port, err := net.SplitHostPort(side.address)
+		if err != nil {
+			return nil, fmt.Errorf("Invalid flow %s: %w", flow, err)
+		}
+		ip := net.ParseIP(host)
+		if ip == nil {
+			return nil, fmt.Errorf("Invalid flow %s: %s is not an IP", flow, host)
+		}
+		parsedPort, err := strconv.ParseUint(port, 10, 16)
+		if err != nil {
+			return nil, fmt.Errorf("Invalid flow %s: %s is not a port", flow, port)
+		}
+
+		side.endpoint.ips = map[string]struct{}{ip.String(): {}}
+		side.endpoint.port = uint16(parsedPort)
+	}
+
+	return matcher, nil
+}
+
+// pcapWorkload is a pod, service or node, or an IP.
+type pcapWorkload struct {
+	kind      string
+	namespace string
+	name      string
+	ip        net.IP
+}
+
+func (workload pcapWorkload) String() string {
+	if workload.ip != nil {
+		return workload.ip.String()
+	}
+	if workload.namespace != "" {
+		return fmt.Sprintf("%s/%s/%s", workload.kind, workload.namespace, workload.name)
+	}
+	return fmt.Sprintf("%s/%s", workload.kind, workload.name)
+}
+
+// parsePcapWorkload parses `[pod/|svc/|node/][namespace/]name`, a pod if the
+// kind is left out. Without a namespace, all the namespaces are looked in.
+func parsePcapWorkload(reference string) (pcapWorkload, error) {
+	if ip := net.ParseIP(reference); ip != nil {
+		return pcapWorkload{ip: ip}, nil
+	}
+
+	workload := pcapWorkload{kind: pcapWorkloadPod}
+	parts := strings.Split(reference, "/")
+	if kind, ok := pcapWorkloadKinds[parts[0]]; ok && len(parts) > 1 {
+		workload.kind = kind
+		parts = parts[1:]
+	}
+
+	switch {
+	case len(parts) == 1 && parts[0] != "":
+		workload.name = parts[0]
+	case len(parts) == 2 && parts[0] != "" && parts[1] != "" && workload.kind != pcapWorkloadNode:
+		workload.namespace, workload.name = parts[0], parts[1]
+	default:
+		return workload, fmt.Errorf("Invalid reference %s, expected [pod/|svc/|node/][namespace/]name", reference)
+	}
+
+	return workload, nil
+}
+
+// resolvePcapConversation builds the matcher of the traffic of the pod,
+// only the part with the peer if set.
+func resolvePcapConversation(ctx context.Context, pod string, peer string) (*pcapFlowMatcher, error) {
+	var workloads []pcapWorkload
+	for _, reference := range []string{pod, peer} {
+		if reference == "" {
+			continue
+		}
+		workload, err := parsePcapWorkload(reference)
+		if err != nil {
+			return nil, err
+		}
+		workloads = append(workloads, workload)
+	}
+
+	var provider *kubernetes.Provider
+	matcher := &pcapFlowMatcher{}
+	for i, workload := range workloads {
+		endpoint := &matcher.a
+		if i > 0 {
+			endpoint = &matcher.b
+		}
+
+		if workload.ip != nil {
+			endpoint.ips = map[string]struct{}{workload.ip.String(): {}}
+			continue
+		}
+
+		if provider == nil {
+			var err error
+			if provider, err = getKubernetesProviderForCli(true, true); err != nil {
+				return nil, err
+			}
+		}
+
+		ips, err := resolvePcapWorkload(ctx, provider, workload)
+		if err != nil {
+			return nil, err
+		}
+		if len(ips) == 0 {
+			return nil, fmt.Errorf("%s has no IPs", workload)
+		}
+
+		endpoint.ips = map[string]struct{}{}
+		var resolved []string
+		for _, ip := range ips {
+			endpoint.ips[ip.String()] = struct{}{}
+			resolved = append(resolved, ip.String())
+		}
+		log.Info().Str("workload", workload.String()).Strs("ips", resolved).Msg("Resolved:")
+	}
+
+	return matcher, nil
+}
+
+// resolvePcapWorkload resolves the workload to its current IPs. A service
+// resolves to its cluster IPs and the IPs of its endpoints, as the traffic
+// is captured before and after it's forwarded.
+func resolvePcapWorkload(ctx context.Context, provider *kubernetes.Provider, workload pcapWorkload) ([]net.IP, error) {
+	var ips []net.IP
+	add := func(ip string) {
+		if parsed := net.ParseIP(ip); parsed != nil {
+			ips = append(ips, parsed)
+		}
+	}
+
+	found := false
+	switch workload.kind {
+	case pcapWorkloadPod:
+		regex := regexp.MustCompile(fmt.Sprintf("^%s$", regexp.QuoteMeta(workload.name)))
+		pods, err := provider.ListAllPodsMatchingRegex(ctx, regex, []string{workload.namespace})
+		if err != nil {
+			return nil, err
+		}
+		for _, pod := range pods {
+			found = true
+			for _, podIP := range pod.Status.PodIPs {
+				add(podIP.IP)
+			}
+		}
+	case pcapWorkloadService:
+		services, err := provider.ListAllServices(ctx, []string{workload.namespace})
+		if err != nil {
+			return nil, err
+		}
+		for _, service := range services {
+			if service.Name != workload.name {
+				continue
+			}
+			found = true
+			for _, clusterIP := range service.Spec.ClusterIPs {
+				add(clusterIP)
+			}
+
+			slices, err := provider.GetClientSet().DiscoveryV1().EndpointSlices(service.Namespace).List(ctx, metav1.ListOptions{
+				LabelSelector: fmt.Sprintf("%s=%s", discoveryv1.LabelServiceName, service.Name),
+			})
+			if err != nil {
+				return nil, err
+			}
+			for _, slice := range slices.Items {
+				for _, endpoint := range slice.Endpoints {
+					for _, address := range endpoint.Addresses {
+						add(address)
+					}
+				}
+			}
+		}
+	case pcapWorkloadNode:
+		nodes, err := provider.ListNodes(ctx)
+		if err != nil {
+			return nil, err
+		}
+		for _, node := range nodes {
+			if node.Name != workload.name {
+				continue
+			}
+			found = true
+			for _, address := range node.Status.Addresses {
+				if address.Type == core.NodeInternalIP || address.Type == core.NodeExternalIP {
+					add(address.Address)
+				}
+			}
+		}
+	}
+
+	if !found {
+		return nil, fmt.Errorf("%s was not found", workload)
+	}
+
+	return ips, nil
+}
+
+// pcapExtractPacket is a packet of the conversation. TCP and UDP packets are
+// keyed by their direction.
+type pcapExtractPacket struct {
+	ci   gopacket.CaptureInfo
+	data []byte
+
+	direction string
+	tcp       bool
+	seq       uint32
+	seqLength uint32
+	// payloadSeq is the sequence number of the first payload byte
+	payloadSeq uint32
+	payload    []byte
+	// newPayload is the part of the payload the direction hadn't carried yet
+	newPayload []byte
+}
+
+// pcapTCPDirection tracks a direction of a TCP connection while reordering.
+type pcapTCPDirection struct {
+	started bool
+	next    uint32
+	pending []*pcapExtractPacket
+}
+
+// pcapExtractor collects the packets of a conversation out of capture
+// files.
+type pcapExtractor struct {
+	matcher  *pcapFlowMatcher
+	dedup    *pcapDeduplicator
+	linkType layers.LinkType
+	nanos    bool
+	files    int
+	packets  []*pcapExtractPacket
+}
+
+func newPcapExtractor(matcher *pcapFlowMatcher) *pcapExtractor {
+	return &pcapExtractor{matcher: matcher, dedup: newPcapDeduplicator(pcapExtractDuplicateWindow)}
+}
+
+// addFile collects the packets of the file. Files with a different link type
+// than the first one can't be represented and are skipped.
+func (extractor *pcapExtractor) addFile(path string) error {
+	reader, closer, err := openPcapFile(path)
+	if err != nil {
+		return err
+	}
+	defer closer.Close()
+
+	if extractor.files == 0 {
+		extractor.linkType = reader.LinkType()
+	} else if reader.LinkType() != extractor.linkType {
+		log.Warn().Str("file", path).Msgf("Skipped, link type %s differs from %s.", reader.LinkType(), extractor.linkType)
+		return nil
+	}
+	extractor.files++
+	extractor.nanos = extractor.nanos || reader.Resolution() == gopacket.TimestampResolutionNanosecond
+
+	for {
+		data, ci, err := reader.ReadPacketData()
+		if errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("error reading packet from file %s: %w", path, err)
+		}
+
+		extractor.add(ci, data)
+	}
+}
+
+// add keeps the packet if it belongs to the conversation.
+func (extractor *pcapExtractor) add(ci gopacket.CaptureInfo, data []byte) {
+	packet := gopacket.NewPacket(data, extractor.linkType, gopacket.DecodeOptions{Lazy: true, NoCopy: true}, gopacket.UnknownCgroupID, 0)
+	network := packet.NetworkLayer()
+	if network == nil {
+		return
+	}
+	srcEndpoint, dstEndpoint := network.NetworkFlow().Endpoints()
+	src, dst := net.IP(srcEndpoint.Raw()).String(), net.IP(dstEndpoint.Raw()).String()
+
+	extracted := &pcapExtractPacket{ci: ci, data: data}
+	var srcPort, dstPort uint16
+	switch transport := packet.TransportLayer().(type) {
+	case *layers.TCP:
+		srcPort, dstPort = uint16(transport.SrcPort), uint16(transport.DstPort)
+		extracted.tcp = true
+		extracted.seq = transport.Seq
+		extracted.payloadSeq = transport.Seq
+		extracted.payload = transport.Payload
+		extracted.seqLength = uint32(len(transport.Payload))
+		if transport.SYN {
+			extracted.seqLength++
+			extracted.payloadSeq++
+		}
+		if transport.FIN {
+			extracted.seqLength++
+		}
+	case *layers.UDP:
+		srcPort, dstPort = uint16(transport.SrcPort), uint16(transport.DstPort)
+		extracted.payload = transport.Payload
+	}
+	if !extractor.matcher.match(src, srcPort, dst, dstPort) {
+		return
+	}
+
+	if srcPort != 0 || dstPort != 0 {
+		protocol := "udp"
+		if extracted.tcp {
+			protocol = "tcp"
+		}
+		extracted.direction = fmt.Sprintf("%s %s-%s", protocol, net.JoinHostPort(src, strconv.Itoa(int(srcPort))), net.JoinHostPort(dst, strconv.Itoa(int(dstPort))))
+	}
+
+	extractor.packets = append(extractor.packets, extracted)
+}
+
+// reassemble drops the copies and retransmissions, and puts the segments of
+// every TCP direction in sequence order. A segment following a gap is held
+// until the gap is filled, segments still held at the end follow the rest in
+// sequence order, as the capture missed the ones filling their gap.
+func (extractor *pcapExtractor) reassemble() []*pcapExtractPacket {
+	sort.SliceStable(extractor.packets, func(i, j int) bool {
+		return extractor.packets[i].ci.Timestamp.Before(extractor.packets[j].ci.Timestamp)
+	})
+
+	var reassembled []*pcapExtractPacket
+	accept := func(direction *pcapTCPDirection, packet *pcapExtractPacket) {
+		end := packet.seq + packet.seqLength
+		if int32(end-direction.next) <= 0 {
+			return
+		}
+
+		skip := int(int32(direction.next - packet.payloadSeq))
+		skip = min(max(skip, 0), len(packet.payload))
+		packet.newPayload = packet.payload[skip:]
+		direction.next = end
+		reassembled = append(reassembled, packet)
+	}
+	flush := func(direction *pcapTCPDirection) {
+		sort.SliceStable(direction.pending, func(i, j int) bool {
+			return int32(direction.pending[i].seq-direction.pending[j].seq) < 0
+		})
+		for len(direction.pending) > 0 && int32(direction.pending[0].seq-direction.next) <= 0 {
+			accept(direction, direction.pending[0])
+			direction.pending = direction.pending[1:]
+		}
+	}
+
+	directions := map[string]*pcapTCPDirection{}
+	var order []string
+	for _, packet := range extractor.packets {
+		if extractor.dedup.duplicate(extractor.linkType, packet.ci, packet.data) {
+			continue
+		}
+		if !packet.tcp || packet.seqLength == 0 {
+			packet.newPayload = packet.payload
+			reassembled = append(reassembled, packet)
+			continue
+		}
+
+		direction, ok := directions[packet.direction]
+		if !ok {
+			direction = &pcapTCPDirection{}
+			directions[packet.direction] = direction
+			order = append(order, packet.direction)
+		}
+		if !direction.started {
+			direction.started = true
+			direction.next = packet.seq
+		}
+
+		if int32(packet.seq-direction.next) > 0 {
+			direction.pending = append(direction.pending, packet)
+			continue
+		}
+		accept(direction, packet)
+		flush(direction)
+	}
+
+	for _, key := range order {
+		direction := directions[key]
+		for {
+			flush(direction)
+			if len(direction.pending) == 0 {
+				break
+			}
+			log.Warn().Str("direction", key).Uint32("from", direction.next).Uint32("to", direction.pending[0].seq).Msg("Segments are missing from the capture.")
+			direction.next = direction.pending[0].seq
+		}
+	}
+
+	return reassembled
+}
+
+// write writes the packets to a classic pcap file, or to stdout with "-".
+func (extractor *pcapExtractor) write(path string, packets []*pcapExtractPacket) error {
+	output := newPcapOutput(func(part int) (io.WriteCloser, error) {
+		if path == pcapOutputStdout {
+			return nopWriteCloser{os.Stdout}, nil
+		}
+		return os.Create(path)
+	}, "", 0, 0)
+
+	err := output.start(func(w io.Writer) (pcapPacketWriter, error) {
+		writer := pcapgo.NewWriter(w)
+		if extractor.nanos {
+			writer = pcapgo.NewWriterNanos(w)
+		}
+		if err := writer.WriteFileHeader(maxSnaplen, extractor.linkType); err != nil {
+			return nil, fmt.Errorf("failed to write PCAP file header: %w", err)
+		}
+		return pcapWriter{writer}, nil
+	})
+	if err != nil {
+		return err
+	}
+
+	for _, packet := range packets {
+		if err := output.WritePacket(extractor.linkType, packet.ci, packet.data); err != nil {
+			output.close()
+			return fmt.Errorf("error writing packet to output file: %w", err)
+		}
+	}
+
+	return output.close()
+}
+
+// pcapPayloadFile names the payload file of a direction, IPv6 colons are
+// replaced as they aren't valid in file names everywhere.
+func pcapPayloadFile(direction string) string {
+	return strings.NewReplacer(" ", "-", ":", "_", "[", "", "]", "").Replace(direction) + ".bin"
+}
+
+// writePcapPayloads writes the payload of every TCP and UDP direction to its
+// own file in the directory, in stream order.
+func writePcapPayloads(dir string, packets []*pcapExtractPacket) error {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+
+	type payloadFile struct {
+		file   *os.File
+		writer *bufio.Writer
+		size   int64
+	}
+	files := map[string]*payloadFile{}
+	var order []string
+	var errs []error
+	for _, packet := range packets {
+		if packet.direction == "" || len(packet.newPayload) == 0 {
+			continue
+		}
+
+		file, ok := files[packet.direction]
+		if !ok {
+			f, err := os.Create(filepath.Join(dir, pcapPayloadFile(packet.direction)))
+			if err != nil {
+				errs = append(errs, err)
+				break
+			}
+			file = &payloadFile{file: f, writer: bufio.NewWriter(f)}
+			files[packet.direction] = file
+			order = append(order, packet.direction)
+		}
+
+		n, err := file.writer.Write(packet.newPayload)
+		file.size += int64(n)
+		if err != nil {
+			errs = append(errs, err)
+			break
+		}
+	}
+
+	for _, direction := range order {
+		file := files[direction]
+		errs = append(errs, file.writer.Flush(), file.file.Close())
+		log.Info().Str("direction", direction).Str("file", file.file.Name()).Int64("size", file.size).Msg("Wrote the payload.")
+	}
+
+	return errors.Join(errs...)
+}
+
+func init() {
+	pcapCmd.AddCommand(pcapExtractCmd)
+
+	defaultPcapConfig := configStructs.PcapConfig{}
+	if err := defaults.Set(&defaultPcapConfig); err != nil {
+		log.Debug().Err(err).Send()
+	}
+
+	pcapExtractCmd.Flags().String(configStructs.FlowPcapName, defaultPcapConfig.Flow, "Flow to extract, in either direction (e.g. 10.0.1.5:443-10.0.2.9:51234)")
+	pcapExtractCmd.Flags().String(configStructs.PodPcapName, defaultPcapConfig.Pod, "Pod whose traffic is extracted, as [namespace/]name (svc/ and node/ select a service or a node instead)")
+	pcapExtractCmd.Flags().String(configStructs.PeerPcapName, defaultPcapConfig.Peer, "With --pod, extract only the traffic with the peer: an IP, or [pod/|svc/|node/][namespace/]name")
+	pcapExtractCmd.Flags().StringP(configStructs.WritePcapName, "w", defaultPcapConfig.Write, "Write the conversation to the file, or to stdout with \"-\"")
+	pcapExtractCmd.Flags().String(configStructs.PayloadDirPcapName, defaultPcapConfig.Payload.Dir, "Also write the payload of every direction to its own file in the directory")
+}
@@ -0,0 +1,115 @@
+package cmd
+
+import (
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/kubeshark/gopacket"
+	"github.com/kubeshark/gopacket/layers"
+)
+
+func TestParsePcapFlow(t *testing.T) {
+	matcher, err := parsePcapFlow("10.0.1.5:443-[fd00::9]:51234")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !matcher.match("fd00::9", 51234, "10.0.1.5", 443) {
+		t.Error("expected the reverse direction to match")
+	}
+	if matcher.match("10.0.1.5", 443, "fd00::9", 51235) {
+		t.Error("expected another port not to match")
+	}
+
+	for _, flow := range []string{"10.0.1.5:443", "10.0.1.5-10.0.2.9:80", "pod:443-10.0.2.9:80", "10.0.1.5:https-10.0.2.9:80"} {
+		if _, err := parsePcapFlow(flow); err == nil {
+			t.Errorf("expected %s to be invalid", flow)
+		}
+	}
+}
+
+func TestParsePcapWorkload(t *testing.T) {
+	tests := []struct {
+		reference string
+		expected  string
+	}{
+		{"checkout-abc", "pod/checkout-abc"},
+		{"shop/checkout-abc", "pod/shop/checkout-abc"},
+		{"svc/payments", "svc/payments"},
+		{"service/shop/payments", "svc/shop/payments"},
+		{"node/worker-1", "node/worker-1"},
+		{"10.0.2.9", "10.0.2.9"},
+	}
+	for _, test := range tests {
+		workload, err := parsePcapWorkload(test.reference)
+		if err != nil {
+			t.Errorf("%s: %v", test.reference, err)
+		} else if workload.String() != test.expected {
+			t.Errorf("%s - expected: %s, actual: %s", test.reference, test.expected, workload)
+		}
+	}
+
+	for _, reference := range []string{"", "svc/", "node/ns/worker-1", "a/b/c"} {
+		if _, err := parsePcapWorkload(reference); err == nil {
+			t.Errorf("expected %q to be invalid", reference)
+		}
+	}
+}
+
+func TestPcapExtractorReassembles(t *testing.T) {
+	base := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	client, server, other := net.ParseIP("10.0.2.9"), net.ParseIP("10.0.1.5"), net.ParseIP("10.0.3.3")
+	matcher, err := parsePcapFlow("10.0.1.5:443-10.0.2.9:51234")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	extractor := newPcapExtractor(matcher)
+	extractor.linkType = layers.LinkTypeEthernet
+	var id uint16
+	add := func(src net.IP, dst net.IP, tcp *layers.TCP, payload string) {
+		id++
+		data := newTestTCPSegment(t, src, dst, tcp, []byte(payload))
+		data[18], data[19] = byte(id>>8), byte(id) // Keeps retransmissions apart from copies
+		ci := gopacket.CaptureInfo{Timestamp: base.Add(time.Duration(id) * time.Millisecond), CaptureLength: len(data), Length: len(data)}
+		extractor.add(ci, data)
+	}
+
+	add(client, server, &layers.TCP{SrcPort: 51234, DstPort: 443, Seq: 100, SYN: true}, "")
+	add(server, client, &layers.TCP{SrcPort: 443, DstPort: 51234, Seq: 500, SYN: true, ACK: true, Ack: 101}, "")
+	add(client, server, &layers.TCP{SrcPort: 51234, DstPort: 443, Seq: 106, ACK: true, Ack: 501}, "world") // Ahead of a gap
+	add(client, other, &layers.TCP{SrcPort: 51234, DstPort: 443, Seq: 1, ACK: true}, "other")
+	add(client, server, &layers.TCP{SrcPort: 51234, DstPort: 443, Seq: 101, ACK: true, Ack: 501}, "hello")
+	add(client, server, &layers.TCP{SrcPort: 51234, DstPort: 443, Seq: 101, ACK: true, Ack: 501}, "hello") // Retransmitted
+	add(server, client, &layers.TCP{SrcPort: 443, DstPort: 51234, Seq: 501, ACK: true, Ack: 111}, "ok")
+
+	if len(extractor.packets) != 6 {
+		t.Fatalf("unexpected matched packets - expected: 6, actual: %d", len(extractor.packets))
+	}
+
+	packets := extractor.reassemble()
+	var payloads []string
+	for _, packet := range packets {
+		payloads = append(payloads, string(packet.newPayload))
+	}
+	expected := []string{"", "", "hello", "world", "ok"}
+	if len(payloads) != len(expected) {
+		t.Fatalf("unexpected payloads - expected: %q, actual: %q", expected, payloads)
+	}
+	for i := range expected {
+		if payloads[i] != expected[i] {
+			t.Fatalf("unexpected payloads - expected: %q, actual: %q", expected, payloads)
+		}
+	}
+
+	dir := t.TempDir()
+	if err := writePcapPayloads(dir, packets); err != nil {
+		t.Fatal(err)
+	}
+	request, err := os.ReadFile(filepath.Join(dir, "tcp-10.0.2.9_51234-10.0.1.5_443.bin"))
+	if err != nil || string(request) != "helloworld" {
+		t.Errorf("unexpected request payload - %q, %v", request, err)
+	}
+}
@@ -0,0 +1,437 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/kubeshark/gopacket"
+	"github.com/kubeshark/gopacket/layers"
+	"github.com/kubeshark/kubeshark/kubernetes"
+)
+
+// pcapFilter selects the packets that are kept while merging. A nil filter
+// keeps everything.
+type pcapFilter struct {
+	bpf  bpfNode
+	ips  map[string]struct{}
+	from *time.Time
+	to   *time.Time
+}
+
+// newPcapFilter builds the filter out of a BPF expression and the pods
+// matching the regex in the namespaces, which are resolved to their IPs.
+func newPcapFilter(ctx context.Context, provider *kubernetes.Provider, bpf string, podRegex string, namespaces []string) (*pcapFilter, error) {
+	if bpf == "" && podRegex == "" && len(namespaces) == 0 {
+		return nil, nil
+	}
+
+	filter := &pcapFilter{}
+	if bpf != "" {
+		node, err := parseBpf(bpf)
+		if err != nil {
+			return nil, fmt.Errorf("invalid BPF expression %q: %w", bpf, err)
+		}
+		filter.bpf = node
+	}
+
+	if podRegex != "" || len(namespaces) > 0 {
+		regex, err := regexp.Compile(podRegex)
+		if err != nil {
+			return nil, fmt.Errorf("invalid pod regex %q: %w", podRegex, err)
+		}
+
+		if len(namespaces) == 0 {
+			namespaces = []string{""}
+		}
+
+		pods, err := provider.ListAllPodsMatchingRegex(ctx, regex, namespaces)
+		if err != nil {
+			return nil, err
+		}
+
+		filter.ips = map[string]struct{}{}
+		for _, pod := range pods {
+			for _, podIP := range pod.Status.PodIPs {
+				if ip := net.ParseIP(podIP.IP); ip != nil {
+					filter.ips[ip.String()] = struct{}{}
+				}
+			}
+		}
+
+		if len(filter.ips) == 0 {
+			return nil, fmt.Errorf("no pods with an IP match the pod regex %q in the namespaces %v", podRegex, namespaces)
+		}
+	}
+
+	return filter, nil
+}
+
+// withWindow returns the filter restricted to the packets captured within
+// the time window, either bound being optional.
+func (filter *pcapFilter) withWindow(from *time.Time, to *time.Time) *pcapFilter {
+	if from == nil && to == nil {
+		return filter
+	}
+
+	windowed := &pcapFilter{}
+	if filter != nil {
+		*windowed = *filter
+	}
+	windowed.from, windowed.to = from, to
+
+	return windowed
+}
+
+func (filter *pcapFilter) match(linkType layers.LinkType, ci gopacket.CaptureInfo, data []byte) bool {
+	if filter == nil {
+		return true
+	}
+
+	if filter.from != nil && ci.Timestamp.Before(*filter.from) {
+		return false
+	}
+	if filter.to != nil && ci.Timestamp.After(*filter.to) {
+		return false
+	}
+	if filter.bpf == nil && filter.ips == nil {
+		return true
+	}
+
+	packet := newBpfPacket(linkType, data)
+	if filter.ips != nil {
+		_, srcMatch := filter.ips[packet.src.String()]
+		_, dstMatch := filter.ips[packet.dst.String()]
+		if (packet.src == nil || !srcMatch) && (packet.dst == nil || !dstMatch) {
+			return false
+		}
+	}
+
+	return filter.bpf == nil || filter.bpf.match(packet)
+}
+
+// bpfPacket holds the fields of a packet BPF expressions test.
+type bpfPacket struct {
+	length   int
+	protos   map[string]bool
+	src      net.IP
+	dst      net.IP
+	hasPorts bool
+	srcPort  uint16
+	dstPort  uint16
+}
+
+func newBpfPacket(linkType layers.LinkType, data []byte) *bpfPacket {
+	packet := &bpfPacket{length: len(data), protos: map[string]bool{}}
+	decoded := gopacket.NewPacket(data, linkType, gopacket.DecodeOptions{Lazy: true, NoCopy: true}, gopacket.UnknownCgroupID, 0)
+
+	for _, layer := range decoded.Layers() {
+		switch l := layer.(type) {
+		case *layers.IPv4:
+			packet.protos["ip"] = true
+			if packet.src == nil {
+				packet.src, packet.dst = l.SrcIP, l.DstIP
+			}
+		case *layers.IPv6:
+			packet.protos["ip6"] = true
+			if packet.src == nil {
+				packet.src, packet.dst = l.SrcIP, l.DstIP
+			}
+		case *layers.ARP:
+			packet.protos["arp"] = true
+		case *layers.ICMPv4:
+			packet.protos["icmp"] = true
+		case *layers.ICMPv6:
+			packet.protos["icmp6"] = true
+		case *layers.TCP:
+			packet.protos["tcp"] = true
+			packet.setPorts(uint16(l.SrcPort), uint16(l.DstPort))
+		case *layers.UDP:
+			packet.protos["udp"] = true
+			packet.setPorts(uint16(l.SrcPort), uint16(l.DstPort))
+		case *layers.SCTP:
+			packet.protos["sctp"] = true
+			packet.setPorts(uint16(l.SrcPort), uint16(l.DstPort))
+		}
+	}
+
+	return packet
+}
+
+func (packet *bpfPacket) setPorts(src uint16, dst uint16) {
+	if !packet.hasPorts {
+		packet.hasPorts = true
+		packet.srcPort, packet.dstPort = src, dst
+	}
+}
+
+type bpfNode interface {
+	match(packet *bpfPacket) bool
+}
+
+type bpfAnd struct{ left, right bpfNode }
+type bpfOr struct{ left, right bpfNode }
+type bpfNot struct{ node bpfNode }
+
+func (n bpfAnd) match(packet *bpfPacket) bool { return n.left.match(packet) && n.right.match(packet) }
+func (n bpfOr) match(packet *bpfPacket) bool  { return n.left.match(packet) || n.right.match(packet) }
+func (n bpfNot) match(packet *bpfPacket) bool { return !n.node.match(packet) }
+
+// bpfPrimitive is a single test such as `tcp`, `src host 10.0.0.1` or
+// `udp dst portrange 53-60`.
+type bpfPrimitive struct {
+	proto    string
+	dir      string
+	kind     string
+	network  *net.IPNet
+	portFrom uint16
+	portTo   uint16
+	length   int
+}
+
+func (p bpfPrimitive) match(packet *bpfPacket) bool {
+	if p.proto != "" && !packet.protos[p.proto] {
+		return false
+	}
+
+	switch p.kind {
+	case "host", "net":
+		return p.matchDir(packet.src != nil && p.network.Contains(packet.src), packet.dst != nil && p.network.Contains(packet.dst))
+	case "port", "portrange":
+		if !packet.hasPorts {
+			return false
+		}
+		inRange := func(port uint16) bool { return port >= p.portFrom && port <= p.portTo }
+		return p.matchDir(inRange(packet.srcPort), inRange(packet.dstPort))
+	case "greater":
+		return packet.length >= p.length
+	case "less":
+		return packet.length <= p.length
+	}
+
+	return true
+}
+
+func (p bpfPrimitive) matchDir(src bool, dst bool) bool {
+	switch p.dir {
+	case "src":
+		return src
+	case "dst":
+		return dst
+	default:
+		return src || dst
+	}
+}
+
+var (
+	bpfProtos = map[string]bool{"ip": true, "ip6": true, "arp": true, "icmp": true, "icmp6": true, "tcp": true, "udp": true, "sctp": true}
+	bpfDirs   = map[string]bool{"src": true, "dst": true}
+	bpfKinds  = map[string]bool{"host": true, "net": true, "port": true, "portrange": true}
+)
+
+// bpfParser parses the commonly used subset of the pcap-filter syntax:
+// host, net, port and portrange primitives qualified by protocol and
+// direction, protocol primitives, greater and less, combined with and, or,
+// not and parentheses. Like pcap, a bare value repeats the qualifiers of the
+// previous primitive, e.g. `port 80 or 443`.
+type bpfParser struct {
+	tokens []string
+	pos    int
+	last   *bpfPrimitive
+}
+
+func parseBpf(expression string) (bpfNode, error) {
+	parser := &bpfParser{tokens: tokenizeBpf(expression)}
+	if len(parser.tokens) == 0 {
+		return nil, fmt.Errorf("empty expression")
+	}
+
+	node, err := parser.parseOr()
+	if err != nil {
+		return nil, err
+	}
+
+	if parser.pos < len(parser.tokens) {
+		return nil, fmt.Errorf("unexpected %q", parser.tokens[parser.pos])
+	}
+
+	return node, nil
+}
+
+func tokenizeBpf(expression string) (tokens []string) {
+	for _, operator := range []string{"(", ")", "&&", "||"} {
+		expression = strings.ReplaceAll(expression, operator, " "+operator+" ")
+	}
+	expression = regexp.MustCompile(`!([^=]|$)`).ReplaceAllString(expression, " ! $1")
+
+	return strings.Fields(expression)
+}
+
+func (parser *bpfParser) peek() string {
+	if parser.pos < len(parser.tokens) {
+		return parser.tokens[parser.pos]
+	}
+	return ""
+}
+
+func (parser *bpfParser) next() string {
+	token := parser.peek()
+	parser.pos++
+	return token
+}
+
+func (parser *bpfParser) parseOr() (bpfNode, error) {
+	left, err := parser.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+
+	for parser.peek() == "or" || parser.peek() == "||" {
+		parser.next()
+		right, err := parser.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		left = bpfOr{left, right}
+	}
+
+	return left, nil
+}
+
+func (parser *bpfParser) parseAnd() (bpfNode, error) {
+	left, err := parser.parseNot()
+	if err != nil {
+		return nil, err
+	}
+
+	for parser.peek() == "and" || parser.peek() == "&&" {
+		parser.next()
+		right, err := parser.parseNot()
+		if err != nil {
+			return nil, err
+		}
+		left = bpfAnd{left, right}
+	}
+
+	return left, nil
+}
+
+func (parser *bpfParser) parseNot() (bpfNode, error) {
+	switch parser.peek() {
+	case "not", "!":
+		parser.next()
+		node, err := parser.parseNot()
+		if err != nil {
+			return nil, err
+		}
+		return bpfNot{node}, nil
+	case "(":
+		parser.next()
+		node, err := parser.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		if parser.next() != ")" {
+			return nil, fmt.Errorf("missing )")
+		}
+		return node, nil
+	}
+
+	return parser.parsePrimitive()
+}
+
+func (parser *bpfParser) parsePrimitive() (bpfNode, error) {
+	token := parser.next()
+	if token == "" {
+		return nil, fmt.Errorf("unexpected end of expression")
+	}
+
+	if token == "greater" || token == "less" {
+		length, err := strconv.Atoi(parser.next())
+		if err != nil {
+			return nil, fmt.Errorf("%s expects a length", token)
+		}
+		return bpfPrimitive{kind: token, length: length}, nil
+	}
+
+	primitive := bpfPrimitive{}
+	qualified := false
+	if bpfProtos[token] {
+		primitive.proto = token
+		qualified = true
+		token = parser.peek()
+		if !bpfDirs[token] && !bpfKinds[token] {
+			return primitive, nil
+		}
+		parser.next()
+	}
+	if bpfDirs[token] {
+		primitive.dir = token
+		qualified = true
+		token = parser.next()
+		if !bpfKinds[token] {
+			// `src 10.0.0.1` is short for `src host 10.0.0.1`
+			parser.pos--
+			token = "host"
+		}
+	}
+	if bpfKinds[token] {
+		primitive.kind = token
+		token = parser.next()
+	} else if !qualified {
+		if parser.last == nil {
+			return nil, fmt.Errorf("unexpected %q", token)
+		}
+		primitive = *parser.last
+	} else {
+		return nil, fmt.Errorf("unexpected %q", token)
+	}
+
+	if err := primitive.setValue(token); err != nil {
+		return nil, err
+	}
+
+	parser.last = &primitive
+	return primitive, nil
+}
+
+func (p *bpfPrimitive) setValue(value string) error {
+	switch p.kind {
+	case "host":
+		ip := net.ParseIP(value)
+		if ip == nil {
+			return fmt.Errorf("host expects an IP address, got %q", value)
+		}
+		bits := 8 * len(ip.To16())
+		if ip.To4() != nil {
+			ip, bits = ip.To4(), 32
+		}
+		p.network = &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)}
+	case "net":
+		_, network, err := net.ParseCIDR(value)
+		if err != nil {
+			return fmt.Errorf("net expects a CIDR, got %q", value)
+		}
+		p.network = network
+	case "port":
+		port, err := strconv.ParseUint(value, 10, 16)
+		if err != nil {
+			return fmt.Errorf("port expects a number, got %q", value)
+		}
+		p.portFrom, p.portTo = uint16(port), uint16(port)
+	case "portrange":
+		from, to, ok := strings.Cut(value, "-")
+		fromPort, fromErr := strconv.ParseUint(from, 10, 16)
+		toPort, toErr := strconv.ParseUint(to, 10, 16)
+		if !ok || fromErr != nil || toErr != nil || fromPort > toPort {
+			return fmt.Errorf("portrange expects a range such as 8000-8080, got %q", value)
+		}
+		p.portFrom, p.portTo = uint16(fromPort), uint16(toPort)
+	}
+
+	return nil
+}
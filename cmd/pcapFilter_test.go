@@ -0,0 +1,112 @@
+package cmd
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	"github.com/kubeshark/gopacket"
+	"github.com/kubeshark/gopacket/layers"
+	"github.com/kubeshark/kubeshark/config"
+)
+
+func serializeTestPacket(t *testing.T, src string, dst string, transport gopacket.SerializableLayer) []byte {
+	t.Helper()
+
+	ip := &layers.IPv4{Version: 4, TTL: 64, SrcIP: net.ParseIP(src), DstIP: net.ParseIP(dst)}
+	switch l := transport.(type) {
+	case *layers.TCP:
+		ip.Protocol = layers.IPProtocolTCP
+		_ = l.SetNetworkLayerForChecksum(ip)
+	case *layers.UDP:
+		ip.Protocol = layers.IPProtocolUDP
+		_ = l.SetNetworkLayerForChecksum(ip)
+	}
+
+	buf := gopacket.NewSerializeBuffer()
+	err := gopacket.SerializeLayers(buf, gopacket.SerializeOptions{FixLengths: true, ComputeChecksums: true},
+		&layers.Ethernet{SrcMAC: net.HardwareAddr{0, 0, 0, 0, 0, 1}, DstMAC: net.HardwareAddr{0, 0, 0, 0, 0, 2}, EthernetType: layers.EthernetTypeIPv4},
+		ip, transport, gopacket.Payload("payload"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return buf.Bytes()
+}
+
+func TestPcapFilterBpf(t *testing.T) {
+	postgres := serializeTestPacket(t, "10.0.0.1", "10.0.1.5", &layers.TCP{SrcPort: 40000, DstPort: 5432})
+	dns := serializeTestPacket(t, "10.0.0.1", "10.96.0.10", &layers.UDP{SrcPort: 40001, DstPort: 53})
+
+	tests := []struct {
+		expression string
+		postgres   bool
+		dns        bool
+	}{
+		{"tcp port 5432", true, false},
+		{"udp", false, true},
+		{"port 53 or 5432", true, true},
+		{"src host 10.0.0.1 and not udp", true, false},
+		{"dst net 10.96.0.0/12", false, true},
+		{"tcp dst portrange 5000-6000", true, false},
+		{"!(tcp || udp)", false, false},
+		{"ip and (src port 40000 or dst host 10.96.0.10)", true, true},
+	}
+
+	for _, test := range tests {
+		bpf, err := parseBpf(test.expression)
+		if err != nil {
+			t.Fatalf("unexpected error for %q - err: %v", test.expression, err)
+		}
+
+		filter := &pcapFilter{bpf: bpf}
+		if actual := filter.match(layers.LinkTypeEthernet, gopacket.CaptureInfo{}, postgres); actual != test.postgres {
+			t.Errorf("unexpected match of the postgres packet for %q - expected: %v, actual: %v", test.expression, test.postgres, actual)
+		}
+		if actual := filter.match(layers.LinkTypeEthernet, gopacket.CaptureInfo{}, dns); actual != test.dns {
+			t.Errorf("unexpected match of the dns packet for %q - expected: %v, actual: %v", test.expression, test.dns, actual)
+		}
+	}
+
+	for _, expression := range []string{"", "port", "host example.com", "tcp port 80 and", "(udp", "portrange 10"} {
+		if _, err := parseBpf(expression); err == nil {
+			t.Errorf("expected an error for %q", expression)
+		}
+	}
+
+	podFilter := &pcapFilter{ips: map[string]struct{}{"10.96.0.10": {}}}
+	if podFilter.match(layers.LinkTypeEthernet, gopacket.CaptureInfo{}, postgres) || !podFilter.match(layers.LinkTypeEthernet, gopacket.CaptureInfo{}, dns) {
+		t.Error("unexpected match of the pod IP filter")
+	}
+}
+
+func TestPcapFilterWindow(t *testing.T) {
+	defer func(timezone string) { config.Config.Timezone = timezone }(config.Config.Timezone)
+	config.Config.Timezone = "Asia/Jerusalem"
+
+	from, err := parsePcapWindowTime("2024-01-01 12:00")
+	if err != nil {
+		t.Fatalf("unexpected error - err: %v", err)
+	}
+	if expected := time.Date(2024, 1, 1, 10, 0, 0, 0, time.UTC); !from.Equal(expected) {
+		t.Errorf("unexpected local time - expected: %v, actual: %v", expected, from)
+	}
+
+	to, err := parsePcapWindowTime("2024-01-01T10:00:30Z")
+	if err != nil {
+		t.Fatalf("unexpected error - err: %v", err)
+	}
+
+	if _, err := parsePcapWindowTime("yesterday"); err == nil {
+		t.Error("expected an error for an invalid time")
+	}
+
+	var filter *pcapFilter
+	filter = filter.withWindow(from, to)
+	for offset, expected := range map[time.Duration]bool{-time.Second: false, 0: true, 30 * time.Second: true, 31 * time.Second: false} {
+		ci := gopacket.CaptureInfo{Timestamp: from.Add(offset)}
+		if actual := filter.match(layers.LinkTypeEthernet, ci, nil); actual != expected {
+			t.Errorf("unexpected match at %v - expected: %v, actual: %v", offset, expected, actual)
+		}
+	}
+}
@@ -0,0 +1,317 @@
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/kubeshark/kubeshark/kubernetes"
+	"github.com/rs/zerolog/log"
+)
+
+const (
+	pcapFollowManifestName = ".pcapdump-manifest.json"
+	pcapFollowStagingDir   = ".pcapdump-staging"
+)
+
+// pcapFollowManifest tracks what a followed pcapdump has copied, so it can
+// resume without copying files again.
+type pcapFollowManifest struct {
+	ClusterID    string                      `json:"clusterId"`
+	Segment      string                      `json:"segment"`
+	SegmentStart time.Time                   `json:"segmentStart"`
+	SegmentSize  int64                       `json:"segmentSize"`
+	Files        map[string]pcapManifestFile `json:"files"`
+}
+
+type pcapManifestFile struct {
+	Pod      string    `json:"pod"`
+	Node     string    `json:"node"`
+	Size     int64     `json:"size"`
+	CopiedAt time.Time `json:"copiedAt"`
+	Segment  string    `json:"segment"`
+}
+
+func loadPcapFollowManifest(path string) (*pcapFollowManifest, error) {
+	manifest := &pcapFollowManifest{Files: map[string]pcapManifestFile{}}
+
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return manifest, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if err := json.Unmarshal(data, manifest); err != nil {
+		return nil, fmt.Errorf("invalid manifest %s: %w", path, err)
+	}
+	if manifest.Files == nil {
+		manifest.Files = map[string]pcapManifestFile{}
+	}
+
+	return manifest, nil
+}
+
+// save replaces the manifest atomically, so an interruption never leaves a
+// partial one behind.
+func (manifest *pcapFollowManifest) save(path string) error {
+	data, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	tempPath := path + ".tmp"
+	if err := os.WriteFile(tempPath, data, 0644); err != nil {
+		return err
+	}
+
+	return os.Rename(tempPath, path)
+}
+
+// pcapFollowOptions holds how the local output of a followed pcapdump rolls
+type pcapFollowOptions struct {
+	Interval time.Duration
+	RollSize int64
+	RollTime time.Duration
+}
+
+// followPcapFiles keeps copying the PCAP files workers rotate into the
+// destination directory until the context is done. The copied packets are
+// appended to a local pcap file, which rolls by size or age if requested, or
+// streamed to stdout.
+func followPcapFiles(ctx context.Context, provider *kubernetes.Provider, options pcapDumpOptions, followOptions pcapFollowOptions) error {
+	var stream *pcapAppender
+	if options.Output == pcapOutputStdout {
+		stream = newPcapAppender(os.Stdout)
+	}
+
+	manifestPath := filepath.Join(options.DestDir, pcapFollowManifestName)
+	manifest, err := loadPcapFollowManifest(manifestPath)
+	if err != nil {
+		return err
+	}
+
+	clusterID, err := getClusterID(provider)
+	if err != nil {
+		return fmt.Errorf("failed to get cluster ID: %w", err)
+	}
+	if manifest.ClusterID != "" && manifest.ClusterID != clusterID {
+		return fmt.Errorf("%s belongs to the cluster %s, use another destination directory", options.DestDir, manifest.ClusterID)
+	}
+	manifest.ClusterID = clusterID
+
+	// Drop whatever an interrupted sync appended past the recorded size
+	if manifest.Segment != "" && stream == nil {
+		segmentPath := filepath.Join(options.DestDir, manifest.Segment)
+		if info, err := os.Stat(segmentPath); err == nil && info.Size() > manifest.SegmentSize {
+			if err := os.Truncate(segmentPath, manifest.SegmentSize); err != nil {
+				return err
+			}
+		}
+		log.Info().Int("copied-files", len(manifest.Files)).Str("segment", segmentPath).Msg("Resuming the sync.")
+	}
+
+	if len(options.Hosts) > 0 && stream == nil {
+		hostsFile := filepath.Join(options.DestDir, clusterID+".hosts")
+		if err := writeHostsFile(hostsFile, options.Hosts); err != nil {
+			log.Warn().Err(err).Msg("Failed writing the hosts file.")
+		}
+	}
+
+	stagingDir := filepath.Join(options.DestDir, pcapFollowStagingDir)
+	if err := os.MkdirAll(stagingDir, 0755); err != nil {
+		return err
+	}
+	defer os.RemoveAll(stagingDir)
+
+	log.Info().Str("interval", followOptions.Interval.String()).Msg("Following the PCAP files of the workers, press Ctrl+C to stop.")
+
+	for {
+		if err := syncPcapFiles(ctx, provider, options, followOptions, manifest, manifestPath, stagingDir, stream); err != nil {
+			log.Warn().Err(err).Msg("Failed syncing the PCAP files, retrying on the next interval.")
+		}
+
+		select {
+		case <-ctx.Done():
+			log.Info().Str("manifest", manifestPath).Msg("Stopped following the PCAP files.")
+			return nil
+		case <-time.After(followOptions.Interval):
+		}
+	}
+}
+
+// syncPcapFiles copies the rotated files that aren't in the manifest yet.
+// The newest file of every worker is still being written, so it's left for
+// a later sync. The packets go to the stream if there's one, or else to the
+// current segment.
+func syncPcapFiles(ctx context.Context, provider *kubernetes.Provider, options pcapDumpOptions, followOptions pcapFollowOptions, manifest *pcapFollowManifest, manifestPath string, stagingDir string, stream *pcapAppender) error {
+	workerPods, err := listTargetWorkerPods(ctx, provider, options)
+	if err != nil {
+		return err
+	}
+
+	var staged []string
+	copied := map[string]pcapManifestFile{}
+	for _, pod := range workerPods {
+		if err := listFilesInPodDir(ctx, provider, pod, options.From, options.To); err != nil {
+			log.Debug().Err(err).Msgf("error listing files in pod %s", pod.Pod.Name)
+			continue
+		}
+
+		files := rotatedPcapFiles(pod.Files)
+		for _, file := range files {
+			key := pod.Pod.Spec.NodeName + "/" + file
+			if _, ok := manifest.Files[key]; ok {
+				continue
+			}
+
+			destFile := filepath.Join(stagingDir, strings.ReplaceAll(key, "/", "_"))
+			if err := copyFileFromPod(ctx, provider, pod, file, destFile); err != nil {
+				os.Remove(destFile)
+				if ctx.Err() != nil {
+					break
+				}
+				log.Debug().Err(err).Msgf("error copying file %s from pod %s in namespace %s", file, pod.Pod.Name, pod.Pod.Namespace)
+				continue
+			}
+
+			info, err := os.Stat(destFile)
+			if err != nil {
+				continue
+			}
+
+			log.Info().Msgf("Copied file %s from pod %s", file, pod.Pod.Name)
+			staged = append(staged, destFile)
+			copied[key] = pcapManifestFile{Pod: pod.Pod.Name, Node: pod.Pod.Spec.NodeName, Size: info.Size(), CopiedAt: time.Now()}
+		}
+	}
+
+	removeStalePcapPartials(stagingDir, workerPods)
+
+	defer func() {
+		for _, file := range staged {
+			os.Remove(file)
+		}
+	}()
+
+	if len(staged) == 0 {
+		return nil
+	}
+
+	if stream != nil {
+		if err := stream.append(staged, options.Filter); err != nil {
+			return err
+		}
+		for key, file := range copied {
+			file.Segment = pcapOutputStdout
+			manifest.Files[key] = file
+		}
+		return manifest.save(manifestPath)
+	}
+
+	segmentPath := filepath.Join(options.DestDir, manifest.Segment)
+	if manifest.Segment == "" || shouldRollPcapSegment(segmentPath, manifest.SegmentStart, followOptions) {
+		manifest.SegmentStart = time.Now()
+		manifest.Segment = fmt.Sprintf("%s-%s.pcap", manifest.ClusterID, manifest.SegmentStart.Format("2006-01-02_15-04-05"))
+		manifest.SegmentSize = 0
+		segmentPath = filepath.Join(options.DestDir, manifest.Segment)
+		log.Info().Msgf("Writing to %s", segmentPath)
+	}
+
+	if err := appendPCAPs(segmentPath, staged, options.Filter); err != nil {
+		return err
+	}
+
+	info, err := os.Stat(segmentPath)
+	if err != nil {
+		return err
+	}
+	manifest.SegmentSize = info.Size()
+
+	for key, file := range copied {
+		file.Segment = manifest.Segment
+		manifest.Files[key] = file
+	}
+
+	return manifest.save(manifestPath)
+}
+
+// rotatedPcapFiles returns the files ordered by time without the newest one,
+// which the worker is still writing to.
+func rotatedPcapFiles(files []string) []string {
+	type timedFile struct {
+		name string
+		time time.Time
+	}
+
+	var timedFiles []timedFile
+	for _, file := range files {
+		fileTime, err := parsePcapFileTime(file)
+		if err != nil {
+			continue
+		}
+		timedFiles = append(timedFiles, timedFile{name: file, time: fileTime})
+	}
+	if len(timedFiles) == 0 {
+		return nil
+	}
+
+	sort.Slice(timedFiles, func(i, j int) bool { return timedFiles[i].time.Before(timedFiles[j].time) })
+
+	rotated := make([]string, 0, len(timedFiles)-1)
+	for _, file := range timedFiles[:len(timedFiles)-1] {
+		rotated = append(rotated, file.name)
+	}
+
+	return rotated
+}
+
+func shouldRollPcapSegment(segmentPath string, segmentStart time.Time, followOptions pcapFollowOptions) bool {
+	if followOptions.RollTime > 0 && time.Since(segmentStart) >= followOptions.RollTime {
+		return true
+	}
+
+	if followOptions.RollSize > 0 {
+		if info, err := os.Stat(segmentPath); err == nil && info.Size() >= followOptions.RollSize {
+			return true
+		}
+	}
+
+	return false
+}
+
+// parseByteSize parses sizes such as 500MB, 1.5GB or 512MiB.
+func parseByteSize(value string) (int64, error) {
+	units := []struct {
+		suffix     string
+		multiplier float64
+	}{
+		{"KiB", 1 << 10}, {"MiB", 1 << 20}, {"GiB", 1 << 30}, {"TiB", 1 << 40},
+		{"KB", 1e3}, {"MB", 1e6}, {"GB", 1e9}, {"TB", 1e12},
+		{"B", 1},
+	}
+
+	trimmed := strings.TrimSpace(value)
+	multiplier := 1.0
+	for _, unit := range units {
+		if strings.HasSuffix(strings.ToUpper(trimmed), strings.ToUpper(unit.suffix)) {
+			trimmed = strings.TrimSpace(trimmed[:len(trimmed)-len(unit.suffix)])
+			multiplier = unit.multiplier
+			break
+		}
+	}
+
+	number, err := strconv.ParseFloat(trimmed, 64)
+	if err != nil || number <= 0 {
+		return 0, fmt.Errorf("invalid size %q, expected e.g. 500MB", value)
+	}
+
+	return int64(number * multiplier), nil
+}
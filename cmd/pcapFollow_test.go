@@ -0,0 +1,113 @@
+package cmd
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestRotatedPcapFiles(t *testing.T) {
+	files := []string{"node-20240101-120200.pcap", "node-20240101-120000.pcap", "node-20240101-120100.pcap"}
+
+	expected := []string{"node-20240101-120000.pcap", "node-20240101-120100.pcap"}
+	if actual := rotatedPcapFiles(files); !reflect.DeepEqual(actual, expected) {
+		t.Errorf("unexpected rotated files - expected: %v, actual: %v", expected, actual)
+	}
+}
+
+func TestAppendPCAPs(t *testing.T) {
+	dir := t.TempDir()
+	base := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	at := func(second int) time.Time { return base.Add(time.Duration(second) * time.Second) }
+
+	first := filepath.Join(dir, "first.pcap")
+	second := filepath.Join(dir, "second.pcap")
+	writeTestPcap(t, first, 65535, at(2), at(1))
+	writeTestPcap(t, second, 65535, at(3))
+
+	segment := filepath.Join(dir, "segment.pcap")
+	if err := appendPCAPs(segment, []string{first}, nil); err != nil {
+		t.Fatalf("unexpected error - err: %v", err)
+	}
+	if err := appendPCAPs(segment, []string{second}, nil); err != nil {
+		t.Fatalf("unexpected error - err: %v", err)
+	}
+
+	seconds, _ := readTestPcapSeconds(t, segment)
+	if expected := []int{2, 1, 3}; !reflect.DeepEqual(seconds, expected) {
+		t.Errorf("unexpected packets - expected: %v, actual: %v", expected, seconds)
+	}
+}
+
+func TestPcapAppenderStream(t *testing.T) {
+	dir := t.TempDir()
+	base := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	at := func(second int) time.Time { return base.Add(time.Duration(second) * time.Second) }
+
+	first := filepath.Join(dir, "first.pcap")
+	second := filepath.Join(dir, "second.pcap")
+	writeTestPcap(t, first, 65535, at(1))
+	writeTestPcap(t, second, 65535, at(2))
+
+	var stream bytes.Buffer
+	appender := newPcapAppender(&stream)
+	if err := appender.append([]string{first}, nil); err != nil {
+		t.Fatalf("unexpected error - err: %v", err)
+	}
+	if stream.Len() == 0 {
+		t.Fatal("expected the first batch to be flushed to the stream")
+	}
+	if err := appender.append([]string{second}, nil); err != nil {
+		t.Fatalf("unexpected error - err: %v", err)
+	}
+
+	streamed := filepath.Join(dir, "streamed.pcap")
+	if err := os.WriteFile(streamed, stream.Bytes(), 0644); err != nil {
+		t.Fatal(err)
+	}
+	seconds, snaplen := readTestPcapSeconds(t, streamed)
+	if expected := []int{1, 2}; !reflect.DeepEqual(seconds, expected) {
+		t.Errorf("unexpected packets - expected: %v, actual: %v", expected, seconds)
+	}
+	if snaplen != maxSnaplen {
+		t.Errorf("unexpected snaplen - expected: %d, actual: %d", maxSnaplen, snaplen)
+	}
+}
+
+func TestPcapFollowManifest(t *testing.T) {
+	path := filepath.Join(t.TempDir(), pcapFollowManifestName)
+
+	manifest, err := loadPcapFollowManifest(path)
+	if err != nil || len(manifest.Files) != 0 {
+		t.Fatalf("unexpected manifest - manifest: %v, err: %v", manifest, err)
+	}
+
+	manifest.Segment = "cluster-2024-01-01_00-00-00.pcap"
+	manifest.Files["node-a/node-20240101-120000.pcap"] = pcapManifestFile{Pod: "worker-a", Node: "node-a", Size: 24}
+	if err := manifest.save(path); err != nil {
+		t.Fatalf("unexpected error - err: %v", err)
+	}
+	if _, err := os.Stat(path + ".tmp"); !os.IsNotExist(err) {
+		t.Error("expected the temporary manifest to be renamed")
+	}
+
+	loaded, err := loadPcapFollowManifest(path)
+	if err != nil || !reflect.DeepEqual(loaded, manifest) {
+		t.Errorf("unexpected loaded manifest - expected: %v, actual: %v, err: %v", manifest, loaded, err)
+	}
+}
+
+func TestParseByteSize(t *testing.T) {
+	for value, expected := range map[string]int64{"500MB": 500e6, "1.5GB": 1.5e9, "512MiB": 512 << 20, "100": 100, "2kb": 2000} {
+		if actual, err := parseByteSize(value); err != nil || actual != expected {
+			t.Errorf("unexpected size of %s - expected: %d, actual: %d, err: %v", value, expected, actual, err)
+		}
+	}
+
+	if _, err := parseByteSize("lots"); err == nil {
+		t.Error("expected an error for an invalid size")
+	}
+}
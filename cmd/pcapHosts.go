@@ -0,0 +1,130 @@
+package cmd
+
+import (
+	"bufio"
+	"context"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"regexp"
+	"sort"
+
+	"github.com/kubeshark/kubeshark/kubernetes"
+)
+
+const (
+	ngBlockTypeNameResolution = 0x00000004
+	ngNameRecordEnd           = 0x0000
+	ngNameRecordIPv4          = 0x0001
+	ngNameRecordIPv6          = 0x0002
+)
+
+// hostEntry maps an IP to the Kubernetes resource that owns it.
+type hostEntry struct {
+	IP   net.IP
+	Name string
+}
+
+// snapshotHostEntries maps the IPs of the pods and services in the namespaces
+// to their names, named `name/namespace`. Pods on the host network, like the
+// workers, share the IP of their node so they name it instead. Only the
+// namespaces are listed, so no cluster-wide permission is needed.
+func snapshotHostEntries(ctx context.Context, provider *kubernetes.Provider, namespaces []string) ([]hostEntry, error) {
+	entries := map[string]hostEntry{}
+	add := func(ip string, name string) {
+		parsed := net.ParseIP(ip)
+		if parsed == nil {
+			return
+		}
+		if _, ok := entries[parsed.String()]; !ok {
+			entries[parsed.String()] = hostEntry{IP: parsed, Name: name}
+		}
+	}
+
+	pods, err := provider.ListAllPodsMatchingRegex(ctx, regexp.MustCompile(".*"), namespaces)
+	if err != nil {
+		return nil, err
+	}
+	for _, pod := range pods {
+		if pod.Spec.HostNetwork {
+			add(pod.Status.HostIP, pod.Spec.NodeName)
+			continue
+		}
+		for _, podIP := range pod.Status.PodIPs {
+			add(podIP.IP, fmt.Sprintf("%s/%s", pod.Name, pod.Namespace))
+		}
+	}
+
+	services, err := provider.ListAllServices(ctx, namespaces)
+	if err != nil {
+		return nil, err
+	}
+	for _, service := range services {
+		for _, clusterIP := range service.Spec.ClusterIPs {
+			add(clusterIP, fmt.Sprintf("%s/%s", service.Name, service.Namespace))
+		}
+	}
+
+	sorted := make([]hostEntry, 0, len(entries))
+	for _, entry := range entries {
+		sorted = append(sorted, entry)
+	}
+	sort.Slice(sorted, func(i, j int) bool {
+		return sorted[i].IP.String() < sorted[j].IP.String()
+	})
+
+	return sorted, nil
+}
+
+// writeHostsFile writes the entries in the hosts file format Wireshark
+// reads for name resolution.
+func writeHostsFile(path string, entries []hostEntry) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	w := bufio.NewWriter(f)
+	for _, entry := range entries {
+		if _, err := fmt.Fprintf(w, "%s\t%s\n", entry.IP, entry.Name); err != nil {
+			return err
+		}
+	}
+
+	return w.Flush()
+}
+
+// writeNameResolutionBlock writes the entries as a little endian pcapng
+// name resolution block.
+func writeNameResolutionBlock(w io.Writer, entries []hostEntry) error {
+	var records []byte
+	appendRecord := func(recordType uint16, value []byte) {
+		records = binary.LittleEndian.AppendUint16(records, recordType)
+		records = binary.LittleEndian.AppendUint16(records, uint16(len(value)))
+		records = append(records, value...)
+		for len(records)%4 != 0 {
+			records = append(records, 0)
+		}
+	}
+
+	for _, entry := range entries {
+		if ipv4 := entry.IP.To4(); ipv4 != nil {
+			appendRecord(ngNameRecordIPv4, append(append([]byte{}, ipv4...), append([]byte(entry.Name), 0)...))
+		} else {
+			appendRecord(ngNameRecordIPv6, append(append([]byte{}, entry.IP.To16()...), append([]byte(entry.Name), 0)...))
+		}
+	}
+	appendRecord(ngNameRecordEnd, nil)
+
+	length := uint32(len(records) + 12)
+	block := binary.LittleEndian.AppendUint32(nil, ngBlockTypeNameResolution)
+	block = binary.LittleEndian.AppendUint32(block, length)
+	block = append(block, records...)
+	block = binary.LittleEndian.AppendUint32(block, length)
+
+	_, err := w.Write(block)
+	return err
+}
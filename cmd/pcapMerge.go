@@ -0,0 +1,678 @@
+package cmd
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"container/heap"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"runtime"
+	"strings"
+	"time"
+
+	"github.com/klauspost/compress/zstd"
+	"github.com/kubeshark/gopacket"
+	"github.com/kubeshark/gopacket/layers"
+	"github.com/kubeshark/gopacket/pcapgo"
+	"github.com/kubeshark/kubeshark/misc"
+	"github.com/rs/zerolog/log"
+	corev1 "k8s.io/api/core/v1"
+)
+
+// maxMergeFanIn bounds the number of files merged at once, larger merges
+// are done in rounds through intermediate files.
+const maxMergeFanIn = 256
+
+const pcapngMagic = 0x0A0D0D0A
+
+type pcapPacketReader interface {
+	ReadPacketData() ([]byte, gopacket.CaptureInfo, error)
+	LinkType() layers.LinkType
+	Resolution() gopacket.TimestampResolution
+}
+
+// pcapSource is a capture file taking part in a merge, holding its next
+// packet.
+type pcapSource struct {
+	path     string
+	index    int
+	file     *os.File
+	reader   pcapPacketReader
+	snaplen  uint32
+	data     []byte
+	ci       gopacket.CaptureInfo
+	finished bool
+}
+
+// openPcapSource opens a pcap or pcapng file. It returns nil for empty files.
+func openPcapSource(path string, index int) (*pcapSource, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open %s: %w", path, err)
+	}
+
+	fileInfo, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return nil, fmt.Errorf("failed to stat file %s: %w", path, err)
+	}
+
+	if fileInfo.Size() == 0 {
+		log.Debug().Msgf("Skipped empty file: %s", path)
+		file.Close()
+		return nil, nil
+	}
+
+	source := &pcapSource{path: path, index: index, file: file}
+	if source.reader, source.snaplen, err = newPcapPacketReader(file, path); err != nil {
+		file.Close()
+		return nil, err
+	}
+
+	return source, nil
+}
+
+// newPcapPacketReader reads a pcap or pcapng stream, telling them apart by
+// their magic number. It returns the snap length of the capture too.
+func newPcapPacketReader(r io.Reader, path string) (pcapPacketReader, uint32, error) {
+	bufReader := bufio.NewReader(r)
+	magic, err := bufReader.Peek(4)
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to read the header of %s: %w", path, err)
+	}
+
+	if binary.LittleEndian.Uint32(magic) == pcapngMagic {
+		reader, err := pcapgo.NewNgReader(bufReader, pcapgo.DefaultNgReaderOptions)
+		if err != nil {
+			return nil, 0, fmt.Errorf("failed to create pcapng reader for %s: %w", path, err)
+		}
+		var snaplen uint32
+		if intf, err := reader.Interface(0); err == nil {
+			snaplen = intf.SnapLength
+		}
+		return reader, snaplen, nil
+	}
+
+	reader, err := pcapgo.NewReader(bufReader)
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to create pcap reader for %s: %w", path, err)
+	}
+	return reader, reader.Snaplen(), nil
+}
+
+// openPcapFile opens a capture file for reading, decompressing it if it was
+// written with --compress.
+func openPcapFile(path string) (pcapPacketReader, io.Closer, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to open %s: %w", path, err)
+	}
+
+	r, release, err := decompressPcapStream(bufio.NewReader(file), path)
+	if err != nil {
+		file.Close()
+		return nil, nil, err
+	}
+	closer := pcapCloserFunc(func() error {
+		release()
+		return file.Close()
+	})
+
+	reader, _, err := newPcapPacketReader(r, path)
+	if err != nil {
+		closer.Close()
+		return nil, nil, err
+	}
+
+	return reader, closer, nil
+}
+
+// decompressPcapStream decompresses a gzip or zstd capture, telling them
+// apart by their magic number, and passes other streams through. release
+// frees the decompressor.
+func decompressPcapStream(r *bufio.Reader, path string) (decompressed io.Reader, release func(), err error) {
+	magic, err := r.Peek(4)
+	if err != nil {
+		return r, func() {}, nil
+	}
+
+	switch {
+	case bytes.HasPrefix(magic, []byte{0x1f, 0x8b}):
+		gzipReader, err := gzip.NewReader(r)
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to decompress %s: %w", path, err)
+		}
+		return gzipReader, func() {}, nil
+	case bytes.Equal(magic, []byte{0x28, 0xb5, 0x2f, 0xfd}):
+		decoder, err := zstd.NewReader(r)
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to decompress %s: %w", path, err)
+		}
+		return decoder, decoder.Close, nil
+	}
+
+	return r, func() {}, nil
+}
+
+type pcapCloserFunc func() error
+
+func (f pcapCloserFunc) Close() error {
+	return f()
+}
+
+// next reads the next packet of the source, marking it finished at the end
+// of the file.
+func (source *pcapSource) next() error {
+	data, ci, err := source.reader.ReadPacketData()
+	if err != nil {
+		source.finished = true
+		if errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
+			return nil
+		}
+		return fmt.Errorf("error reading packet from file %s: %w", source.path, err)
+	}
+
+	source.data = data
+	source.ci = ci
+	return nil
+}
+
+func (source *pcapSource) close() {
+	source.file.Close()
+}
+
+// pcapSourceHeap orders sources by the timestamp of their next packet, ties
+// keep the order of the input files.
+type pcapSourceHeap []*pcapSource
+
+func (h pcapSourceHeap) Len() int { return len(h) }
+func (h pcapSourceHeap) Less(i, j int) bool {
+	if h[i].ci.Timestamp.Equal(h[j].ci.Timestamp) {
+		return h[i].index < h[j].index
+	}
+	return h[i].ci.Timestamp.Before(h[j].ci.Timestamp)
+}
+func (h pcapSourceHeap) Swap(i, j int)       { h[i], h[j] = h[j], h[i] }
+func (h *pcapSourceHeap) Push(x interface{}) { *h = append(*h, x.(*pcapSource)) }
+func (h *pcapSourceHeap) Pop() interface{} {
+	old := *h
+	source := old[len(old)-1]
+	*h = old[:len(old)-1]
+	return source
+}
+
+// primePcapSources reads the first packet of every source.
+func primePcapSources(sources []*pcapSource) (errs []error) {
+	for _, source := range sources {
+		if err := source.next(); err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	return
+}
+
+// mergeSources streams the packets of the primed sources to write in
+// timestamp order, holding a single packet per source in memory.
+func mergeSources(sources []*pcapSource, write func(source *pcapSource) error) (errs []error) {
+	h := make(pcapSourceHeap, 0, len(sources))
+	for _, source := range sources {
+		if !source.finished {
+			h = append(h, source)
+		}
+	}
+	heap.Init(&h)
+
+	for h.Len() > 0 {
+		source := h[0]
+		if err := write(source); err != nil {
+			errs = append(errs, err)
+			return
+		}
+
+		if err := source.next(); err != nil {
+			errs = append(errs, err)
+		}
+		if source.finished {
+			heap.Pop(&h)
+		} else {
+			heap.Fix(&h, 0)
+		}
+	}
+
+	return
+}
+
+// openPcapSources opens the input files, skipping empty and unreadable ones.
+func openPcapSources(inputFiles []string) (sources []*pcapSource, errs []error) {
+	for i, inputFile := range inputFiles {
+		source, err := openPcapSource(inputFile, i)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		if source != nil {
+			sources = append(sources, source)
+		}
+	}
+
+	return
+}
+
+func closePcapSources(sources []*pcapSource) {
+	for _, source := range sources {
+		source.close()
+	}
+}
+
+// mergePCAPs merges the packets of the input files that match the filter
+// into a classic pcap file in timestamp order.
+func mergePCAPs(outputFile string, inputFiles []string, filter *pcapFilter) error {
+	return mergePCAPsTo(newPcapFileOutput(outputFile), outputFile, inputFiles, filter)
+}
+
+// mergePCAPsTo merges the packets of the input files that match the filter
+// into a classic pcap output in timestamp order. The link type and the
+// largest snaplen of the inputs are kept, inputs with a different link type
+// than the first one can't be represented and are skipped. Intermediate files
+// of large merges are named after tempPrefix.
+func mergePCAPsTo(output *pcapOutput, tempPrefix string, inputFiles []string, filter *pcapFilter) error {
+	if len(inputFiles) > maxMergeFanIn {
+		intermediateFiles, cleanup, err := premergePCAPsInRounds(tempPrefix, inputFiles, filter)
+		defer cleanup()
+		if err != nil {
+			return err
+		}
+		return mergePCAPsTo(output, tempPrefix+".merged", intermediateFiles, filter)
+	}
+
+	sources, mergingErrs := openPcapSources(inputFiles)
+	defer closePcapSources(sources)
+
+	linkType := layers.LinkTypeEthernet
+	snaplen := uint32(0)
+	nanos := false
+	var compatible []*pcapSource
+	for _, source := range sources {
+		if len(compatible) == 0 {
+			linkType = source.reader.LinkType()
+		} else if source.reader.LinkType() != linkType {
+			mergingErrs = append(mergingErrs, fmt.Errorf("skipped %s: link type %s differs from %s", source.path, source.reader.LinkType(), linkType))
+			continue
+		}
+		snaplen = max(snaplen, source.snaplen)
+		nanos = nanos || source.reader.Resolution() == gopacket.TimestampResolutionNanosecond
+		compatible = append(compatible, source)
+	}
+	if snaplen == 0 {
+		snaplen = maxSnaplen
+	}
+
+	err := output.start(func(w io.Writer) (pcapPacketWriter, error) {
+		writer := pcapgo.NewWriter(w)
+		if nanos {
+			writer = pcapgo.NewWriterNanos(w)
+		}
+		if err := writer.WriteFileHeader(snaplen, linkType); err != nil {
+			return nil, fmt.Errorf("failed to write PCAP file header: %w", err)
+		}
+		return pcapWriter{writer}, nil
+	})
+	if err != nil {
+		return err
+	}
+
+	mergingErrs = append(mergingErrs, primePcapSources(compatible)...)
+	mergingErrs = append(mergingErrs, mergeSources(compatible, func(source *pcapSource) error {
+		if !filter.match(linkType, source.ci, source.data) {
+			return nil
+		}
+		if err := output.WritePacket(linkType, source.ci, source.data); err != nil {
+			return fmt.Errorf("error writing packet to output file: %w", err)
+		}
+		return nil
+	})...)
+
+	if err := errors.Join(mergingErrs...); err != nil {
+		log.Warn().Err(err).Msg("Some packets couldn't be merged.")
+	}
+
+	return output.close()
+}
+
+// premergePCAPsInRounds merges groups of at most maxMergeFanIn files into
+// intermediate files, to be merged in turn.
+func premergePCAPsInRounds(tempPrefix string, inputFiles []string, filter *pcapFilter) (intermediateFiles []string, cleanup func(), err error) {
+	cleanup = func() {
+		for _, file := range intermediateFiles {
+			os.Remove(file)
+		}
+	}
+
+	for start := 0; start < len(inputFiles); start += maxMergeFanIn {
+		end := min(start+maxMergeFanIn, len(inputFiles))
+		intermediateFile := fmt.Sprintf("%s.round%d", tempPrefix, len(intermediateFiles))
+		intermediateFiles = append(intermediateFiles, intermediateFile)
+		if err = mergePCAPs(intermediateFile, inputFiles[start:end], filter); err != nil {
+			return
+		}
+	}
+
+	return
+}
+
+const (
+	pcapFormatPcap   = "pcap"
+	pcapFormatPcapng = "pcapng"
+)
+
+// pcapInput is a copied capture file and the worker pod it was copied from.
+type pcapInput struct {
+	Path string
+	Pod  *corev1.Pod
+}
+
+// pcapMetadata describes the capture in the section header of pcapng files.
+// The cluster ID is left out if empty.
+type pcapMetadata struct {
+	ClusterID string
+	From      time.Time
+	To        time.Time
+	Release   string
+	Hosts     []hostEntry
+}
+
+func (metadata pcapMetadata) comment() string {
+	lines := []string{fmt.Sprintf("%s pcapdump", misc.Software)}
+	if metadata.ClusterID != "" {
+		lines = append(lines, fmt.Sprintf("Cluster ID: %s", metadata.ClusterID))
+	}
+
+	return strings.Join(append(lines,
+		fmt.Sprintf("Capture window: %s - %s", metadata.From.Format(time.RFC3339), metadata.To.Format(time.RFC3339)),
+		fmt.Sprintf("CLI version: %s", misc.Ver),
+		fmt.Sprintf("%s release: %s", misc.Software, metadata.Release),
+	), "\n")
+}
+
+// workerRelease returns the Kubeshark release a worker pod belongs to.
+func workerRelease(pod *corev1.Pod) string {
+	if version, ok := pod.Labels["app.kubernetes.io/version"]; ok {
+		return version
+	}
+
+	for _, container := range pod.Spec.Containers {
+		if container.Name == "sniffer" {
+			return container.Image
+		}
+	}
+
+	return "unknown"
+}
+
+type pcapngInterfaceKey struct {
+	pod      string
+	linkType layers.LinkType
+}
+
+// mergePCAPNG merges the packets of the input files that match the filter
+// into a pcapng file in timestamp order.
+func mergePCAPNG(outputFile string, inputs []pcapInput, metadata pcapMetadata, filter *pcapFilter) error {
+	return mergePCAPNGTo(newPcapFileOutput(outputFile), outputFile, inputs, metadata, filter)
+}
+
+// mergePCAPNGTo merges the packets of the input files that match the filter
+// into a pcapng output in timestamp order. Every worker pod gets its own
+// interface, named after its node and the pod, and the section header
+// describes the capture.
+func mergePCAPNGTo(output *pcapOutput, tempPrefix string, inputs []pcapInput, metadata pcapMetadata, filter *pcapFilter) error {
+	if len(inputs) > maxMergeFanIn {
+		premergedInputs, cleanup, err := premergePcapInputsByPod(tempPrefix, inputs, filter)
+		defer cleanup()
+		if err != nil {
+			return err
+		}
+		inputs = premergedInputs
+	}
+
+	inputFiles := make([]string, 0, len(inputs))
+	for _, input := range inputs {
+		inputFiles = append(inputFiles, input.Path)
+	}
+
+	sources, mergingErrs := openPcapSources(inputFiles)
+	defer closePcapSources(sources)
+	mergingErrs = append(mergingErrs, primePcapSources(sources)...)
+
+	var interfaces []pcapgo.NgInterface
+	interfaceIDs := map[pcapngInterfaceKey]int{}
+	sourceInterfaces := map[int]int{}
+	for _, source := range sources {
+		pod := inputs[source.index].Pod
+		key := pcapngInterfaceKey{pod: pod.Namespace + "/" + pod.Name, linkType: source.reader.LinkType()}
+
+		id, ok := interfaceIDs[key]
+		if !ok {
+			id = len(interfaces)
+			interfaceIDs[key] = id
+			intf := pcapgo.NgInterface{
+				Name:        fmt.Sprintf("%s/%s", pod.Spec.NodeName, pod.Name),
+				Description: fmt.Sprintf("%s worker %s/%s on node %s", misc.Software, pod.Namespace, pod.Name, pod.Spec.NodeName),
+				OS:          "linux",
+				LinkType:    key.linkType,
+			}
+			if output.anonymizer != nil {
+				// Node and pod names identify the cluster too
+				anonymizedName := fmt.Sprintf("worker-%d", id+1)
+				output.anonymizer.interfaces[anonymizedName] = intf.Name
+				intf.Name = anonymizedName
+				intf.Description = fmt.Sprintf("%s worker", misc.Software)
+			}
+			interfaces = append(interfaces, intf)
+		}
+		interfaces[id].SnapLength = max(interfaces[id].SnapLength, source.snaplen)
+		sourceInterfaces[source.index] = id
+
+		if !source.finished && (metadata.From.IsZero() || source.ci.Timestamp.Before(metadata.From)) {
+			metadata.From = source.ci.Timestamp
+		}
+	}
+
+	if len(interfaces) == 0 {
+		interfaces = append(interfaces, pcapgo.DefaultNgInterface)
+		interfaces[0].LinkType = layers.LinkTypeEthernet
+	}
+
+	// Every file of a split capture starts with the whole header
+	err := output.start(func(w io.Writer) (pcapPacketWriter, error) {
+		writer, err := pcapgo.NewNgWriterInterface(w, interfaces[0], pcapgo.NgWriterOptions{
+			SectionInfo: pcapgo.NgSectionInfo{
+				Hardware:    runtime.GOARCH,
+				OS:          runtime.GOOS,
+				Application: fmt.Sprintf("%s %s", misc.Program, misc.Ver),
+				Comment:     metadata.comment(),
+			},
+		})
+		if err != nil {
+			return nil, fmt.Errorf("failed to write PCAPNG section header: %w", err)
+		}
+
+		for _, intf := range interfaces[1:] {
+			if _, err := writer.AddInterface(intf); err != nil {
+				return nil, fmt.Errorf("failed to write PCAPNG interface: %w", err)
+			}
+		}
+
+		if len(metadata.Hosts) > 0 {
+			// The writer buffers on its own, flush it to keep the blocks in order.
+			if err := writer.Flush(); err != nil {
+				return nil, fmt.Errorf("failed to write PCAPNG header: %w", err)
+			}
+			if err := writeNameResolutionBlock(w, metadata.Hosts); err != nil {
+				return nil, fmt.Errorf("failed to write PCAPNG name resolution: %w", err)
+			}
+		}
+
+		return writer, nil
+	})
+	if err != nil {
+		return err
+	}
+
+	mergingErrs = append(mergingErrs, mergeSources(sources, func(source *pcapSource) error {
+		if !filter.match(source.reader.LinkType(), source.ci, source.data) {
+			return nil
+		}
+		ci := source.ci
+		ci.InterfaceIndex = sourceInterfaces[source.index]
+		if err := output.WritePacket(source.reader.LinkType(), ci, source.data); err != nil {
+			return fmt.Errorf("error writing packet to output file: %w", err)
+		}
+		return nil
+	})...)
+
+	if err := errors.Join(mergingErrs...); err != nil {
+		log.Warn().Err(err).Msg("Some packets couldn't be merged.")
+	}
+
+	return output.close()
+}
+
+// premergePcapInputsByPod merges the files of every pod into a single file,
+// to keep the number of files open at once bounded.
+func premergePcapInputsByPod(tempPrefix string, inputs []pcapInput, filter *pcapFilter) (premerged []pcapInput, cleanup func(), err error) {
+	var intermediateFiles []string
+	cleanup = func() {
+		for _, file := range intermediateFiles {
+			os.Remove(file)
+		}
+	}
+
+	var pods []*corev1.Pod
+	podFiles := map[*corev1.Pod][]string{}
+	for _, input := range inputs {
+		if _, ok := podFiles[input.Pod]; !ok {
+			pods = append(pods, input.Pod)
+		}
+		podFiles[input.Pod] = append(podFiles[input.Pod], input.Path)
+	}
+
+	for i, pod := range pods {
+		intermediateFile := fmt.Sprintf("%s.pod%d", tempPrefix, i)
+		intermediateFiles = append(intermediateFiles, intermediateFile)
+		if err = mergePCAPs(intermediateFile, podFiles[pod], filter); err != nil {
+			return
+		}
+		premerged = append(premerged, pcapInput{Path: intermediateFile, Pod: pod})
+	}
+
+	return
+}
+
+// appendPCAPs merges the packets of the input files that match the filter
+// in timestamp order and appends them to a classic pcap file, creating it if
+// needed. Inputs with a different link type than the file are skipped.
+func appendPCAPs(outputFile string, inputFiles []string, filter *pcapFilter) error {
+	var existingHeader *pcapgo.Reader
+	if existing, err := os.Open(outputFile); err == nil {
+		if reader, err := pcapgo.NewReader(existing); err == nil {
+			existingHeader = reader
+		}
+		existing.Close()
+	}
+
+	f, err := os.OpenFile(outputFile, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return fmt.Errorf("failed to open output file: %w", err)
+	}
+	defer f.Close()
+
+	appender := newPcapAppender(f)
+	if existingHeader != nil {
+		appender.resume(existingHeader.LinkType(), existingHeader.Resolution() == gopacket.TimestampResolutionNanosecond)
+	}
+
+	return appender.append(inputFiles, filter)
+}
+
+// pcapAppender writes batches of merged files to a single classic pcap
+// stream, e.g. a growing file or stdout. The header is written with the
+// first batch.
+type pcapAppender struct {
+	bufWriter *bufio.Writer
+	writer    *pcapgo.Writer
+	linkType  layers.LinkType
+}
+
+func newPcapAppender(w io.Writer) *pcapAppender {
+	return &pcapAppender{bufWriter: bufio.NewWriterSize(w, 4*1024*1024)}
+}
+
+// resume continues a stream that already has a header.
+func (appender *pcapAppender) resume(linkType layers.LinkType, nanos bool) {
+	appender.linkType = linkType
+	appender.writer = pcapgo.NewWriter(appender.bufWriter)
+	if nanos {
+		appender.writer = pcapgo.NewWriterNanos(appender.bufWriter)
+	}
+}
+
+// append merges the packets of the input files that match the filter in
+// timestamp order and writes them to the stream, flushing it once done.
+func (appender *pcapAppender) append(inputFiles []string, filter *pcapFilter) error {
+	sources, mergingErrs := openPcapSources(inputFiles)
+	defer closePcapSources(sources)
+
+	if len(sources) == 0 {
+		return errors.Join(mergingErrs...)
+	}
+
+	if appender.writer == nil {
+		nanos := false
+		for _, source := range sources {
+			if source.reader.LinkType() == sources[0].reader.LinkType() {
+				nanos = nanos || source.reader.Resolution() == gopacket.TimestampResolutionNanosecond
+			}
+		}
+		appender.resume(sources[0].reader.LinkType(), nanos)
+
+		// Later batches may come from workers with a larger snaplen
+		if err := appender.writer.WriteFileHeader(maxSnaplen, appender.linkType); err != nil {
+			return fmt.Errorf("failed to write PCAP file header: %w", err)
+		}
+	}
+
+	var compatible []*pcapSource
+	for _, source := range sources {
+		if source.reader.LinkType() != appender.linkType {
+			mergingErrs = append(mergingErrs, fmt.Errorf("skipped %s: link type %s differs from %s", source.path, source.reader.LinkType(), appender.linkType))
+			continue
+		}
+		compatible = append(compatible, source)
+	}
+
+	mergingErrs = append(mergingErrs, primePcapSources(compatible)...)
+	mergingErrs = append(mergingErrs, mergeSources(compatible, func(source *pcapSource) error {
+		if !filter.match(appender.linkType, source.ci, source.data) {
+			return nil
+		}
+		if err := appender.writer.WritePacket(source.ci, source.data); err != nil {
+			return fmt.Errorf("error writing packet to output file: %w", err)
+		}
+		return nil
+	})...)
+
+	if err := errors.Join(mergingErrs...); err != nil {
+		log.Warn().Err(err).Msg("Some packets couldn't be merged.")
+	}
+
+	if err := appender.bufWriter.Flush(); err != nil {
+		return fmt.Errorf("failed to write merged packets: %w", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,165 @@
+package cmd
+
+import (
+	"bytes"
+	"net"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/kubeshark/gopacket"
+	"github.com/kubeshark/gopacket/layers"
+	"github.com/kubeshark/gopacket/pcapgo"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func writeTestPcap(t *testing.T, path string, snaplen uint32, timestamps ...time.Time) {
+	t.Helper()
+
+	f, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	writer := pcapgo.NewWriter(f)
+	if err := writer.WriteFileHeader(snaplen, layers.LinkTypeEthernet); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, timestamp := range timestamps {
+		data := []byte{byte(timestamp.Second())}
+		if err := writer.WritePacket(gopacket.CaptureInfo{Timestamp: timestamp, CaptureLength: len(data), Length: len(data)}, data); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func readTestPcapSeconds(t *testing.T, path string) (seconds []int, snaplen uint32) {
+	t.Helper()
+
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	reader, err := pcapgo.NewReader(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for {
+		_, ci, err := reader.ReadPacketData()
+		if err != nil {
+			break
+		}
+		seconds = append(seconds, ci.Timestamp.Second())
+	}
+
+	return seconds, reader.Snaplen()
+}
+
+func TestMergePCAPsChronologically(t *testing.T) {
+	dir := t.TempDir()
+	base := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	at := func(second int) time.Time { return base.Add(time.Duration(second) * time.Second) }
+
+	first := filepath.Join(dir, "node-a.pcap")
+	second := filepath.Join(dir, "node-b.pcap")
+	empty := filepath.Join(dir, "empty.pcap")
+	writeTestPcap(t, first, 65535, at(1), at(4), at(5))
+	writeTestPcap(t, second, 262144, at(2), at(3), at(6))
+	if err := os.WriteFile(empty, nil, 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	merged := filepath.Join(dir, "merged.pcap")
+	if err := mergePCAPs(merged, []string{first, empty, second}, nil); err != nil {
+		t.Fatalf("unexpected error - err: %v", err)
+	}
+
+	seconds, snaplen := readTestPcapSeconds(t, merged)
+	expected := []int{1, 2, 3, 4, 5, 6}
+	if len(seconds) != len(expected) {
+		t.Fatalf("unexpected packets - expected: %v, actual: %v", expected, seconds)
+	}
+	for i := range expected {
+		if seconds[i] != expected[i] {
+			t.Fatalf("packets out of order - expected: %v, actual: %v", expected, seconds)
+		}
+	}
+
+	if snaplen != 262144 {
+		t.Errorf("unexpected snaplen - expected: 262144, actual: %d", snaplen)
+	}
+}
+
+func TestMergePCAPNG(t *testing.T) {
+	dir := t.TempDir()
+	base := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	at := func(second int) time.Time { return base.Add(time.Duration(second) * time.Second) }
+
+	podA := &corev1.Pod{ObjectMeta: metav1.ObjectMeta{Name: "worker-a", Namespace: "kubeshark"}, Spec: corev1.PodSpec{NodeName: "node-a"}}
+	podB := &corev1.Pod{ObjectMeta: metav1.ObjectMeta{Name: "worker-b", Namespace: "kubeshark"}, Spec: corev1.PodSpec{NodeName: "node-b"}}
+
+	first := filepath.Join(dir, "a.pcap")
+	second := filepath.Join(dir, "b.pcap")
+	writeTestPcap(t, first, 65535, at(1), at(3))
+	writeTestPcap(t, second, 65535, at(2))
+
+	merged := filepath.Join(dir, "merged.pcapng")
+	err := mergePCAPNG(merged, []pcapInput{{Path: first, Pod: podA}, {Path: second, Pod: podB}}, pcapMetadata{
+		ClusterID: "cluster-1",
+		To:        at(10),
+		Release:   "v52.3",
+		Hosts:     []hostEntry{{IP: net.ParseIP("10.2.3.4"), Name: "checkout-7f9/payments"}},
+	}, nil)
+	if err != nil {
+		t.Fatalf("unexpected error - err: %v", err)
+	}
+
+	if buf, _ := os.ReadFile(merged); !bytes.Contains(buf, []byte("checkout-7f9/payments\x00")) {
+		t.Error("expected a name resolution record")
+	}
+
+	f, err := os.Open(merged)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	reader, err := pcapgo.NewNgReader(f, pcapgo.DefaultNgReaderOptions)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	comment := reader.SectionInfo().Comment
+	if !strings.Contains(comment, "Cluster ID: cluster-1") || !strings.Contains(comment, at(1).Format(time.RFC3339)) {
+		t.Errorf("unexpected section comment - actual: %s", comment)
+	}
+
+	var interfaces []int
+	for {
+		_, ci, err := reader.ReadPacketData()
+		if err != nil {
+			break
+		}
+		interfaces = append(interfaces, ci.InterfaceIndex)
+	}
+
+	if expected := []int{0, 1, 0}; !reflect.DeepEqual(interfaces, expected) {
+		t.Errorf("unexpected packet interfaces - expected: %v, actual: %v", expected, interfaces)
+	}
+
+	if reader.NInterfaces() != 2 {
+		t.Fatalf("unexpected number of interfaces - expected: 2, actual: %d", reader.NInterfaces())
+	}
+	if intf, _ := reader.Interface(1); intf.Name != "node-b/worker-b" {
+		t.Errorf("unexpected interface name - expected: node-b/worker-b, actual: %s", intf.Name)
+	}
+}
@@ -0,0 +1,236 @@
+package cmd
+
+import (
+	"bufio"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/klauspost/compress/zstd"
+	"github.com/kubeshark/gopacket"
+	"github.com/kubeshark/gopacket/layers"
+	"github.com/kubeshark/gopacket/pcapgo"
+)
+
+const (
+	pcapCompressZstd = "zstd"
+	pcapCompressGzip = "gzip"
+)
+
+var pcapCompressExtensions = map[string]string{
+	pcapCompressZstd: ".zst",
+	pcapCompressGzip: ".gz",
+}
+
+// pcapPacketWriter writes the packets of a capture file after its header
+type pcapPacketWriter interface {
+	WritePacket(ci gopacket.CaptureInfo, data []byte) error
+	Flush() error
+}
+
+// pcapWriter adapts the classic pcap writer, which doesn't buffer.
+type pcapWriter struct {
+	*pcapgo.Writer
+}
+
+func (pcapWriter) Flush() error { return nil }
+
+type nopWriteCloser struct {
+	io.Writer
+}
+
+func (nopWriteCloser) Close() error { return nil }
+
+// countingWriter counts the bytes written through it
+type countingWriter struct {
+	io.Writer
+	count int64
+}
+
+func (w *countingWriter) Write(p []byte) (int, error) {
+	n, err := w.Writer.Write(p)
+	w.count += int64(n)
+	return n, err
+}
+
+// pcapOutput writes a merged capture to a stream or a series of files. The
+// capture is compressed if requested, and a new file is started once the
+// current one reaches the split size or its packets span the split time. The
+// size is counted after the compression, so a file may exceed it by what the
+// compressor holds back.
+type pcapOutput struct {
+	create    func(part int) (io.WriteCloser, error)
+	compress  string
+	splitSize int64
+	splitTime time.Duration
+
+	// dedup drops the copies of packets captured on several nodes, if set
+	dedup *pcapDeduplicator
+	// anonymizer rewrites every packet before it's written, if set
+	anonymizer *pcapAnonymizer
+
+	newWriter  func(w io.Writer) (pcapPacketWriter, error)
+	part       int
+	file       io.WriteCloser
+	hash       hash.Hash
+	bufWriter  *bufio.Writer
+	compressor io.WriteCloser
+	counter    *countingWriter
+	writer     pcapPacketWriter
+	partStart  time.Time
+
+	// checksums holds the SHA-256 of every written file, in part order
+	checksums []string
+}
+
+func newPcapOutput(create func(part int) (io.WriteCloser, error), compress string, splitSize int64, splitTime time.Duration) *pcapOutput {
+	return &pcapOutput{
+		create:    create,
+		compress:  compress,
+		splitSize: splitSize,
+		splitTime: splitTime,
+	}
+}
+
+// newPcapFileOutput writes the capture to a single uncompressed file.
+func newPcapFileOutput(path string) *pcapOutput {
+	return newPcapOutput(func(part int) (io.WriteCloser, error) {
+		return os.Create(path)
+	}, "", 0, 0)
+}
+
+func (output *pcapOutput) split() bool {
+	return output.splitSize > 0 || output.splitTime > 0
+}
+
+// start opens the first file, newWriter writes the header of every file.
+func (output *pcapOutput) start(newWriter func(w io.Writer) (pcapPacketWriter, error)) error {
+	output.newWriter = newWriter
+	return output.openPart()
+}
+
+func (output *pcapOutput) openPart() error {
+	output.part++
+	output.file = nil
+	file, err := output.create(output.part)
+	if err != nil {
+		return fmt.Errorf("failed to create output file: %w", err)
+	}
+
+	output.file = file
+	output.hash = sha256.New()
+	output.bufWriter = bufio.NewWriterSize(io.MultiWriter(file, output.hash), 4*1024*1024)
+	output.compressor = nil
+	output.partStart = time.Time{}
+
+	output.counter = &countingWriter{Writer: output.bufWriter}
+	var w io.Writer = output.counter
+	switch output.compress {
+	case pcapCompressZstd:
+		encoder, err := zstd.NewWriter(output.counter)
+		if err != nil {
+			file.Close()
+			return fmt.Errorf("failed to create zstd encoder: %w", err)
+		}
+		output.compressor = encoder
+		w = encoder
+	case pcapCompressGzip:
+		output.compressor = gzip.NewWriter(output.counter)
+		w = output.compressor
+	}
+
+	if output.writer, err = output.newWriter(w); err != nil {
+		output.closePart()
+		output.file = nil
+		return err
+	}
+
+	return nil
+}
+
+func (output *pcapOutput) closePart() error {
+	var errs []error
+	if output.writer != nil {
+		errs = append(errs, output.writer.Flush())
+		output.writer = nil
+	}
+	if output.compressor != nil {
+		errs = append(errs, output.compressor.Close())
+	}
+	errs = append(errs, output.bufWriter.Flush(), output.file.Close())
+
+	output.checksums = append(output.checksums, hex.EncodeToString(output.hash.Sum(nil)))
+
+	if err := errors.Join(errs...); err != nil {
+		return fmt.Errorf("failed to write output file: %w", err)
+	}
+
+	return nil
+}
+
+// WritePacket writes the packet, starting the next file of a split capture
+// first if the current one is full.
+func (output *pcapOutput) WritePacket(linkType layers.LinkType, ci gopacket.CaptureInfo, data []byte) error {
+	if output.dedup != nil && output.dedup.duplicate(linkType, ci, data) {
+		return nil
+	}
+	if output.anonymizer != nil {
+		ci, data = output.anonymizer.apply(linkType, ci, data)
+	}
+
+	if output.partStart.IsZero() {
+		output.partStart = ci.Timestamp
+	} else if (output.splitSize > 0 && output.counter.count >= output.splitSize) ||
+		(output.splitTime > 0 && ci.Timestamp.Sub(output.partStart) >= output.splitTime) {
+		if err := output.closePart(); err != nil {
+			return err
+		}
+		if err := output.openPart(); err != nil {
+			return err
+		}
+		output.partStart = ci.Timestamp
+	}
+
+	return output.writer.WritePacket(ci, data)
+}
+
+// close finishes the current file.
+func (output *pcapOutput) close() error {
+	if output.file == nil {
+		return nil
+	}
+
+	err := output.closePart()
+	output.file = nil
+	return err
+}
+
+// pcapSeriesFile names a file of the output series, numbering the parts of a
+// split capture and adding the extension of the compression.
+func pcapSeriesFile(path string, part int, split bool, compress string) string {
+	if split {
+		ext := filepath.Ext(path)
+		path = fmt.Sprintf("%s-%03d%s", strings.TrimSuffix(path, ext), part, ext)
+	}
+
+	return path + pcapCompressExtensions[compress]
+}
+
+// writeChecksumFile lists the SHA-256 of the files in the format of
+// sha256sum, so the series can be verified with `sha256sum -c`.
+func writeChecksumFile(path string, files []string, checksums []string) error {
+	var builder strings.Builder
+	for i, file := range files {
+		fmt.Fprintf(&builder, "%s  %s\n", checksums[i], filepath.Base(file))
+	}
+
+	return os.WriteFile(path, []byte(builder.String()), 0644)
+}
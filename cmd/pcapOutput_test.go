@@ -0,0 +1,129 @@
+package cmd
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/klauspost/compress/zstd"
+	"github.com/kubeshark/gopacket"
+	"github.com/kubeshark/gopacket/layers"
+	"github.com/kubeshark/gopacket/pcapgo"
+)
+
+func TestPcapSeriesFile(t *testing.T) {
+	tests := []struct {
+		split    bool
+		compress string
+		expected string
+	}{
+		{false, "", "dump/cluster-2024.pcap"},
+		{false, pcapCompressGzip, "dump/cluster-2024.pcap.gz"},
+		{true, "", "dump/cluster-2024-002.pcap"},
+		{true, pcapCompressZstd, "dump/cluster-2024-002.pcap.zst"},
+	}
+
+	for _, test := range tests {
+		if actual := pcapSeriesFile("dump/cluster-2024.pcap", 2, test.split, test.compress); actual != test.expected {
+			t.Errorf("unexpected file name - expected: %s, actual: %s", test.expected, actual)
+		}
+	}
+}
+
+func TestMergePCAPsSplitCompressed(t *testing.T) {
+	dir := t.TempDir()
+	base := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	at := func(second int) time.Time { return base.Add(time.Duration(second) * time.Second) }
+
+	input := filepath.Join(dir, "input.pcap")
+	writeTestPcap(t, input, 65535, at(1), at(2), at(11), at(12), at(25))
+
+	var parts []string
+	output := newPcapOutput(func(part int) (io.WriteCloser, error) {
+		path := filepath.Join(dir, fmt.Sprintf("part%d.pcap.zst", part))
+		parts = append(parts, path)
+		return os.Create(path)
+	}, pcapCompressZstd, 0, 10*time.Second)
+
+	if err := mergePCAPsTo(output, filepath.Join(dir, "merged"), []string{input}, nil); err != nil {
+		t.Fatalf("unexpected error - err: %v", err)
+	}
+
+	expected := [][]int{{1, 2}, {11, 12}, {25}}
+	if len(parts) != len(expected) || len(output.checksums) != len(expected) {
+		t.Fatalf("unexpected parts - expected: %d, actual: %d files and %d checksums", len(expected), len(parts), len(output.checksums))
+	}
+
+	for i, part := range parts {
+		compressed, err := os.ReadFile(part)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if sum := sha256.Sum256(compressed); hex.EncodeToString(sum[:]) != output.checksums[i] {
+			t.Errorf("unexpected checksum of %s", part)
+		}
+
+		decoder, err := zstd.NewReader(nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		data, err := decoder.DecodeAll(compressed, nil)
+		decoder.Close()
+		if err != nil {
+			t.Fatalf("unexpected error decompressing %s - err: %v", part, err)
+		}
+
+		decompressed := filepath.Join(dir, fmt.Sprintf("part%d.pcap", i+1))
+		if err := os.WriteFile(decompressed, data, 0644); err != nil {
+			t.Fatal(err)
+		}
+		if seconds, _ := readTestPcapSeconds(t, decompressed); !reflect.DeepEqual(seconds, expected[i]) {
+			t.Errorf("unexpected packets in %s - expected: %v, actual: %v", part, expected[i], seconds)
+		}
+	}
+}
+
+func TestPcapOutputSplitSizeCompressed(t *testing.T) {
+	dir := t.TempDir()
+	base := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	var parts []string
+	output := newPcapOutput(func(part int) (io.WriteCloser, error) {
+		path := filepath.Join(dir, fmt.Sprintf("part%d.pcap.gz", part))
+		parts = append(parts, path)
+		return os.Create(path)
+	}, pcapCompressGzip, 64*1024, 0)
+
+	err := output.start(func(w io.Writer) (pcapPacketWriter, error) {
+		writer := pcapgo.NewWriter(w)
+		if err := writer.WriteFileHeader(maxSnaplen, layers.LinkTypeEthernet); err != nil {
+			return nil, err
+		}
+		return pcapWriter{writer}, nil
+	})
+	if err != nil {
+		t.Fatalf("unexpected error - err: %v", err)
+	}
+
+	// 1 MB of zeros compresses far below the split size
+	data := make([]byte, 1024)
+	for i := 0; i < 1024; i++ {
+		ci := gopacket.CaptureInfo{Timestamp: base.Add(time.Duration(i) * time.Millisecond), CaptureLength: len(data), Length: len(data)}
+		if err := output.WritePacket(layers.LinkTypeEthernet, ci, data); err != nil {
+			t.Fatalf("unexpected error - err: %v", err)
+		}
+	}
+	if err := output.close(); err != nil {
+		t.Fatalf("unexpected error - err: %v", err)
+	}
+
+	if len(parts) != 1 {
+		t.Errorf("unexpected number of parts - expected: 1, actual: %d", len(parts))
+	}
+}
@@ -0,0 +1,454 @@
+package cmd
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/creasty/defaults"
+	"github.com/kubeshark/gopacket"
+	"github.com/kubeshark/gopacket/layers"
+	"github.com/kubeshark/gopacket/pcapgo"
+	"github.com/kubeshark/kubeshark/config"
+	"github.com/kubeshark/kubeshark/config/configStructs"
+	"github.com/rs/zerolog/log"
+	"github.com/spf13/cobra"
+)
+
+const (
+	pcapStatsOutputTable = "table"
+	pcapStatsOutputJson  = "json"
+
+	// pcapStatsMaxBuckets bounds the timeline when the interval is picked
+	pcapStatsMaxBuckets = 60
+	// pcapStatsCopyWindow is how far apart the copies of a packet captured on
+	// both nodes of a conversation may be
+	pcapStatsCopyWindow = 200 * time.Millisecond
+)
+
+// pcapStatsIntervals are the timeline intervals picked from
+var pcapStatsIntervals = []time.Duration{
+	time.Second,
+	10 * time.Second,
+	time.Minute,
+	5 * time.Minute,
+	10 * time.Minute,
+	time.Hour,
+	6 * time.Hour,
+	24 * time.Hour,
+}
+
+var pcapStatsCmd = &cobra.Command{
+	Use:   "stats <file>...",
+	Short: "Summarize the traffic in PCAP files, compressed ones included",
+	Long: `Summarize the traffic in PCAP files, compressed ones included.
+
+The files are merged in timestamp order, so the files of several nodes can be
+passed as they are. Nodes are counted in pcapng files only, where pcapdump
+names an interface after every node; pcap files don't tell them.`,
+	Args: cobra.MinimumNArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		output := config.Config.Pcap.Output
+		if output != pcapStatsOutputTable && output != pcapStatsOutputJson {
+			return fmt.Errorf("Invalid output %s, expected %s or %s", output, pcapStatsOutputTable, pcapStatsOutputJson)
+		}
+
+		var interval time.Duration
+		if config.Config.Pcap.Interval != "" {
+			var err error
+			if interval, err = time.ParseDuration(config.Config.Pcap.Interval); err != nil || interval <= 0 {
+				return fmt.Errorf("Invalid --%s: %s", configStructs.IntervalPcapName, config.Config.Pcap.Interval)
+			}
+		}
+
+		collector := newPcapStatsCollector()
+		if err := collector.addFiles(args); err != nil {
+			return err
+		}
+		stats := collector.summary(interval, config.Config.Pcap.Top)
+
+		if output == pcapStatsOutputJson {
+			encoder := json.NewEncoder(os.Stdout)
+			encoder.SetIndent("", "  ")
+			return encoder.Encode(stats)
+		}
+
+		return printPcapStats(os.Stdout, stats)
+	},
+}
+
+// pcapStatsCount is what a talker, a flow, a protocol, a port or a node
+// amounts to.
+type pcapStatsCount struct {
+	Name    string `json:"name"`
+	Packets int64  `json:"packets"`
+	Bytes   int64  `json:"bytes"`
+}
+
+type pcapStatsBucket struct {
+	Start   time.Time `json:"start"`
+	Packets int64     `json:"packets"`
+	Bytes   int64     `json:"bytes"`
+}
+
+// pcapStats summarizes the traffic of captures. Bytes are counted as on the
+// wire, so truncated captures count in full. The copies of packets captured
+// on several nodes count in the traffic, but not as retransmissions or
+// resets.
+type pcapStats struct {
+	Files           []string          `json:"files"`
+	Packets         int64             `json:"packets"`
+	Bytes           int64             `json:"bytes"`
+	First           time.Time         `json:"first"`
+	Last            time.Time         `json:"last"`
+	Interval        string            `json:"interval"`
+	Timeline        []pcapStatsBucket `json:"timeline"`
+	TopTalkers      []pcapStatsCount  `json:"topTalkers"`
+	TopFlows        []pcapStatsCount  `json:"topFlows"`
+	Protocols       []pcapStatsCount  `json:"protocols"`
+	Ports           []pcapStatsCount  `json:"ports"`
+	Nodes           []pcapStatsCount  `json:"nodes"`
+	Duplicates      int64             `json:"duplicates"`
+	Retransmissions int64             `json:"retransmissions"`
+	Resets          int64             `json:"resets"`
+}
+
+type pcapStatsCollector struct {
+	stats     pcapStats
+	seconds   map[int64]*pcapStatsCount
+	talkers   map[string]*pcapStatsCount
+	flows     map[string]*pcapStatsCount
+	protocols map[string]*pcapStatsCount
+	ports     map[string]*pcapStatsCount
+	nodes     map[string]*pcapStatsCount
+
+	// copies holds when the IP packets of the copy window were seen, and
+	// copyOrder the same in timestamp order to expire them, to tell the
+	// copies of packets captured on several nodes from retransmissions
+	copies    map[uint64]time.Time
+	copyOrder []pcapStatsCopy
+	// tcpSeqEnds holds the highest sequence number seen in every direction
+	// of the TCP connections, to tell retransmissions
+	tcpSeqEnds map[string]uint32
+}
+
+func newPcapStatsCollector() *pcapStatsCollector {
+	return &pcapStatsCollector{
+		seconds:    map[int64]*pcapStatsCount{},
+		talkers:    map[string]*pcapStatsCount{},
+		flows:      map[string]*pcapStatsCount{},
+		protocols:  map[string]*pcapStatsCount{},
+		ports:      map[string]*pcapStatsCount{},
+		nodes:      map[string]*pcapStatsCount{},
+		copies:     map[uint64]time.Time{},
+		tcpSeqEnds: map[string]uint32{},
+	}
+}
+
+type pcapStatsCopy struct {
+	key uint64
+	at  time.Time
+}
+
+// copied tells if the IP packet is a copy of one seen within the copy
+// window. The TTL (or hop limit) and the header checksum are left out, as
+// they change on the way from one node to the other.
+func (collector *pcapStatsCollector) copied(network gopacket.NetworkLayer, at time.Time) bool {
+	expired := 0
+	for ; expired < len(collector.copyOrder) && at.Sub(collector.copyOrder[expired].at) > pcapStatsCopyWindow; expired++ {
+		entry := collector.copyOrder[expired]
+		if collector.copies[entry.key].Equal(entry.at) {
+			delete(collector.copies, entry.key)
+		}
+	}
+	collector.copyOrder = collector.copyOrder[expired:]
+
+	header := network.LayerContents()
+	hash := fnv.New64a()
+	switch network.LayerType() {
+	case layers.LayerTypeIPv4:
+		if len(header) < 20 {
+			return false
+		}
+		hash.Write(header[:8])
+		hash.Write(header[9:10])
+		hash.Write(header[12:])
+	case layers.LayerTypeIPv6:
+		if len(header) < 40 {
+			return false
+		}
+		hash.Write(header[:7])
+		hash.Write(header[8:])
+	default:
+		return false
+	}
+	hash.Write(network.LayerPayload())
+	key := hash.Sum64()
+
+	if seen, ok := collector.copies[key]; ok && at.Sub(seen) <= pcapStatsCopyWindow {
+		return true
+	}
+	collector.copies[key] = at
+	collector.copyOrder = append(collector.copyOrder, pcapStatsCopy{key: key, at: at})
+	return false
+}
+
+func countPcapStats(counts map[string]*pcapStatsCount, name string, length int) {
+	count, ok := counts[name]
+	if !ok {
+		count = &pcapStatsCount{Name: name}
+		counts[name] = count
+	}
+	count.Packets++
+	count.Bytes += int64(length)
+}
+
+// addFiles counts the packets of the files, merged in timestamp order like
+// pcapdump merges them, so the files of the nodes can be passed as they are.
+// The nodes are only known in pcapng files, where pcapdump names the
+// interfaces after them.
+func (collector *pcapStatsCollector) addFiles(paths []string) error {
+	var sources []*pcapSource
+	for i, path := range paths {
+		reader, closer, err := openPcapFile(path)
+		if err != nil {
+			return err
+		}
+		defer closer.Close()
+
+		collector.stats.Files = append(collector.stats.Files, path)
+		sources = append(sources, &pcapSource{path: path, index: i, reader: reader})
+	}
+
+	if errs := primePcapSources(sources); len(errs) > 0 {
+		return errors.Join(errs...)
+	}
+
+	return errors.Join(mergeSources(sources, func(source *pcapSource) error {
+		var node string
+		if ngReader, ok := source.reader.(*pcapgo.NgReader); ok {
+			if intf, err := ngReader.Interface(source.ci.InterfaceIndex); err == nil {
+				node, _, _ = strings.Cut(intf.Name, "/")
+			}
+		}
+
+		collector.add(source.reader.LinkType(), source.ci, source.data, node)
+		return nil
+	})...)
+}
+
+func (collector *pcapStatsCollector) add(linkType layers.LinkType, ci gopacket.CaptureInfo, data []byte, node string) {
+	stats := &collector.stats
+	stats.Packets++
+	stats.Bytes += int64(ci.Length)
+	if stats.First.IsZero() || ci.Timestamp.Before(stats.First) {
+		stats.First = ci.Timestamp
+	}
+	if ci.Timestamp.After(stats.Last) {
+		stats.Last = ci.Timestamp
+	}
+
+	second := ci.Timestamp.Unix()
+	if _, ok := collector.seconds[second]; !ok {
+		collector.seconds[second] = &pcapStatsCount{}
+	}
+	collector.seconds[second].Packets++
+	collector.seconds[second].Bytes += int64(ci.Length)
+
+	if node != "" {
+		countPcapStats(collector.nodes, node, ci.Length)
+	}
+
+	packet := gopacket.NewPacket(data, linkType, gopacket.DecodeOptions{Lazy: true, NoCopy: true}, gopacket.UnknownCgroupID, 0)
+	countPcapStats(collector.protocols, pcapStatsProtocol(packet), ci.Length)
+
+	network := packet.NetworkLayer()
+	if network == nil {
+		return
+	}
+	duplicate := collector.copied(network, ci.Timestamp)
+	if duplicate {
+		stats.Duplicates++
+	}
+	src, dst := network.NetworkFlow().Endpoints()
+	countPcapStats(collector.talkers, src.String(), ci.Length)
+	countPcapStats(collector.talkers, dst.String(), ci.Length)
+
+	switch transport := packet.TransportLayer().(type) {
+	case *layers.TCP:
+		flow := fmt.Sprintf("TCP %s:%d > %s:%d", src, transport.SrcPort, dst, transport.DstPort)
+		countPcapStats(collector.flows, flow, ci.Length)
+		countPcapStats(collector.ports, fmt.Sprintf("tcp/%d", min(transport.SrcPort, transport.DstPort)), ci.Length)
+
+		if duplicate {
+			return
+		}
+		if transport.RST {
+			stats.Resets++
+		}
+
+		seqLength := uint32(len(transport.Payload))
+		if transport.SYN {
+			seqLength++
+		}
+		if transport.FIN {
+			seqLength++
+		}
+		if seqLength == 0 {
+			return
+		}
+		seqEnd := transport.Seq + seqLength
+		if highest, ok := collector.tcpSeqEnds[flow]; ok && int32(seqEnd-highest) <= 0 {
+			stats.Retransmissions++
+			return
+		}
+		collector.tcpSeqEnds[flow] = seqEnd
+	case *layers.UDP:
+		countPcapStats(collector.flows, fmt.Sprintf("UDP %s:%d > %s:%d", src, transport.SrcPort, dst, transport.DstPort), ci.Length)
+		countPcapStats(collector.ports, fmt.Sprintf("udp/%d", min(transport.SrcPort, transport.DstPort)), ci.Length)
+	}
+}
+
+// pcapStatsProtocol names the transport protocol of the packet, or the
+// highest layer decoded if it has none.
+func pcapStatsProtocol(packet gopacket.Packet) string {
+	if transport := packet.TransportLayer(); transport != nil {
+		return transport.LayerType().String()
+	}
+
+	protocol := "Unknown"
+	for _, layer := range packet.Layers() {
+		if layer.LayerType() == gopacket.LayerTypePayload || layer.LayerType() == gopacket.LayerTypeDecodeFailure {
+			break
+		}
+		protocol = layer.LayerType().String()
+	}
+
+	return protocol
+}
+
+// topPcapStats sorts the counts by bytes, keeping the top ones if top is
+// positive.
+func topPcapStats(counts map[string]*pcapStatsCount, top int) []pcapStatsCount {
+	sorted := make([]pcapStatsCount, 0, len(counts))
+	for _, count := range counts {
+		sorted = append(sorted, *count)
+	}
+	sort.Slice(sorted, func(i, j int) bool {
+		if sorted[i].Bytes != sorted[j].Bytes {
+			return sorted[i].Bytes > sorted[j].Bytes
+		}
+		return sorted[i].Name < sorted[j].Name
+	})
+
+	if top > 0 && len(sorted) > top {
+		sorted = sorted[:top]
+	}
+
+	return sorted
+}
+
+// summary builds the stats, over the interval if set or else over the
+// shortest one keeping the timeline readable.
+func (collector *pcapStatsCollector) summary(interval time.Duration, top int) pcapStats {
+	stats := collector.stats
+	if interval == 0 {
+		span := stats.Last.Sub(stats.First)
+		interval = pcapStatsIntervals[len(pcapStatsIntervals)-1]
+		for _, candidate := range pcapStatsIntervals {
+			if span/candidate < pcapStatsMaxBuckets {
+				interval = candidate
+				break
+			}
+		}
+	}
+	stats.Interval = interval.String()
+
+	buckets := map[int64]*pcapStatsBucket{}
+	for second, count := range collector.seconds {
+		start := time.Unix(second, 0).Truncate(interval)
+		bucket, ok := buckets[start.Unix()]
+		if !ok {
+			bucket = &pcapStatsBucket{Start: start}
+			buckets[start.Unix()] = bucket
+		}
+		bucket.Packets += count.Packets
+		bucket.Bytes += count.Bytes
+	}
+	for _, bucket := range buckets {
+		stats.Timeline = append(stats.Timeline, *bucket)
+	}
+	sort.Slice(stats.Timeline, func(i, j int) bool { return stats.Timeline[i].Start.Before(stats.Timeline[j].Start) })
+
+	stats.TopTalkers = topPcapStats(collector.talkers, top)
+	stats.TopFlows = topPcapStats(collector.flows, top)
+	stats.Protocols = topPcapStats(collector.protocols, 0)
+	stats.Ports = topPcapStats(collector.ports, top)
+	stats.Nodes = topPcapStats(collector.nodes, 0)
+
+	return stats
+}
+
+func printPcapStats(w io.Writer, stats pcapStats) error {
+	writer := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+
+	fmt.Fprintf(writer, "Files:\t%s\n", strings.Join(stats.Files, ", "))
+	fmt.Fprintf(writer, "Packets:\t%d\n", stats.Packets)
+	fmt.Fprintf(writer, "Bytes:\t%s\n", formatByteSize(stats.Bytes))
+	if stats.Packets > 0 {
+		fmt.Fprintf(writer, "Capture window:\t%s - %s (%s)\n",
+			stats.First.Local().Format(time.DateTime),
+			stats.Last.Local().Format(time.DateTime),
+			stats.Last.Sub(stats.First).Round(time.Second))
+	}
+	fmt.Fprintf(writer, "Duplicates:\t%d\n", stats.Duplicates)
+	fmt.Fprintf(writer, "Retransmissions:\t%d\n", stats.Retransmissions)
+	fmt.Fprintf(writer, "Resets:\t%d\n", stats.Resets)
+
+	fmt.Fprintf(writer, "\nTIME (every %s)\tPACKETS\tBYTES\n", stats.Interval)
+	for _, bucket := range stats.Timeline {
+		fmt.Fprintf(writer, "%s\t%d\t%s\n", bucket.Start.Local().Format(time.DateTime), bucket.Packets, formatByteSize(bucket.Bytes))
+	}
+
+	sections := []struct {
+		title  string
+		counts []pcapStatsCount
+	}{
+		{"TOP TALKERS", stats.TopTalkers},
+		{"TOP FLOWS", stats.TopFlows},
+		{"PROTOCOL", stats.Protocols},
+		{"PORT", stats.Ports},
+		{"NODE", stats.Nodes},
+	}
+	for _, section := range sections {
+		fmt.Fprintf(writer, "\n%s\tPACKETS\tBYTES\n", section.title)
+		for _, count := range section.counts {
+			fmt.Fprintf(writer, "%s\t%d\t%s\n", count.Name, count.Packets, formatByteSize(count.Bytes))
+		}
+	}
+	if len(stats.Nodes) == 0 {
+		fmt.Fprintln(writer, "(nodes are only known in pcapng files, see pcapdump --format pcapng)")
+	}
+
+	return writer.Flush()
+}
+
+func init() {
+	pcapCmd.AddCommand(pcapStatsCmd)
+
+	defaultPcapConfig := configStructs.PcapConfig{}
+	if err := defaults.Set(&defaultPcapConfig); err != nil {
+		log.Debug().Err(err).Send()
+	}
+
+	pcapStatsCmd.Flags().StringP(configStructs.OutputPcapName, "o", defaultPcapConfig.Output, "Output format: table or json")
+	pcapStatsCmd.Flags().Int(configStructs.TopPcapName, defaultPcapConfig.Top, "Number of top talkers, flows and ports to list")
+	pcapStatsCmd.Flags().String(configStructs.IntervalPcapName, defaultPcapConfig.Interval, "Interval of the timeline (e.g. 1m), picked from the capture window if not set")
+}
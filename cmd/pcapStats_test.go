@@ -0,0 +1,122 @@
+package cmd
+
+import (
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/kubeshark/gopacket"
+	"github.com/kubeshark/gopacket/layers"
+	"github.com/kubeshark/gopacket/pcapgo"
+)
+
+func TestPcapStatsCollector(t *testing.T) {
+	base := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	client, server := net.ParseIP("10.244.1.5"), net.ParseIP("10.96.0.10")
+
+	collector := newPcapStatsCollector()
+	add := func(second int, node string, data []byte) {
+		ci := gopacket.CaptureInfo{Timestamp: base.Add(time.Duration(second) * time.Second), CaptureLength: len(data), Length: len(data)}
+		collector.add(layers.LinkTypeEthernet, ci, data, node)
+	}
+
+	request := newTestTCPPacket(t, client, server, []byte("GET / HTTP/1.1\r\n\r\n"))
+	add(0, "node-a", request)
+	add(1, "node-a", request) // Sent again
+	add(90, "node-b", newTestTCPPacket(t, server, client, []byte("HTTP/1.1 200 OK\r\n\r\n")))
+
+	stats := collector.summary(0, 10)
+	if stats.Packets != 3 || stats.Retransmissions != 1 {
+		t.Errorf("unexpected counts - packets: %d, retransmissions: %d", stats.Packets, stats.Retransmissions)
+	}
+	if stats.Interval != "10s" || len(stats.Timeline) != 2 || stats.Timeline[0].Packets != 2 {
+		t.Errorf("unexpected timeline - interval: %s, buckets: %v", stats.Interval, stats.Timeline)
+	}
+	if len(stats.Nodes) != 2 || stats.Nodes[0].Name != "node-a" || stats.Nodes[0].Packets != 2 {
+		t.Errorf("unexpected nodes - %v", stats.Nodes)
+	}
+	if len(stats.Protocols) != 1 || stats.Protocols[0].Name != "TCP" {
+		t.Errorf("unexpected protocols - %v", stats.Protocols)
+	}
+	if len(stats.Ports) != 1 || stats.Ports[0].Name != "tcp/80" || stats.Ports[0].Packets != 3 {
+		t.Errorf("unexpected ports - %v", stats.Ports)
+	}
+	if len(stats.TopFlows) != 2 || stats.TopFlows[0].Name != "TCP 10.244.1.5:43210 > 10.96.0.10:80" {
+		t.Errorf("unexpected flows - %v", stats.TopFlows)
+	}
+	if len(stats.TopTalkers) != 2 || stats.TopTalkers[0].Packets != 3 {
+		t.Errorf("unexpected talkers - %v", stats.TopTalkers)
+	}
+}
+
+func TestPcapStatsCollectorDuplicates(t *testing.T) {
+	base := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	request := newTestTCPPacket(t, net.ParseIP("10.244.1.5"), net.ParseIP("10.244.2.7"), []byte("GET / HTTP/1.1\r\n\r\n"))
+
+	collector := newPcapStatsCollector()
+	for _, capture := range []struct {
+		at   time.Duration
+		node string
+	}{
+		{0, "node-a"},
+		{5 * time.Millisecond, "node-b"}, // Captured on the node of the server too
+		{time.Second, "node-a"},          // Sent again
+	} {
+		ci := gopacket.CaptureInfo{Timestamp: base.Add(capture.at), CaptureLength: len(request), Length: len(request)}
+		collector.add(layers.LinkTypeEthernet, ci, request, capture.node)
+	}
+
+	stats := collector.summary(0, 10)
+	if stats.Packets != 3 || stats.Duplicates != 1 || stats.Retransmissions != 1 {
+		t.Errorf("unexpected counts - packets: %d, duplicates: %d, retransmissions: %d", stats.Packets, stats.Duplicates, stats.Retransmissions)
+	}
+}
+
+func TestPcapStatsCollectorMergesFiles(t *testing.T) {
+	base := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	client, server := net.ParseIP("10.244.1.5"), net.ParseIP("10.244.2.7")
+	request := newTestTCPPacket(t, client, server, []byte("GET / HTTP/1.1\r\n\r\n"))
+	response := newTestTCPPacket(t, server, client, []byte("HTTP/1.1 200 OK\r\n\r\n"))
+
+	dir := t.TempDir()
+	writeFile := func(name string, packets map[time.Duration][]byte, order ...time.Duration) string {
+		path := filepath.Join(dir, name)
+		f, err := os.Create(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer f.Close()
+
+		writer := pcapgo.NewWriter(f)
+		if err := writer.WriteFileHeader(maxSnaplen, layers.LinkTypeEthernet); err != nil {
+			t.Fatal(err)
+		}
+		for _, at := range order {
+			data := packets[at]
+			if err := writer.WritePacket(gopacket.CaptureInfo{Timestamp: base.Add(at), CaptureLength: len(data), Length: len(data)}, data); err != nil {
+				t.Fatal(err)
+			}
+		}
+		return path
+	}
+
+	// The request is captured on both nodes, the second file starts before
+	// the first one ends
+	nodeA := writeFile("node-a.pcap", map[time.Duration][]byte{0: request, time.Second: response}, 0, time.Second)
+	nodeB := writeFile("node-b.pcap", map[time.Duration][]byte{5 * time.Millisecond: request}, 5*time.Millisecond)
+
+	collector := newPcapStatsCollector()
+	if err := collector.addFiles([]string{nodeA, nodeB}); err != nil {
+		t.Fatal(err)
+	}
+
+	stats := collector.summary(0, 10)
+	if stats.Packets != 3 || stats.Duplicates != 1 || stats.Retransmissions != 0 {
+		t.Errorf("unexpected counts - packets: %d, duplicates: %d, retransmissions: %d", stats.Packets, stats.Duplicates, stats.Retransmissions)
+	}
+	if !stats.First.Equal(base) || !stats.Last.Equal(base.Add(time.Second)) {
+		t.Errorf("unexpected window - %s to %s", stats.First, stats.Last)
+	}
+}
@@ -0,0 +1,321 @@
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	"github.com/creasty/defaults"
+	"github.com/kubeshark/kubeshark/config"
+	"github.com/kubeshark/kubeshark/config/configStructs"
+	"github.com/rs/zerolog/log"
+	"github.com/spf13/cobra"
+)
+
+const (
+	snapshotOutputTable = "table"
+	snapshotOutputJson  = "json"
+)
+
+var snapshotCmd = &cobra.Command{
+	Use:   "snapshot",
+	Short: "Manage the traffic snapshots of the Hub, and their copies in the cloud storage",
+}
+
+// hubSnapshotRequest asks the Hub for a snapshot of the capture window.
+type hubSnapshotRequest struct {
+	Name  string
+	Start time.Time
+	End   time.Time
+	Nodes []string
+	Kfl   string
+}
+
+// arguments are the arguments of create_snapshot, leaving the unset ones
+// out so a Hub that doesn't take them only fails when they're used.
+func (request *hubSnapshotRequest) arguments() map[string]any {
+	args := map[string]any{
+		"start_time": request.Start.Format(time.RFC3339),
+		"end_time":   request.End.Format(time.RFC3339),
+	}
+	if request.Name != "" {
+		args["name"] = request.Name
+	}
+	if len(request.Nodes) > 0 {
+		args["nodes"] = request.Nodes
+	}
+	if request.Kfl != "" {
+		args["kfl"] = request.Kfl
+	}
+	return args
+}
+
+// hubSnapshotList is the result of list_snapshots, either the snapshots or
+// an object holding them.
+type hubSnapshotList []hubSnapshot
+
+func (list *hubSnapshotList) UnmarshalJSON(data []byte) error {
+	var snapshots []hubSnapshot
+	if err := json.Unmarshal(data, &snapshots); err == nil {
+		*list = snapshots
+		return nil
+	}
+
+	var result struct {
+		Snapshots []hubSnapshot `json:"snapshots"`
+	}
+	if err := json.Unmarshal(data, &result); err != nil {
+		return err
+	}
+	*list = result.Snapshots
+	return nil
+}
+
+// snapshotArguments are the arguments of the tools about a snapshot.
+func snapshotArguments(id string) map[string]any {
+	return map[string]any{"snapshot_id": id}
+}
+
+var snapshotCreateCmd = &cobra.Command{
+	Use:   "create",
+	Short: "Create a snapshot of a time window of the traffic",
+	Example: `  kubeshark snapshot create --time 15m --name checkout-incident
+  kubeshark snapshot create --from "2024-05-01 14:30" --to "2024-05-01 14:45" --kfl 'http && status_code >= 500' --wait`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		request, err := snapshotCreateRequest(time.Now())
+		if err != nil {
+			return err
+		}
+
+		hub, err := newHubClient()
+		if err != nil {
+			return err
+		}
+
+		var snapshot hubSnapshot
+		if err := hub.callTool(cmd.Context(), "create_snapshot", request.arguments(), &snapshot); err != nil {
+			return fmt.Errorf("failed creating the snapshot: %w", err)
+		}
+		log.Info().Str("snapshot", snapshot.ID).Str("name", snapshot.Name).Str("status", snapshot.Status).Msg("Created the snapshot.")
+
+		if config.Config.Snapshot.Wait {
+			return awaitSnapshot(cmd.Context(), hub, snapshot.ID)
+		}
+		return nil
+	},
+}
+
+// snapshotCreateRequest builds the request out of the flags. The window is
+// either from --from to --to, now if not set, or the --time before now.
+func snapshotCreateRequest(now time.Time) (*hubSnapshotRequest, error) {
+	snapshotConfig := config.Config.Snapshot
+	request := &hubSnapshotRequest{
+		Name:  snapshotConfig.Name,
+		End:   now,
+		Nodes: snapshotConfig.Nodes,
+		Kfl:   snapshotConfig.Kfl,
+	}
+
+	switch {
+	case snapshotConfig.Time != "" && (snapshotConfig.From != "" || snapshotConfig.To != ""):
+		return nil, fmt.Errorf("--%s can't be used with --%s or --%s", configStructs.TimeSnapshotName, configStructs.FromSnapshotName, configStructs.ToSnapshotName)
+	case snapshotConfig.Time != "":
+		duration, err := time.ParseDuration(snapshotConfig.Time)
+		if err != nil || duration <= 0 {
+			return nil, fmt.Errorf("Invalid --%s: %s", configStructs.TimeSnapshotName, snapshotConfig.Time)
+		}
+		request.Start = now.Add(-duration)
+	case snapshotConfig.From != "":
+		from, err := parsePcapWindowTime(snapshotConfig.From)
+		if err != nil {
+			return nil, fmt.Errorf("Invalid --%s: %w", configStructs.FromSnapshotName, err)
+		}
+		to, err := parsePcapWindowTime(snapshotConfig.To)
+		if err != nil {
+			return nil, fmt.Errorf("Invalid --%s: %w", configStructs.ToSnapshotName, err)
+		}
+		request.Start = *from
+		if to != nil {
+			request.End = *to
+		}
+	default:
+		return nil, fmt.Errorf("Set the window with --%s, or --%s and --%s", configStructs.TimeSnapshotName, configStructs.FromSnapshotName, configStructs.ToSnapshotName)
+	}
+
+	if !request.Start.Before(request.End) {
+		return nil, fmt.Errorf("The start of the window %s isn't before its end %s", request.Start.Format(time.RFC3339), request.End.Format(time.RFC3339))
+	}
+
+	request.Start, request.End = request.Start.UTC(), request.End.UTC()
+	return request, nil
+}
+
+// awaitSnapshot waits for the Hub to complete the snapshot.
+func awaitSnapshot(ctx context.Context, hub *hubClient, id string) error {
+	ticker := time.NewTicker(hubPollInterval)
+	defer ticker.Stop()
+	lastReport := time.Now()
+	for {
+		var snapshot hubSnapshot
+		if err := hub.callTool(ctx, "get_snapshot", snapshotArguments(id), &snapshot); err != nil {
+			return err
+		}
+
+		switch snapshot.Status {
+		case hubSnapshotCompleted:
+			log.Info().Str("snapshot", id).Str("size", formatByteSize(snapshot.Size)).Msg("The snapshot is completed.")
+			return nil
+		case hubSnapshotFailed:
+			return fmt.Errorf("the snapshot failed: %s", snapshot.Error)
+		}
+		if time.Since(lastReport) >= hubProgressInterval {
+			log.Info().Str("snapshot", id).Str("status", snapshot.Status).Msg("Waiting for the snapshot...")
+			lastReport = time.Now()
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
+
+var snapshotListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "List the snapshots on the Hub, or in the cloud storage",
+	Args:  cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		output := config.Config.Snapshot.Output
+		if output != snapshotOutputTable && output != snapshotOutputJson {
+			return fmt.Errorf("Invalid output %s, expected %s or %s", output, snapshotOutputTable, snapshotOutputJson)
+		}
+
+		hub, err := newHubClient()
+		if err != nil {
+			return err
+		}
+
+		toolArgs := map[string]any{}
+		if config.Config.Snapshot.Cloud {
+			toolArgs["source"] = "cloud"
+		}
+		var snapshots hubSnapshotList
+		if err := hub.callTool(cmd.Context(), "list_snapshots", toolArgs, &snapshots); err != nil {
+			return fmt.Errorf("failed listing the snapshots: %w", err)
+		}
+
+		if output == snapshotOutputJson {
+			encoder := json.NewEncoder(os.Stdout)
+			encoder.SetIndent("", "  ")
+			return encoder.Encode(snapshots)
+		}
+
+		return printSnapshots(os.Stdout, []hubSnapshot(snapshots))
+	},
+}
+
+func printSnapshots(w io.Writer, snapshots []hubSnapshot) error {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "ID\tNAME\tSTATUS\tSIZE\tNODES\tSTART\tEND")
+	for _, snapshot := range snapshots {
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%d\t%s\t%s\n",
+			snapshot.ID,
+			snapshot.Name,
+			snapshot.Status,
+			formatByteSize(snapshot.Size),
+			len(snapshot.Nodes),
+			snapshot.Start.Local().Format(time.DateTime),
+			snapshot.End.Local().Format(time.DateTime),
+		)
+	}
+	return tw.Flush()
+}
+
+var snapshotDeleteCmd = &cobra.Command{
+	Use:   "delete <id>...",
+	Short: "Delete snapshots from the Hub",
+	Args:  cobra.MinimumNArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		hub, err := newHubClient()
+		if err != nil {
+			return err
+		}
+
+		for _, id := range args {
+			if err := hub.callTool(cmd.Context(), "delete_snapshot", snapshotArguments(id), nil); err != nil {
+				return fmt.Errorf("failed deleting %s: %w", id, err)
+			}
+			log.Info().Str("snapshot", id).Msg("Deleted the snapshot.")
+		}
+		return nil
+	},
+}
+
+var snapshotUploadCmd = &cobra.Command{
+	Use:   "upload <id>",
+	Short: "Upload a snapshot to the cloud storage of tap.snapshots.cloud",
+	Args:  cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		hub, err := newHubClient()
+		if err != nil {
+			return err
+		}
+
+		var snapshot hubSnapshot
+		if err := hub.callTool(cmd.Context(), "upload_snapshot_to_cloud", snapshotArguments(args[0]), &snapshot); err != nil {
+			return fmt.Errorf("failed uploading %s: %w", args[0], err)
+		}
+		log.Info().Str("snapshot", snapshot.ID).Str("name", snapshot.Name).Msg("Uploaded the snapshot to the cloud storage.")
+		return nil
+	},
+}
+
+var snapshotRestoreCmd = &cobra.Command{
+	Use:   "restore <id>",
+	Short: "Restore a snapshot from the cloud storage to the Hub, possibly of another cluster",
+	Args:  cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		hub, err := newHubClient()
+		if err != nil {
+			return err
+		}
+
+		var snapshot hubSnapshot
+		if err := hub.callTool(cmd.Context(), "download_snapshot_from_cloud", snapshotArguments(args[0]), &snapshot); err != nil {
+			return fmt.Errorf("failed restoring %s: %w", args[0], err)
+		}
+		log.Info().Str("snapshot", snapshot.ID).Str("name", snapshot.Name).Str("status", snapshot.Status).Msg("Restoring the snapshot.")
+
+		if config.Config.Snapshot.Wait {
+			return awaitSnapshot(cmd.Context(), hub, snapshot.ID)
+		}
+		return nil
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(snapshotCmd)
+	snapshotCmd.AddCommand(snapshotCreateCmd, snapshotListCmd, snapshotDeleteCmd, snapshotUploadCmd, snapshotRestoreCmd)
+
+	defaultSnapshotConfig := configStructs.SnapshotConfig{}
+	if err := defaults.Set(&defaultSnapshotConfig); err != nil {
+		log.Debug().Err(err).Send()
+	}
+
+	snapshotCreateCmd.Flags().String(configStructs.NameSnapshotName, defaultSnapshotConfig.Name, "Name of the snapshot")
+	snapshotCreateCmd.Flags().String(configStructs.TimeSnapshotName, defaultSnapshotConfig.Time, "Time window (e.g. 10m, 1h) before now")
+	snapshotCreateCmd.Flags().String(configStructs.FromSnapshotName, defaultSnapshotConfig.From, "Start of the time window, RFC3339 or local time (e.g. \"2024-05-01 14:30\") in the configured timezone")
+	snapshotCreateCmd.Flags().String(configStructs.ToSnapshotName, defaultSnapshotConfig.To, "End of the time window, RFC3339 or local time in the configured timezone, now if not set")
+	snapshotCreateCmd.Flags().StringSlice(configStructs.NodesSnapshotName, defaultSnapshotConfig.Nodes, "Capture only the traffic of the nodes, all of them if not set")
+	snapshotCreateCmd.Flags().String(configStructs.KflSnapshotName, defaultSnapshotConfig.Kfl, "Keep only the traffic matching the KFL filter (e.g. 'http && status_code >= 500')")
+	snapshotCreateCmd.Flags().Bool(configStructs.WaitSnapshotName, defaultSnapshotConfig.Wait, "Wait for the snapshot to be completed")
+	snapshotRestoreCmd.Flags().Bool(configStructs.WaitSnapshotName, defaultSnapshotConfig.Wait, "Wait for the snapshot to be restored")
+	snapshotListCmd.Flags().StringP(configStructs.OutputSnapshotName, "o", defaultSnapshotConfig.Output, "Output format: table or json")
+	snapshotListCmd.Flags().Bool(configStructs.CloudSnapshotName, defaultSnapshotConfig.Cloud, "List the snapshots in the cloud storage instead")
+}
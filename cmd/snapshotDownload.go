@@ -0,0 +1,253 @@
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/creasty/defaults"
+	"github.com/kubeshark/kubeshark/config"
+	"github.com/kubeshark/kubeshark/config/configStructs"
+	"github.com/rs/zerolog/log"
+	"github.com/spf13/cobra"
+)
+
+const (
+	// snapshotDownloadAttempts is how many times an interrupted download is
+	// resumed before giving up
+	snapshotDownloadAttempts = 5
+	snapshotDownloadBackoff  = 2 * time.Second
+
+	// partialDownloadSuffix marks a download in progress, which is resumed
+	// from where it stopped
+	partialDownloadSuffix = ".part"
+	// validatorSuffix marks the ETag or Last-Modified of the file a partial
+	// download holds the start of, so it's only resumed if unchanged
+	validatorSuffix = ".validator"
+)
+
+var snapshotDownloadCmd = &cobra.Command{
+	Use:   "download <id>",
+	Short: "Download the PCAP of a snapshot from the Hub, resuming an interrupted download",
+	Args:  cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		dest := config.Config.Snapshot.Write
+		if dest == "" {
+			dest = snapshotPcapName(args[0])
+		}
+
+		hub, err := newHubClient()
+		if err != nil {
+			return err
+		}
+
+		size, err := downloadSnapshot(cmd.Context(), hub, args[0], dest)
+		if err != nil {
+			return err
+		}
+
+		log.Info().Str("snapshot", args[0]).Str("file", dest).Str("size", formatByteSize(size)).Msg("Downloaded the snapshot.")
+		return nil
+	},
+}
+
+// snapshotPcapName is where a snapshot is downloaded to by default.
+func snapshotPcapName(id string) string {
+	return strings.NewReplacer("/", "_", string(os.PathSeparator), "_").Replace(id) + ".pcap"
+}
+
+// exportSnapshotPcap has the Hub export the PCAP of the snapshot, returning
+// the path of the file under the API, like the MCP download_file tool takes.
+func exportSnapshotPcap(ctx context.Context, hub *hubClient, id string) (string, error) {
+	var result string
+	if err := hub.callTool(ctx, "export_snapshot_pcap", snapshotArguments(id), &result); err != nil {
+		return "", fmt.Errorf("failed exporting %s: %w", id, err)
+	}
+
+	var export struct {
+		Path string `json:"path"`
+	}
+	if json.Unmarshal([]byte(result), &export) == nil && export.Path != "" {
+		result = export.Path
+	}
+	result = strings.TrimSpace(result)
+	if !strings.HasPrefix(result, "/") {
+		return "", fmt.Errorf("unexpected result of export_snapshot_pcap: %s", result)
+	}
+	return result, nil
+}
+
+// downloadSnapshot exports the PCAP of the snapshot and streams it into a
+// partial file next to dest, resuming it on failures, and on later runs, from
+// where it stopped. dest is written once the download completes. It returns
+// the size of the PCAP.
+func downloadSnapshot(ctx context.Context, hub *hubClient, id string, dest string) (int64, error) {
+	path, err := exportSnapshotPcap(ctx, hub, id)
+	if err != nil {
+		return 0, err
+	}
+
+	partial := dest + partialDownloadSuffix
+	for attempt := 1; attempt <= snapshotDownloadAttempts; attempt++ {
+		var complete bool
+		complete, err = downloadSnapshotPart(ctx, hub, path, partial)
+		if complete {
+			break
+		}
+		if ctx.Err() != nil {
+			return 0, ctx.Err()
+		}
+
+		var apiErr *hubAPIError
+		if errors.As(err, &apiErr) && apiErr.statusCode != http.StatusRequestedRangeNotSatisfiable {
+			return 0, fmt.Errorf("failed downloading %s: %w", id, err)
+		}
+		log.Warn().Err(err).Int("attempt", attempt).Msg("The download was interrupted, resuming...")
+		select {
+		case <-ctx.Done():
+			return 0, ctx.Err()
+		case <-time.After(snapshotDownloadBackoff):
+		}
+	}
+	if err != nil {
+		return 0, fmt.Errorf("failed downloading %s, run again to resume: %w", id, err)
+	}
+
+	info, err := os.Stat(partial)
+	if err != nil {
+		return 0, err
+	}
+	if err := os.Rename(partial, dest); err != nil {
+		return 0, err
+	}
+	os.Remove(partial + validatorSuffix)
+	return info.Size(), nil
+}
+
+// downloadSnapshotPart downloads the rest of the file into the partial file,
+// asking the Hub for the range after what it holds already if the file is
+// unchanged since. It tells whether the file is complete.
+func downloadSnapshotPart(ctx context.Context, hub *hubClient, path string, partial string) (bool, error) {
+	var offset int64
+	if info, err := os.Stat(partial); err == nil {
+		offset = info.Size()
+	}
+	validator, _ := os.ReadFile(partial + validatorSuffix)
+
+	request, err := http.NewRequestWithContext(ctx, http.MethodGet, hub.apiURL+path, nil)
+	if err != nil {
+		return false, err
+	}
+	if offset > 0 && len(validator) > 0 {
+		request.Header.Set("Range", fmt.Sprintf("bytes=%d-", offset))
+		request.Header.Set("If-Range", string(validator))
+	}
+
+	response, err := hub.do(hub.streamClient, request)
+	if err != nil {
+		var apiErr *hubAPIError
+		if errors.As(err, &apiErr) && apiErr.statusCode == http.StatusRequestedRangeNotSatisfiable && offset > 0 {
+			// The file is unchanged, so the partial file holds all of it
+			// already if it's as long, or else something else to start over
+			if parseContentRangeTotal(apiErr.header.Get("Content-Range")) == offset {
+				return true, nil
+			}
+			os.Remove(partial)
+			os.Remove(partial + validatorSuffix)
+		}
+		return false, err
+	}
+	defer response.Body.Close()
+
+	flags := os.O_CREATE | os.O_WRONLY | os.O_APPEND
+	total := response.ContentLength
+	if response.StatusCode == http.StatusPartialContent {
+		if contentRangeTotal := parseContentRangeTotal(response.Header.Get("Content-Range")); contentRangeTotal > 0 {
+			total = contentRangeTotal
+		} else if total >= 0 {
+			total += offset
+		}
+	} else {
+		// The Hub sent the whole file, which changed or can't be resumed
+		flags = os.O_CREATE | os.O_WRONLY | os.O_TRUNC
+		offset = 0
+		if err := saveDownloadValidator(partial, response.Header); err != nil {
+			return false, err
+		}
+	}
+
+	file, err := os.OpenFile(partial, flags, 0644)
+	if err != nil {
+		return false, err
+	}
+
+	if offset > 0 {
+		log.Info().Str("file", partial).Str("offset", formatByteSize(offset)).Msg("Resuming the download...")
+	}
+	progress := newTransferProgress("Downloading...", partial, offset, total)
+	_, err = io.Copy(io.MultiWriter(file, progress), response.Body)
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return false, err
+	}
+	progress.report()
+
+	if total >= 0 && progress.done != total {
+		return false, fmt.Errorf("the download stopped at %d of %d bytes", progress.done, total)
+	}
+	return true, nil
+}
+
+// saveDownloadValidator keeps the strong ETag, or else the Last-Modified, of
+// the file next to the partial file. A file without either can't be resumed.
+func saveDownloadValidator(partial string, header http.Header) error {
+	validator := header.Get("ETag")
+	if strings.HasPrefix(validator, "W/") {
+		validator = ""
+	}
+	if validator == "" {
+		validator = header.Get("Last-Modified")
+	}
+
+	if validator == "" {
+		if err := os.Remove(partial + validatorSuffix); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		return nil
+	}
+	return os.WriteFile(partial+validatorSuffix, []byte(validator), 0644)
+}
+
+// parseContentRangeTotal returns the complete length of a Content-Range
+// header such as "bytes 100-199/200", or -1 if it's unknown.
+func parseContentRangeTotal(contentRange string) int64 {
+	_, total, ok := strings.Cut(contentRange, "/")
+	if !ok {
+		return -1
+	}
+	value, err := strconv.ParseInt(total, 10, 64)
+	if err != nil {
+		return -1
+	}
+	return value
+}
+
+func init() {
+	snapshotCmd.AddCommand(snapshotDownloadCmd)
+
+	defaultSnapshotConfig := configStructs.SnapshotConfig{}
+	if err := defaults.Set(&defaultSnapshotConfig); err != nil {
+		log.Debug().Err(err).Send()
+	}
+
+	snapshotDownloadCmd.Flags().StringP(configStructs.WriteSnapshotName, "w", defaultSnapshotConfig.Write, "Write the PCAP of the snapshot to the file, <id>.pcap if not set")
+}
@@ -0,0 +1,187 @@
+package cmd
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/kubeshark/kubeshark/config"
+	"github.com/kubeshark/kubeshark/config/configStructs"
+)
+
+// snapshotTestServer exports the PCAP of snap-1 through the MCP tools and
+// serves it with its ETag, dropping the connection halfway through the first
+// download.
+type snapshotTestServer struct {
+	pcap     []byte
+	etag     string
+	requests []*http.Request
+}
+
+func (server *snapshotTestServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	switch r.URL.Path {
+	case "/api/mcp":
+		_ = json.NewEncoder(w).Encode(hubMCPResponse{Tools: []hubMCPTool{
+			{Name: "export_snapshot_pcap", InputSchema: json.RawMessage(`{"type":"object","properties":{"snapshot_id":{"type":"string"}}}`)},
+		}})
+	case "/api/mcp/tools/call":
+		_ = json.NewEncoder(w).Encode(map[string]string{"path": "/snapshots/snap-1/export.pcap"})
+	case "/api/snapshots/snap-1/export.pcap":
+		server.requests = append(server.requests, r)
+		w.Header().Set("ETag", server.etag)
+		if len(server.requests) == 1 {
+			w.Header().Set("Content-Length", strconv.Itoa(len(server.pcap)))
+			_, _ = w.Write(server.pcap[:len(server.pcap)/2])
+			panic(http.ErrAbortHandler)
+		}
+		http.ServeContent(w, r, "export.pcap", time.Time{}, bytes.NewReader(server.pcap))
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+func newSnapshotTestHub(t *testing.T, server *snapshotTestServer) *hubClient {
+	t.Helper()
+
+	httpServer := httptest.NewServer(server)
+	t.Cleanup(httpServer.Close)
+	return &hubClient{frontURL: httpServer.URL, apiURL: httpServer.URL + "/api", client: httpServer.Client(), streamClient: httpServer.Client()}
+}
+
+func TestDownloadSnapshotResumes(t *testing.T) {
+	server := &snapshotTestServer{pcap: bytes.Repeat([]byte("kubeshark snapshot "), 10000), etag: `"v1"`}
+	hub := newSnapshotTestHub(t, server)
+
+	dest := filepath.Join(t.TempDir(), snapshotPcapName("snap-1"))
+	size, err := downloadSnapshot(t.Context(), hub, "snap-1", dest)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(server.requests) != 2 || server.requests[0].Header.Get("Range") != "" ||
+		server.requests[1].Header.Get("Range") != "bytes=95000-" || server.requests[1].Header.Get("If-Range") != `"v1"` {
+		t.Fatalf("unexpected requests - %d", len(server.requests))
+	}
+	downloaded, err := os.ReadFile(dest)
+	if err != nil || size != int64(len(server.pcap)) || !bytes.Equal(downloaded, server.pcap) {
+		t.Errorf("unexpected download - size: %d, %v", size, err)
+	}
+	for _, leftover := range []string{dest + partialDownloadSuffix, dest + partialDownloadSuffix + validatorSuffix} {
+		if _, err := os.Stat(leftover); !os.IsNotExist(err) {
+			t.Errorf("expected %s to be gone, got %v", leftover, err)
+		}
+	}
+}
+
+func TestDownloadSnapshotRegenerated(t *testing.T) {
+	server := &snapshotTestServer{pcap: bytes.Repeat([]byte("regenerated pcap "), 10000), etag: `"v2"`}
+	// The first request of the server is the one dropped, which already
+	// happened on an earlier run
+	server.requests = append(server.requests, nil)
+	hub := newSnapshotTestHub(t, server)
+
+	dest := filepath.Join(t.TempDir(), snapshotPcapName("snap-1"))
+	partial := dest + partialDownloadSuffix
+	if err := os.WriteFile(partial, bytes.Repeat([]byte("x"), 1000), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(partial+validatorSuffix, []byte(`"v1"`), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := downloadSnapshot(t.Context(), hub, "snap-1", dest); err != nil {
+		t.Fatal(err)
+	}
+
+	if server.requests[1].Header.Get("If-Range") != `"v1"` {
+		t.Errorf("expected the resume to be conditional - If-Range: %q", server.requests[1].Header.Get("If-Range"))
+	}
+	downloaded, err := os.ReadFile(dest)
+	if err != nil || !bytes.Equal(downloaded, server.pcap) {
+		t.Errorf("expected the regenerated PCAP to replace the partial file - size: %d, %v", len(downloaded), err)
+	}
+}
+
+func TestDownloadSnapshotCompletePartial(t *testing.T) {
+	server := &snapshotTestServer{pcap: bytes.Repeat([]byte("kubeshark snapshot "), 100), etag: `"v1"`}
+	server.requests = append(server.requests, nil)
+	hub := newSnapshotTestHub(t, server)
+
+	// An earlier run stopped right before renaming the partial file
+	dest := filepath.Join(t.TempDir(), snapshotPcapName("snap-1"))
+	partial := dest + partialDownloadSuffix
+	if err := os.WriteFile(partial, server.pcap, 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(partial+validatorSuffix, []byte(`"v1"`), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	size, err := downloadSnapshot(t.Context(), hub, "snap-1", dest)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(server.requests) != 2 {
+		t.Errorf("expected a single request - requests: %d", len(server.requests)-1)
+	}
+	downloaded, err := os.ReadFile(dest)
+	if err != nil || size != int64(len(server.pcap)) || !bytes.Equal(downloaded, server.pcap) {
+		t.Errorf("expected the partial file to be kept as complete - size: %d, %v", size, err)
+	}
+}
+
+func TestHubSnapshotList(t *testing.T) {
+	for _, body := range []string{
+		`[{"id":"snap-1"},{"id":"snap-2"}]`,
+		`{"snapshots":[{"id":"snap-1"},{"id":"snap-2"}]}`,
+	} {
+		var list hubSnapshotList
+		if err := json.Unmarshal([]byte(body), &list); err != nil {
+			t.Fatalf("unexpected error of %s - err: %v", body, err)
+		}
+		if len(list) != 2 || list[1].ID != "snap-2" {
+			t.Errorf("unexpected snapshots of %s - %+v", body, list)
+		}
+	}
+}
+
+func TestSnapshotCreateRequest(t *testing.T) {
+	defer func() { config.Config.Snapshot = configStructs.SnapshotConfig{} }()
+	now := time.Date(2024, 5, 1, 15, 0, 0, 0, time.UTC)
+
+	config.Config.Snapshot = configStructs.SnapshotConfig{Time: "15m", Kfl: "http && status_code >= 500"}
+	request, err := snapshotCreateRequest(now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !request.Start.Equal(now.Add(-15*time.Minute)) || !request.End.Equal(now) || request.Kfl != "http && status_code >= 500" {
+		t.Errorf("unexpected request - %+v", request)
+	}
+
+	config.Config.Snapshot = configStructs.SnapshotConfig{From: "2024-05-01T14:30:00Z", To: "2024-05-01T14:45:00Z"}
+	request, err = snapshotCreateRequest(now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if request.End.Sub(request.Start) != 15*time.Minute {
+		t.Errorf("unexpected window - %s to %s", request.Start, request.End)
+	}
+
+	for _, invalid := range []configStructs.SnapshotConfig{
+		{},
+		{Time: "15m", From: "2024-05-01T14:30:00Z"},
+		{From: "2024-05-01T15:30:00Z"},
+	} {
+		config.Config.Snapshot = invalid
+		if _, err := snapshotCreateRequest(now); err == nil {
+			t.Errorf("expected %+v to be invalid", invalid)
+		}
+	}
+}
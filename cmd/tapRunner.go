@@ -453,17 +453,40 @@ func postFrontStarted(ctx context.Context, kubernetesProvider *kubernetes.Provid
 }
 
 func updateConfig(kubernetesProvider *kubernetes.Provider) {
-	_, _ = kubernetes.SetSecret(kubernetesProvider, kubernetes.SECRET_LICENSE, config.Config.License)
-	_, _ = kubernetes.SetConfig(kubernetesProvider, kubernetes.CONFIG_POD_REGEX, config.Config.Tap.PodRegexStr)
-	_, _ = kubernetes.SetConfig(kubernetesProvider, kubernetes.CONFIG_NAMESPACES, strings.Join(config.Config.Tap.Namespaces, ","))
-	_, _ = kubernetes.SetConfig(kubernetesProvider, kubernetes.CONFIG_EXCLUDED_NAMESPACES, strings.Join(config.Config.Tap.ExcludedNamespaces, ","))
+	_, _ = kubernetes.SetSecret(kubernetesProvider, kubernetes.SECRET_LICENSE, config.Config.LicenseKey())
 
-	data, err := json.Marshal(config.Config.Scripting.Env)
+	values, err := liveConfigValues()
 	if err != nil {
-		log.Error().Str("config", kubernetes.CONFIG_SCRIPTING_ENV).Err(err).Send()
+		log.Error().Err(err).Send()
 		return
-	} else {
-		_, _ = kubernetes.SetConfig(kubernetesProvider, kubernetes.CONFIG_SCRIPTING_ENV, string(data))
+	}
+
+	for _, key := range liveConfigKeys {
+		_, _ = kubernetes.SetConfig(kubernetesProvider, key, values[key])
+	}
+}
+
+// liveConfigKeys are the config-map keys updateConfig keeps in sync with the
+// local config when an existing installation is reused.
+var liveConfigKeys = []string{
+	kubernetes.CONFIG_POD_REGEX,
+	kubernetes.CONFIG_NAMESPACES,
+	kubernetes.CONFIG_EXCLUDED_NAMESPACES,
+	kubernetes.CONFIG_SCRIPTING_ENV,
+	kubernetes.CONFIG_INGRESS_ENABLED,
+	kubernetes.CONFIG_INGRESS_HOST,
+	kubernetes.CONFIG_PROXY_FRONT_PORT,
+	kubernetes.CONFIG_AUTH_ENABLED,
+	kubernetes.CONFIG_AUTH_TYPE,
+	kubernetes.CONFIG_AUTH_SAML_IDP_METADATA_URL,
+}
+
+// liveConfigValues renders the local config as the config-map values of
+// liveConfigKeys.
+func liveConfigValues() (map[string]string, error) {
+	scriptingEnv, err := json.Marshal(config.Config.Scripting.Env)
+	if err != nil {
+		return nil, fmt.Errorf("failed marshalling %s, %w", kubernetes.CONFIG_SCRIPTING_ENV, err)
 	}
 
 	ingressEnabled := ""
@@ -476,12 +499,16 @@ func updateConfig(kubernetesProvider *kubernetes.Provider) {
 		authEnabled = "true"
 	}
 
-	_, _ = kubernetes.SetConfig(kubernetesProvider, kubernetes.CONFIG_INGRESS_ENABLED, ingressEnabled)
-	_, _ = kubernetes.SetConfig(kubernetesProvider, kubernetes.CONFIG_INGRESS_HOST, config.Config.Tap.Ingress.Host)
-
-	_, _ = kubernetes.SetConfig(kubernetesProvider, kubernetes.CONFIG_PROXY_FRONT_PORT, fmt.Sprint(config.Config.Tap.Proxy.Front.Port))
-
-	_, _ = kubernetes.SetConfig(kubernetesProvider, kubernetes.CONFIG_AUTH_ENABLED, authEnabled)
-	_, _ = kubernetes.SetConfig(kubernetesProvider, kubernetes.CONFIG_AUTH_TYPE, config.Config.Tap.Auth.Type)
-	_, _ = kubernetes.SetConfig(kubernetesProvider, kubernetes.CONFIG_AUTH_SAML_IDP_METADATA_URL, config.Config.Tap.Auth.Saml.IdpMetadataUrl)
+	return map[string]string{
+		kubernetes.CONFIG_POD_REGEX:                  config.Config.Tap.PodRegexStr,
+		kubernetes.CONFIG_NAMESPACES:                 strings.Join(config.Config.Tap.Namespaces, ","),
+		kubernetes.CONFIG_EXCLUDED_NAMESPACES:        strings.Join(config.Config.Tap.ExcludedNamespaces, ","),
+		kubernetes.CONFIG_SCRIPTING_ENV:              string(scriptingEnv),
+		kubernetes.CONFIG_INGRESS_ENABLED:            ingressEnabled,
+		kubernetes.CONFIG_INGRESS_HOST:               config.Config.Tap.Ingress.Host,
+		kubernetes.CONFIG_PROXY_FRONT_PORT:           fmt.Sprint(config.Config.Tap.Proxy.Front.Port),
+		kubernetes.CONFIG_AUTH_ENABLED:               authEnabled,
+		kubernetes.CONFIG_AUTH_TYPE:                  config.Config.Tap.Auth.Type,
+		kubernetes.CONFIG_AUTH_SAML_IDP_METADATA_URL: config.Config.Tap.Auth.Saml.IdpMetadataUrl,
+	}, nil
 }
@@ -10,6 +10,7 @@ import (
 	"reflect"
 	"strconv"
 	"strings"
+	"time"
 
 	"github.com/creasty/defaults"
 	"github.com/goccy/go-yaml"
@@ -35,6 +36,7 @@ var (
 	Config         ConfigStruct
 	DebugMode      bool
 	cmdName        string
+	initCmd        *cobra.Command
 	ConfigFilePath string
 )
 
@@ -68,17 +70,9 @@ func InitConfig(cmd *cobra.Command) error {
 	if DebugMode {
 		Config.LogLevel = "debug"
 	}
-	cmdName = cmd.Name()
-	if utils.Contains([]string{
-		"clean",
-		"console",
-		"pro",
-		"proxy",
-		"scripts",
-		"pprof",
-	}, cmdName) {
-		cmdName = "tap"
-	}
+	initCmd = cmd
+	appliedContext = ""
+	cmdName = configSectionName(cmd)
 
 	if err := defaults.Set(&Config); err != nil {
 		return err
@@ -97,11 +91,33 @@ func InitConfig(cmd *cobra.Command) error {
 
 	cmd.Flags().Visit(initFlag)
 
-	log.Debug().Interface("config", Config).Msg("Init config is finished.")
+	log.Debug().Interface("config", Config.Masked()).Msg("Init config is finished.")
 
 	return nil
 }
 
+// configSectionName is the section of the config the flags of the command
+// belong to.
+func configSectionName(cmd *cobra.Command) string {
+	if utils.Contains([]string{
+		"clean",
+		"console",
+		"diff",
+		"pro",
+		"proxy",
+		"scripts",
+		"pprof",
+	}, cmd.Name()) {
+		return "tap"
+	}
+	// Flags of the config, pcapdump, pcap and snapshot subcommands belong to their parent's section.
+	if cmd.HasParent() && utils.Contains([]string{"config", "pcapdump", "pcap", "snapshot"}, cmd.Parent().Name()) {
+		return cmd.Parent().Name()
+	}
+
+	return cmd.Name()
+}
+
 func GetConfigWithDefaults() (*ConfigStruct, error) {
 	defaultConf := ConfigStruct{}
 	if err := defaults.Set(&defaultConf); err != nil {
@@ -115,7 +131,12 @@ func GetConfigWithDefaults() (*ConfigStruct, error) {
 }
 
 func WriteConfig(config *ConfigStruct) error {
-	template, err := utils.PrettyYaml(config)
+	encrypted, err := config.withEncryptedSecrets()
+	if err != nil {
+		return err
+	}
+
+	template, err := utils.PrettyYaml(encrypted)
 	if err != nil {
 		return fmt.Errorf("failed converting config to yaml, err: %v", err)
 	}
@@ -129,13 +150,39 @@ func WriteConfig(config *ConfigStruct) error {
 		}
 	}
 
-	if err := os.WriteFile(ConfigFilePath, data, 0644); err != nil {
+	if err := os.WriteFile(ConfigFilePath, data, 0600); err != nil {
 		return fmt.Errorf("failed writing config, err: %v", err)
 	}
 
 	return nil
 }
 
+// WriteConfigData replaces the config file with data as is. The previous
+// contents are kept in a timestamped backup next to it, whose path is returned.
+func WriteConfigData(data []byte) (backupPath string, err error) {
+	info, err := os.Stat(ConfigFilePath)
+	if err != nil {
+		return
+	}
+
+	previous, err := os.ReadFile(ConfigFilePath)
+	if err != nil {
+		return
+	}
+
+	backupPath = fmt.Sprintf("%s.%s.bak", ConfigFilePath, time.Now().Format("20060102150405"))
+	if err = os.WriteFile(backupPath, previous, info.Mode().Perm()); err != nil {
+		err = fmt.Errorf("failed writing config backup, err: %v", err)
+		return
+	}
+
+	if err = os.WriteFile(ConfigFilePath, data, info.Mode().Perm()); err != nil {
+		err = fmt.Errorf("failed writing config, err: %v", err)
+	}
+
+	return
+}
+
 func GetConfigFilePath(cmd *cobra.Command) string {
 	defaultConfigPath := path.Join(misc.GetDotFolderPath(), "config.yaml")
 
@@ -182,12 +229,26 @@ func loadConfigFile(config *ConfigStruct, silent bool) error {
 		return err
 	}
 
+	buf, issues, err := MigrateConfigData(buf)
+	if err != nil {
+		return err
+	}
+
 	if err := yaml.Unmarshal(buf, config); err != nil {
 		return err
 	}
 
+	if err := decryptSecretFields(config); err != nil {
+		return err
+	}
+
+	if config.Encryption.Enabled() || hasSecretValues(config) {
+		restrictConfigFileMode()
+	}
+
 	if !silent {
 		log.Info().Str("path", ConfigFilePath).Msg("Found config file!")
+		logConfigIssues(issues)
 	}
 
 	return nil
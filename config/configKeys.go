@@ -0,0 +1,129 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+
+	"github.com/goccy/go-yaml"
+)
+
+// GetConfigValue returns the value of the config key at the dotted path.
+func GetConfigValue(config *ConfigStruct, key string) (value interface{}, err error) {
+	configElemValue := reflect.ValueOf(config).Elem()
+	err = mergeFlag(configElemValue, strings.Split(key, "."), key, func(flagName string, currentFieldStruct reflect.StructField, currentFieldElemValue reflect.Value, currentElemValue reflect.Value) error {
+		value = currentFieldElemValue.Interface()
+		return nil
+	})
+
+	return
+}
+
+// SetConfigFileValue sets the config key at the dotted path in the config
+// file. Values are validated against the config struct the same way --set
+// flags are; several values are accepted for list keys. Comments and
+// ordering of the file are preserved.
+func SetConfigFileValue(key string, values []string) error {
+	if len(values) == 0 {
+		return errors.New("no value provided")
+	}
+
+	if err := checkWritableConfigKey(key); err != nil {
+		return err
+	}
+
+	// Parse the values into an empty config so only this key is encoded.
+	parsedConfig := ConfigStruct{}
+	configElemValue := reflect.ValueOf(&parsedConfig).Elem()
+	keyPath := strings.Split(key, ".")
+
+	var err error
+	if len(values) > 1 {
+		err = mergeFlagValues(configElemValue, keyPath, key, values)
+	} else {
+		err = mergeFlagValue(configElemValue, keyPath, key, values[0])
+	}
+	if err != nil {
+		return err
+	}
+
+	parsedValue, err := GetConfigValue(&parsedConfig, key)
+	if err != nil {
+		return err
+	}
+
+	if parsedValue, err = encryptSecretValue(key, parsedValue); err != nil {
+		return err
+	}
+
+	encoded, err := yaml.Marshal(parsedValue)
+	if err != nil {
+		return err
+	}
+
+	return updateConfigFile(func(doc *yamlDocument) error {
+		return doc.Set(keyPath, strings.Split(strings.TrimSuffix(string(encoded), "\n"), "\n"))
+	})
+}
+
+// UnsetConfigFileValue removes the config key at the dotted path from the
+// config file, so its default applies again. It reports whether the key was
+// set in the file.
+func UnsetConfigFileValue(key string) (removed bool, err error) {
+	if err = checkWritableConfigKey(key); err != nil {
+		return
+	}
+
+	err = updateConfigFile(func(doc *yamlDocument) error {
+		removed = doc.Remove(strings.Split(key, "."))
+		return nil
+	})
+
+	return
+}
+
+func checkWritableConfigKey(key string) error {
+	configElemValue := reflect.ValueOf(&ConfigStruct{}).Elem()
+	return mergeFlag(configElemValue, strings.Split(key, "."), key, func(flagName string, currentFieldStruct reflect.StructField, currentFieldElemValue reflect.Value, currentElemValue reflect.Value) error {
+		if _, ok := currentFieldStruct.Tag.Lookup(ReadonlyTag); ok {
+			return fmt.Errorf("flag \"%s\" is read-only", key)
+		}
+		return nil
+	})
+}
+
+// updateConfigFile applies edit to the config file, creating the file if it
+// doesn't exist yet.
+func updateConfigFile(edit func(doc *yamlDocument) error) error {
+	buf, err := os.ReadFile(ConfigFilePath)
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+
+	doc := newYamlDocument(buf)
+	if err := edit(doc); err != nil {
+		return err
+	}
+
+	data := doc.Bytes()
+	var check map[string]interface{}
+	if err := yaml.Unmarshal(data, &check); err != nil {
+		return fmt.Errorf("the edit results in an invalid config, %w", err)
+	}
+
+	mode := os.FileMode(0600)
+	if info, err := os.Stat(ConfigFilePath); err == nil {
+		mode = info.Mode().Perm()
+	} else if err := os.MkdirAll(filepath.Dir(ConfigFilePath), 0700); err != nil {
+		return fmt.Errorf("failed creating directories, err: %v", err)
+	}
+
+	if err := os.WriteFile(ConfigFilePath, data, mode); err != nil {
+		return fmt.Errorf("failed writing config, err: %v", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,34 @@
+package config
+
+import (
+	"os"
+	"testing"
+)
+
+func TestSetConfigFileValue(t *testing.T) {
+	defer func(path string) { ConfigFilePath = path }(ConfigFilePath)
+	ConfigFilePath = t.TempDir() + "/config.yaml"
+	if err := os.WriteFile(ConfigFilePath, []byte("# keep me\ntap:\n  docker:\n    tag: v1 # pinned\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := SetConfigFileValue("tap.docker.tag", []string{"v2"}); err != nil {
+		t.Fatalf("unexpected error - err: %v", err)
+	}
+	if err := SetConfigFileValue("tap.ipv6", []string{"nope"}); err == nil {
+		t.Error("expected an error for an invalid bool")
+	}
+	if err := SetConfigFileValue("tap.noSuchKey", []string{"x"}); err == nil {
+		t.Error("expected an error for an unknown key")
+	}
+
+	buf, _ := os.ReadFile(ConfigFilePath)
+	expected := "# keep me\ntap:\n  docker:\n    tag: v2 # pinned\n"
+	if string(buf) != expected {
+		t.Errorf("unexpected config - expected:\n%s\nactual:\n%s", expected, buf)
+	}
+
+	if removed, err := UnsetConfigFileValue("tap.docker.tag"); err != nil || !removed {
+		t.Errorf("expected the key to be removed - removed: %v, err: %v", removed, err)
+	}
+}
@@ -170,10 +170,13 @@ type ConfigStruct struct {
 	Logs                 configStructs.LogsConfig      `yaml:"logs" json:"logs"`
 	Config               configStructs.ConfigConfig    `yaml:"config,omitempty" json:"config,omitempty"`
 	PcapDump             configStructs.PcapDumpConfig  `yaml:"pcapdump" json:"pcapdump"`
+	Pcap                 configStructs.PcapConfig      `yaml:"pcap,omitempty" json:"pcap,omitempty"`
+	Import               configStructs.ImportConfig    `yaml:"import,omitempty" json:"import,omitempty"`
+	Snapshot             configStructs.SnapshotConfig  `yaml:"snapshot,omitempty" json:"snapshot,omitempty"`
 	Kube                 KubeConfig                    `yaml:"kube" json:"kube"`
 	DumpLogs             bool                          `yaml:"dumpLogs" json:"dumpLogs" default:"false"`
 	HeadlessMode         bool                          `yaml:"headless" json:"headless" default:"false"`
-	License              string                        `yaml:"license" json:"license" default:""`
+	License              string                        `yaml:"license" json:"license" default:"" secret:""`
 	CloudApiUrl          string                        `yaml:"cloudApiUrl" json:"cloudApiUrl" default:"https://api.kubeshark.com"`
 	CloudLicenseEnabled  bool                          `yaml:"cloudLicenseEnabled" json:"cloudLicenseEnabled" default:"true"`
 	DemoModeEnabled      bool                          `yaml:"demoModeEnabled" json:"demoModeEnabled" default:"false"`
@@ -184,6 +187,8 @@ type ConfigStruct struct {
 	Manifests            ManifestsConfig               `yaml:"manifests,omitempty" json:"manifests,omitempty"`
 	Timezone             string                        `yaml:"timezone" json:"timezone"`
 	LogLevel             string                        `yaml:"logLevel" json:"logLevel" default:"warning"`
+	Encryption           EncryptionConfig              `yaml:"encryption" json:"-"`
+	Contexts             map[string]interface{}        `yaml:"contexts,omitempty" json:"-"`
 }
 
 func (config *ConfigStruct) ImagePullPolicy() v1.PullPolicy {
@@ -2,8 +2,16 @@ package configStructs
 
 const (
 	RegenerateConfigName = "regenerate"
+	EffectiveConfigName  = "effective"
+	HelmValuesConfigName = "helm-values"
 )
 
+type ConfigHelmConfig struct {
+	Values string `yaml:"values,omitempty" json:"values,omitempty" readonly:""`
+}
+
 type ConfigConfig struct {
-	Regenerate bool `yaml:"regenerate,omitempty" json:"regenerate,omitempty" default:"false" readonly:""`
+	Regenerate bool             `yaml:"regenerate,omitempty" json:"regenerate,omitempty" default:"false" readonly:""`
+	Effective  bool             `yaml:"effective,omitempty" json:"effective,omitempty" default:"false" readonly:""`
+	Helm       ConfigHelmConfig `yaml:"helm,omitempty" json:"helm,omitempty"`
 }
@@ -0,0 +1,15 @@
+package configStructs
+
+const (
+	AsSnapshotImportName = "as-snapshot"
+	CloudImportName      = "cloud"
+)
+
+type ImportAsConfig struct {
+	Snapshot string `yaml:"snapshot,omitempty" json:"snapshot,omitempty" default:"" readonly:""`
+}
+
+type ImportConfig struct {
+	As    ImportAsConfig `yaml:"as,omitempty" json:"as,omitempty"`
+	Cloud bool           `yaml:"cloud" json:"cloud" default:"false"`
+}
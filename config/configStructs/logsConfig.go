@@ -9,13 +9,15 @@ import (
 )
 
 const (
-	FileLogsName = "file"
-	GrepLogsName = "grep"
+	FileLogsName   = "file"
+	GrepLogsName   = "grep"
+	UploadLogsName = "upload"
 )
 
 type LogsConfig struct {
 	FileStr string `yaml:"file" json:"file"`
 	Grep    string `yaml:"grep" json:"grep"`
+	Upload  bool   `yaml:"upload" json:"upload" default:"false"`
 }
 
 func (config *LogsConfig) Validate() error {
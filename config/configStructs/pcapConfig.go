@@ -0,0 +1,27 @@
+package configStructs
+
+const (
+	OutputPcapName     = "output"
+	TopPcapName        = "top"
+	IntervalPcapName   = "interval"
+	FlowPcapName       = "flow"
+	PodPcapName        = "pod"
+	PeerPcapName       = "peer"
+	WritePcapName      = "write"
+	PayloadDirPcapName = "payload-dir"
+)
+
+type PayloadPcapConfig struct {
+	Dir string `yaml:"dir,omitempty" json:"dir,omitempty" default:"" readonly:""`
+}
+
+type PcapConfig struct {
+	Output   string            `yaml:"output,omitempty" json:"output,omitempty" default:"table" readonly:""`
+	Top      int               `yaml:"top,omitempty" json:"top,omitempty" default:"10" readonly:""`
+	Interval string            `yaml:"interval,omitempty" json:"interval,omitempty" default:"" readonly:""`
+	Flow     string            `yaml:"flow,omitempty" json:"flow,omitempty" default:"" readonly:""`
+	Pod      string            `yaml:"pod,omitempty" json:"pod,omitempty" default:"" readonly:""`
+	Peer     string            `yaml:"peer,omitempty" json:"peer,omitempty" default:"" readonly:""`
+	Write    string            `yaml:"write,omitempty" json:"write,omitempty" default:"extract.pcap" readonly:""`
+	Payload  PayloadPcapConfig `yaml:"payload,omitempty" json:"payload,omitempty"`
+}
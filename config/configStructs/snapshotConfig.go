@@ -0,0 +1,27 @@
+package configStructs
+
+const (
+	NameSnapshotName   = "name"
+	TimeSnapshotName   = "time"
+	FromSnapshotName   = "from"
+	ToSnapshotName     = "to"
+	NodesSnapshotName  = "nodes"
+	KflSnapshotName    = "kfl"
+	WaitSnapshotName   = "wait"
+	OutputSnapshotName = "output"
+	CloudSnapshotName  = "cloud"
+	WriteSnapshotName  = "write"
+)
+
+type SnapshotConfig struct {
+	Name   string   `yaml:"name,omitempty" json:"name,omitempty" default:"" readonly:""`
+	Time   string   `yaml:"time,omitempty" json:"time,omitempty" default:"" readonly:""`
+	From   string   `yaml:"from,omitempty" json:"from,omitempty" default:"" readonly:""`
+	To     string   `yaml:"to,omitempty" json:"to,omitempty" default:"" readonly:""`
+	Nodes  []string `yaml:"nodes,omitempty" json:"nodes,omitempty" default:"[]" readonly:""`
+	Kfl    string   `yaml:"kfl,omitempty" json:"kfl,omitempty" default:"" readonly:""`
+	Wait   bool     `yaml:"wait,omitempty" json:"wait,omitempty" default:"false" readonly:""`
+	Output string   `yaml:"output,omitempty" json:"output,omitempty" default:"table" readonly:""`
+	Cloud  bool     `yaml:"cloud,omitempty" json:"cloud,omitempty" default:"false" readonly:""`
+	Write  string   `yaml:"write,omitempty" json:"write,omitempty" default:"" readonly:""`
+}
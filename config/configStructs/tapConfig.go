@@ -44,6 +44,27 @@ const (
 	PcapKubeconfig               = "kubeconfig"
 	PcapDumpEnabled              = "enabled"
 	PcapTime                     = "time"
+	PcapFormat                   = "format"
+	PcapBpf                      = "bpf"
+	PcapPodRegex                 = "pod-regex"
+	PcapNamespace                = "namespace"
+	PcapNodes                    = "nodes"
+	PcapContext                  = "context"
+	PcapFrom                     = "from"
+	PcapTo                       = "to"
+	PcapFollow                   = "follow"
+	PcapRollSize                 = "roll-size"
+	PcapRollTime                 = "roll-time"
+	PcapWrite                    = "write"
+	PcapCompress                 = "compress"
+	PcapSplitSize                = "split-size"
+	PcapSplitTime                = "split-time"
+	PcapAnonymize                = "anonymize"
+	PcapPayloadBytes             = "payload-bytes"
+	PcapRedactHttp               = "redact-http"
+	PcapDedup                    = "dedup"
+	PcapDuplicateTimeframe       = "duplicate-timeframe"
+	PcapUpload                   = "upload"
 	WatchdogEnabled              = "watchdogEnabled"
 	HelmChartPathLabel           = "release-helmChartPath"
 )
@@ -158,7 +179,7 @@ type ProbeConfig struct {
 type SamlConfig struct {
 	IdpMetadataUrl string `yaml:"idpMetadataUrl" json:"idpMetadataUrl"`
 	X509crt        string `yaml:"x509crt" json:"x509crt"`
-	X509key        string `yaml:"x509key" json:"x509key"`
+	X509key        string `yaml:"x509key" json:"x509key" secret:""`
 }
 
 type AuthConfig struct {
@@ -323,13 +344,63 @@ type MiscConfig struct {
 }
 
 type PcapDumpConfig struct {
-	PcapDumpEnabled  bool   `yaml:"enabled" json:"enabled" default:"false"`
-	PcapTimeInterval string `yaml:"timeInterval" json:"timeInterval" default:"1m"`
-	PcapMaxTime      string `yaml:"maxTime" json:"maxTime" default:"1h"`
-	PcapMaxSize      string `yaml:"maxSize" json:"maxSize" default:"500MB"`
-	PcapTime         string `yaml:"time" json:"time" default:"time"`
-	PcapDebug        bool   `yaml:"debug" json:"debug" default:"false"`
-	PcapDest         string `yaml:"dest" json:"dest" default:""`
+	PcapDumpEnabled  bool                `yaml:"enabled" json:"enabled" default:"false"`
+	PcapTimeInterval string              `yaml:"timeInterval" json:"timeInterval" default:"1m"`
+	PcapMaxTime      string              `yaml:"maxTime" json:"maxTime" default:"1h"`
+	PcapMaxSize      string              `yaml:"maxSize" json:"maxSize" default:"500MB"`
+	PcapTime         string              `yaml:"time" json:"time" default:"time"`
+	PcapDebug        bool                `yaml:"debug" json:"debug" default:"false"`
+	PcapDest         string              `yaml:"dest" json:"dest" default:""`
+	PcapFormat       string              `yaml:"format" json:"format" default:"pcap"`
+	PcapBpf          string              `yaml:"bpf" json:"bpf" default:""`
+	PcapPod          PcapPodConfig       `yaml:"pod" json:"pod"`
+	PcapNamespace    []string            `yaml:"namespace" json:"namespace" default:"[]"`
+	PcapNodes        []string            `yaml:"nodes" json:"nodes" default:"[]"`
+	PcapFrom         string              `yaml:"from" json:"from" default:""`
+	PcapTo           string              `yaml:"to" json:"to" default:""`
+	PcapFollow       bool                `yaml:"follow" json:"follow" default:"false"`
+	PcapRoll         PcapRollConfig      `yaml:"roll" json:"roll"`
+	PcapWrite        string              `yaml:"write" json:"write" default:""`
+	PcapCompress     string              `yaml:"compress" json:"compress" default:""`
+	PcapSplit        PcapSplitConfig     `yaml:"split" json:"split"`
+	PcapContext      string              `yaml:"context" json:"context" default:""`
+	PcapRelease      PcapReleaseConfig   `yaml:"release" json:"release"`
+	PcapAnonymize    bool                `yaml:"anonymize" json:"anonymize" default:"false"`
+	PcapPayload      PcapPayloadConfig   `yaml:"payload" json:"payload"`
+	PcapRedact       PcapRedactConfig    `yaml:"redact" json:"redact"`
+	PcapDedup        bool                `yaml:"dedup" json:"dedup" default:"false"`
+	PcapDuplicate    PcapDuplicateConfig `yaml:"duplicate" json:"duplicate"`
+	PcapUpload       bool                `yaml:"upload" json:"upload" default:"false"`
+}
+
+type PcapDuplicateConfig struct {
+	Timeframe string `yaml:"timeframe" json:"timeframe" default:"200ms"`
+}
+
+type PcapPayloadConfig struct {
+	Bytes int `yaml:"bytes" json:"bytes" default:"0"`
+}
+
+type PcapRedactConfig struct {
+	Http bool `yaml:"http" json:"http" default:"false"`
+}
+
+type PcapReleaseConfig struct {
+	Namespace string `yaml:"namespace" json:"namespace" default:""`
+}
+
+type PcapSplitConfig struct {
+	Size string `yaml:"size" json:"size" default:""`
+	Time string `yaml:"time" json:"time" default:""`
+}
+
+type PcapRollConfig struct {
+	Size string `yaml:"size" json:"size" default:""`
+	Time string `yaml:"time" json:"time" default:""`
+}
+
+type PcapPodConfig struct {
+	Regex string `yaml:"regex" json:"regex" default:""`
 }
 
 type PortMapping struct {
@@ -376,22 +447,23 @@ type SnapshotsLocalConfig struct {
 type SnapshotsCloudS3Config struct {
 	Bucket     string `yaml:"bucket" json:"bucket" default:""`
 	Region     string `yaml:"region" json:"region" default:""`
-	AccessKey  string `yaml:"accessKey" json:"accessKey" default:""`
-	SecretKey  string `yaml:"secretKey" json:"secretKey" default:""`
+	AccessKey  string `yaml:"accessKey" json:"accessKey" default:"" secret:""`
+	SecretKey  string `yaml:"secretKey" json:"secretKey" default:"" secret:""`
 	RoleArn    string `yaml:"roleArn" json:"roleArn" default:""`
 	ExternalId string `yaml:"externalId" json:"externalId" default:""`
+	Endpoint   string `yaml:"endpoint" json:"endpoint" default:""`
 }
 
 type SnapshotsCloudAzblobConfig struct {
 	StorageAccount string `yaml:"storageAccount" json:"storageAccount" default:""`
 	Container      string `yaml:"container" json:"container" default:""`
-	StorageKey     string `yaml:"storageKey" json:"storageKey" default:""`
+	StorageKey     string `yaml:"storageKey" json:"storageKey" default:"" secret:""`
 }
 
 type SnapshotsCloudGCSConfig struct {
 	Bucket          string `yaml:"bucket" json:"bucket" default:""`
 	Project         string `yaml:"project" json:"project" default:""`
-	CredentialsJson string `yaml:"credentialsJson" json:"credentialsJson" default:""`
+	CredentialsJson string `yaml:"credentialsJson" json:"credentialsJson" default:"" secret:""`
 }
 
 type SnapshotsCloudConfig struct {
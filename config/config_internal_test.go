@@ -2,8 +2,11 @@ package config
 
 import (
 	"fmt"
+	"path/filepath"
 	"reflect"
 	"testing"
+
+	"github.com/spf13/cobra"
 )
 
 type ConfigMock struct {
@@ -383,3 +386,38 @@ func TestGetParsedValueInvalidValue(t *testing.T) {
 		})
 	}
 }
+
+func TestInitConfigSubcommandSection(t *testing.T) {
+	t.Setenv("KUBESHARK_DISABLE_VERSION_CHECK", "1")
+
+	root := &cobra.Command{Use: "kubeshark"}
+	root.PersistentFlags().Bool(DebugFlag, false, "")
+	root.PersistentFlags().String(ConfigPathFlag, filepath.Join(t.TempDir(), "config.yaml"), "")
+
+	configCmd := &cobra.Command{Use: "config"}
+	diffCmd := &cobra.Command{Use: "diff"}
+	diffCmd.Flags().StringP("release-namespace", "s", "", "")
+	configCmd.Flags().BoolP("regenerate", "r", false, "")
+	root.AddCommand(configCmd)
+	configCmd.AddCommand(diffCmd)
+
+	if err := diffCmd.ParseFlags([]string{"-s", "monitoring"}); err != nil {
+		t.Fatalf("unexpected error - err: %v", err)
+	}
+	if err := InitConfig(diffCmd); err != nil {
+		t.Fatalf("unexpected error - err: %v", err)
+	}
+	if Config.Tap.Release.Namespace != "monitoring" {
+		t.Errorf("unexpected release namespace - expected: monitoring, actual: %s", Config.Tap.Release.Namespace)
+	}
+
+	if err := configCmd.ParseFlags([]string{"-r"}); err != nil {
+		t.Fatalf("unexpected error - err: %v", err)
+	}
+	if err := InitConfig(configCmd); err != nil {
+		t.Fatalf("unexpected error - err: %v", err)
+	}
+	if !Config.Config.Regenerate {
+		t.Errorf("expected config.regenerate to be set")
+	}
+}
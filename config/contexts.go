@@ -0,0 +1,90 @@
+package config
+
+import (
+	"fmt"
+
+	"github.com/goccy/go-yaml"
+	"github.com/rs/zerolog/log"
+)
+
+const ContextsKey = "contexts"
+
+var appliedContext string
+
+// ApplyContextOverrides overlays the `contexts.<name>` section of the config
+// file for the given kube context onto the config. The overlay takes
+// precedence over the rest of the config file, while command-line flags
+// still take precedence over the overlay. It's applied once per process.
+func ApplyContextOverrides(contextName string) error {
+	if appliedContext != "" || contextName == "" {
+		return nil
+	}
+
+	overlay, ok := Config.Contexts[contextName]
+	if !ok || overlay == nil {
+		return nil
+	}
+
+	overlayValues, ok := overlay.(map[string]interface{})
+	if !ok {
+		return fmt.Errorf("invalid overrides for the kube context %s, expected a mapping", contextName)
+	}
+	delete(overlayValues, ContextsKey)
+
+	buf, err := yaml.Marshal(Config)
+	if err != nil {
+		return err
+	}
+
+	var values map[string]interface{}
+	if err := yaml.Unmarshal(buf, &values); err != nil {
+		return err
+	}
+
+	buf, err = yaml.Marshal(mergeValues(values, overlayValues))
+	if err != nil {
+		return err
+	}
+
+	var merged ConfigStruct
+	if err := yaml.Unmarshal(buf, &merged); err != nil {
+		return fmt.Errorf("invalid overrides for the kube context %s, %w", contextName, err)
+	}
+	merged.Contexts = Config.Contexts
+
+	if err := decryptSecretFields(&merged); err != nil {
+		return err
+	}
+
+	Config = merged
+	appliedContext = contextName
+
+	if initCmd != nil {
+		initCmd.Flags().Visit(initFlag)
+	}
+
+	log.Debug().Str("context", contextName).Interface("config", Config.Masked()).Msg("Applied the config overrides of the kube context.")
+
+	return nil
+}
+
+// AppliedContext returns the kube context whose overrides were applied.
+func AppliedContext() string {
+	return appliedContext
+}
+
+// mergeValues deep-merges overlay onto base. Mappings are merged key by key,
+// any other value, lists included, replaces the base one.
+func mergeValues(base map[string]interface{}, overlay map[string]interface{}) map[string]interface{} {
+	for key, overlayValue := range overlay {
+		overlayMap, isOverlayMap := overlayValue.(map[string]interface{})
+		baseMap, isBaseMap := base[key].(map[string]interface{})
+		if isOverlayMap && isBaseMap {
+			base[key] = mergeValues(baseMap, overlayMap)
+			continue
+		}
+		base[key] = overlayValue
+	}
+
+	return base
+}
@@ -0,0 +1,51 @@
+package config
+
+import (
+	"testing"
+
+	"github.com/goccy/go-yaml"
+)
+
+func TestApplyContextOverrides(t *testing.T) {
+	defer func(config ConfigStruct) {
+		Config = config
+		appliedContext = ""
+	}(Config)
+
+	Config = CreateDefaultConfig()
+	initCmd = nil
+	appliedContext = ""
+
+	buf := []byte(`tap:
+  docker:
+    registry: docker.io/kubeshark
+    tag: v1
+contexts:
+  prod:
+    tap:
+      docker:
+        registry: registry.prod.example.com
+      storageClass: fast
+`)
+	if err := yaml.Unmarshal(buf, &Config); err != nil {
+		t.Fatalf("unexpected error - err: %v", err)
+	}
+
+	if err := ApplyContextOverrides("dev"); err != nil || AppliedContext() != "" {
+		t.Fatalf("unexpected overrides for a context without a section - err: %v", err)
+	}
+
+	if err := ApplyContextOverrides("prod"); err != nil {
+		t.Fatalf("unexpected error - err: %v", err)
+	}
+
+	if Config.Tap.Docker.Registry != "registry.prod.example.com" || Config.Tap.StorageClass != "fast" {
+		t.Errorf("overrides weren't applied - registry: %s, storage class: %s", Config.Tap.Docker.Registry, Config.Tap.StorageClass)
+	}
+	if Config.Tap.Docker.Tag != "v1" {
+		t.Errorf("unexpected base value - expected: v1, actual: %s", Config.Tap.Docker.Tag)
+	}
+	if Config.Tap.EnabledDissectors == nil || Config.Contexts == nil {
+		t.Error("expected the rest of the config to be kept")
+	}
+}
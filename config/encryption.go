@@ -0,0 +1,303 @@
+package config
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/pbkdf2"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"os"
+	"reflect"
+	"slices"
+	"strings"
+
+	"github.com/rs/zerolog/log"
+)
+
+const (
+	EncryptedPrefix = "enc:"
+
+	encryptionSaltSize   = 16
+	encryptionKeySize    = 32
+	encryptionIterations = 210000
+)
+
+type EncryptionConfig struct {
+	Keyring        bool   `yaml:"keyring" json:"keyring" default:"false"`
+	PassphraseFile string `yaml:"passphraseFile" json:"passphraseFile"`
+}
+
+// Enabled reports whether secret fields are encrypted in the config file.
+func (config *EncryptionConfig) Enabled() bool {
+	return config.Keyring || config.PassphraseFile != ""
+}
+
+// passphrase returns the passphrase the encryption key is derived from. A
+// key is generated and stored in the OS keyring on first use when create
+// is set.
+func (config *EncryptionConfig) passphrase(create bool) (string, error) {
+	if config.PassphraseFile != "" {
+		data, err := os.ReadFile(config.PassphraseFile)
+		if err != nil {
+			return "", fmt.Errorf("failed reading the passphrase file, %w", err)
+		}
+
+		passphrase := strings.TrimRight(string(data), "\r\n")
+		if passphrase == "" {
+			return "", fmt.Errorf("the passphrase file %s is empty", config.PassphraseFile)
+		}
+
+		return passphrase, nil
+	}
+
+	key, found, err := keyringGet()
+	if err != nil {
+		return "", err
+	}
+	if found {
+		return key, nil
+	}
+	if !create {
+		return "", errors.New("the config encryption key isn't in the OS keyring")
+	}
+
+	buf := make([]byte, encryptionKeySize)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+
+	key = base64.StdEncoding.EncodeToString(buf)
+	if err := keyringSet(key); err != nil {
+		return "", err
+	}
+
+	log.Info().Msg("Generated the config encryption key and stored it in the OS keyring.")
+	return key, nil
+}
+
+// IsEncrypted reports whether value was encrypted with EncryptValue.
+func IsEncrypted(value string) bool {
+	return strings.HasPrefix(value, EncryptedPrefix)
+}
+
+// EncryptValue encrypts value with AES-GCM, using a key derived from the
+// passphrase with PBKDF2 and a random salt.
+func EncryptValue(passphrase string, value string) (string, error) {
+	salt := make([]byte, encryptionSaltSize)
+	if _, err := rand.Read(salt); err != nil {
+		return "", err
+	}
+
+	gcm, err := newEncryptionCipher(passphrase, salt)
+	if err != nil {
+		return "", err
+	}
+
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", err
+	}
+
+	sealed := gcm.Seal(append(salt, nonce...), nonce, []byte(value), nil)
+	return EncryptedPrefix + base64.StdEncoding.EncodeToString(sealed), nil
+}
+
+// DecryptValue reverses EncryptValue.
+func DecryptValue(passphrase string, value string) (string, error) {
+	sealed, err := base64.StdEncoding.DecodeString(strings.TrimPrefix(value, EncryptedPrefix))
+	if err != nil {
+		return "", fmt.Errorf("malformed encrypted value, %w", err)
+	}
+	if len(sealed) < encryptionSaltSize {
+		return "", errors.New("malformed encrypted value")
+	}
+
+	gcm, err := newEncryptionCipher(passphrase, sealed[:encryptionSaltSize])
+	if err != nil {
+		return "", err
+	}
+
+	sealed = sealed[encryptionSaltSize:]
+	if len(sealed) < gcm.NonceSize() {
+		return "", errors.New("malformed encrypted value")
+	}
+
+	plain, err := gcm.Open(nil, sealed[:gcm.NonceSize()], sealed[gcm.NonceSize():], nil)
+	if err != nil {
+		return "", errors.New("failed decrypting, the encryption key doesn't match")
+	}
+
+	return string(plain), nil
+}
+
+func newEncryptionCipher(passphrase string, salt []byte) (cipher.AEAD, error) {
+	key, err := pbkdf2.Key(sha256.New, passphrase, salt, encryptionIterations, encryptionKeySize)
+	if err != nil {
+		return nil, err
+	}
+
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+
+	return cipher.NewGCM(block)
+}
+
+// decryptSecretFields decrypts the encrypted secret fields of the config in
+// place.
+func decryptSecretFields(config *ConfigStruct) error {
+	var passphrase string
+	var errs []string
+	walkSecretFields(reflect.ValueOf(config).Elem(), nil, func(path []string, field reflect.Value) {
+		if !IsEncrypted(field.String()) {
+			return
+		}
+
+		if passphrase == "" {
+			var err error
+			if passphrase, err = config.Encryption.passphrase(false); err != nil {
+				errs = append(errs, fmt.Sprintf("%s: %v", strings.Join(path, "."), err))
+				return
+			}
+		}
+
+		value, err := DecryptValue(passphrase, field.String())
+		if err != nil {
+			errs = append(errs, fmt.Sprintf("%s: %v", strings.Join(path, "."), err))
+			return
+		}
+		field.SetString(value)
+	})
+
+	if len(errs) > 0 {
+		return fmt.Errorf("failed decrypting the config, %s", strings.Join(errs, ", "))
+	}
+
+	return nil
+}
+
+// encryptSecretValue encrypts the value of the config key at the dotted path
+// if it's a plain secret and encryption is configured, so every writer of the
+// config file stores secrets the same way.
+func encryptSecretValue(key string, value interface{}) (interface{}, error) {
+	plain, ok := value.(string)
+	if !ok || plain == "" || IsSecretRef(plain) || IsEncrypted(plain) ||
+		!Config.Encryption.Enabled() || !slices.Contains(SecretPaths(), key) {
+		return value, nil
+	}
+
+	passphrase, err := Config.Encryption.passphrase(true)
+	if err != nil {
+		return nil, err
+	}
+
+	return EncryptValue(passphrase, plain)
+}
+
+// withEncryptedSecrets returns a copy of the config where the plain secret
+// values are encrypted by encryptSecretValue.
+func (config *ConfigStruct) withEncryptedSecrets() (encrypted ConfigStruct, err error) {
+	encrypted = *config
+
+	walkSecretFields(reflect.ValueOf(&encrypted).Elem(), nil, func(path []string, field reflect.Value) {
+		if err != nil {
+			return
+		}
+
+		var value interface{}
+		if value, err = encryptSecretValue(strings.Join(path, "."), field.String()); err == nil {
+			field.SetString(value.(string))
+		}
+	})
+
+	return
+}
+
+// hasSecretValues reports whether any secret field of the config is set.
+func hasSecretValues(config *ConfigStruct) (found bool) {
+	walkSecretFields(reflect.ValueOf(config).Elem(), nil, func(path []string, field reflect.Value) {
+		if field.String() != "" {
+			found = true
+		}
+	})
+
+	return
+}
+
+// restrictConfigFileMode makes the config file readable by its owner only.
+func restrictConfigFileMode() {
+	info, err := os.Stat(ConfigFilePath)
+	if err != nil || info.Mode().Perm()&0077 == 0 {
+		return
+	}
+
+	if err := os.Chmod(ConfigFilePath, info.Mode().Perm()&0700); err != nil {
+		log.Warn().Err(err).Str("path", ConfigFilePath).Msg("Failed restricting the permissions of the config file.")
+		return
+	}
+
+	log.Info().Str("path", ConfigFilePath).Msg("Restricted the permissions of the config file to its owner, as it holds secrets.")
+}
+
+// EncryptConfigFile encrypts the plain secret values of the config file,
+// the overrides of the kube contexts included. Secret references are kept
+// as they don't disclose anything. It returns the number of values it
+// encrypted.
+func EncryptConfigFile() (count int, err error) {
+	if !Config.Encryption.Enabled() {
+		return 0, errors.New("encryption isn't configured, set encryption.keyring or encryption.passphraseFile")
+	}
+
+	passphrase, err := Config.Encryption.passphrase(true)
+	if err != nil {
+		return 0, err
+	}
+
+	var paths [][]string
+	for _, path := range SecretPaths() {
+		paths = append(paths, strings.Split(path, "."))
+		for contextName := range Config.Contexts {
+			paths = append(paths, append([]string{ContextsKey, contextName}, strings.Split(path, ".")...))
+		}
+	}
+
+	err = updateConfigFile(func(doc *yamlDocument) error {
+		for _, path := range paths {
+			line, ok := doc.find(path)
+			if !ok {
+				continue
+			}
+
+			value := doc.extract(line)
+			if len(value) != 1 {
+				continue
+			}
+
+			plain := strings.Trim(value[0], `"'`)
+			if plain == "" || IsSecretRef(plain) || IsEncrypted(plain) {
+				continue
+			}
+
+			encrypted, err := EncryptValue(passphrase, plain)
+			if err != nil {
+				return err
+			}
+
+			if err := doc.Set(path, []string{encrypted}); err != nil {
+				return err
+			}
+			count++
+		}
+
+		return nil
+	})
+	if err == nil {
+		restrictConfigFileMode()
+	}
+
+	return
+}
@@ -0,0 +1,110 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestEncryptValue(t *testing.T) {
+	encrypted, err := EncryptValue("passphrase", "my-license")
+	if err != nil {
+		t.Fatalf("unexpected error - err: %v", err)
+	}
+
+	if !IsEncrypted(encrypted) || strings.Contains(encrypted, "my-license") {
+		t.Errorf("unexpected encrypted value - actual: %s", encrypted)
+	}
+
+	decrypted, err := DecryptValue("passphrase", encrypted)
+	if err != nil || decrypted != "my-license" {
+		t.Errorf("unexpected decrypted value - expected: my-license, actual: %s, err: %v", decrypted, err)
+	}
+
+	if _, err := DecryptValue("other", encrypted); err == nil {
+		t.Error("expected an error for a wrong passphrase")
+	}
+}
+
+func TestEncryptConfigFile(t *testing.T) {
+	defer func(config ConfigStruct, path string) {
+		Config = config
+		ConfigFilePath = path
+	}(Config, ConfigFilePath)
+
+	dir := t.TempDir()
+	passphraseFile := filepath.Join(dir, "passphrase")
+	if err := os.WriteFile(passphraseFile, []byte("secret\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	ConfigFilePath = filepath.Join(dir, "config.yaml")
+	if err := os.WriteFile(ConfigFilePath, []byte("# license\nlicense: my-license\nencryption:\n  passphraseFile: "+passphraseFile+"\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	Config = CreateDefaultConfig()
+	if err := loadConfigFile(&Config, true); err != nil {
+		t.Fatalf("unexpected error - err: %v", err)
+	}
+
+	if count, err := EncryptConfigFile(); err != nil || count != 1 {
+		t.Fatalf("unexpected result - count: %d, err: %v", count, err)
+	}
+
+	buf, _ := os.ReadFile(ConfigFilePath)
+	if strings.Contains(string(buf), "my-license") || !strings.Contains(string(buf), "# license") {
+		t.Errorf("unexpected config file:\n%s", buf)
+	}
+
+	if info, _ := os.Stat(ConfigFilePath); info.Mode().Perm() != 0600 {
+		t.Errorf("unexpected mode - expected: 0600, actual: %o", info.Mode().Perm())
+	}
+
+	Config = CreateDefaultConfig()
+	if err := loadConfigFile(&Config, true); err != nil {
+		t.Fatalf("unexpected error - err: %v", err)
+	}
+
+	if Config.License != "my-license" {
+		t.Errorf("expected the license to be decrypted - actual: %s", Config.License)
+	}
+}
+
+func TestConfigWritersEncryptSecrets(t *testing.T) {
+	defer func(config ConfigStruct, path string) {
+		Config = config
+		ConfigFilePath = path
+	}(Config, ConfigFilePath)
+
+	dir := t.TempDir()
+	passphraseFile := filepath.Join(dir, "passphrase")
+	if err := os.WriteFile(passphraseFile, []byte("secret\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	Config = CreateDefaultConfig()
+	Config.Encryption.PassphraseFile = passphraseFile
+	ConfigFilePath = filepath.Join(dir, "config.yaml")
+
+	written := CreateDefaultConfig()
+	written.License = "my-license"
+	if err := WriteConfig(&written); err != nil {
+		t.Fatalf("unexpected error - err: %v", err)
+	}
+	if buf, _ := os.ReadFile(ConfigFilePath); strings.Contains(string(buf), "my-license") {
+		t.Errorf("expected the written license to be encrypted:\n%s", buf)
+	}
+	if written.License != "my-license" {
+		t.Errorf("expected the config to be left as is - license: %s", written.License)
+	}
+
+	merged, _, err := MergeHelmValues([]byte("tap:\n  docker:\n    tag: v52.3\n"), []byte("license: other-license\n"))
+	if err != nil {
+		t.Fatalf("unexpected error - err: %v", err)
+	}
+	if strings.Contains(string(merged), "other-license") || !strings.Contains(string(merged), "license: "+EncryptedPrefix) {
+		t.Errorf("expected the imported license to be encrypted:\n%s", merged)
+	}
+}
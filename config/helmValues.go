@@ -0,0 +1,114 @@
+package config
+
+import (
+	"encoding/json"
+	"reflect"
+	"sort"
+	"strings"
+
+	"github.com/creasty/defaults"
+	"github.com/goccy/go-yaml"
+)
+
+// ConfigFromHelmValues converts a Helm values file into a config. The values
+// are decoded the way the chart receives them from `Helm.Install`, through
+// the json tags, on top of the defaults. Keys that don't map onto the config
+// are returned as unknown and ignored.
+func ConfigFromHelmValues(buf []byte) (config *ConfigStruct, unknown []string, err error) {
+	var values map[string]interface{}
+	if err = yaml.Unmarshal(buf, &values); err != nil {
+		return
+	}
+
+	unknown = findUnknownConfigKeys(values, reflect.TypeOf(ConfigStruct{}), nil)
+
+	converted := CreateDefaultConfig()
+	if err = defaults.Set(&converted); err != nil {
+		return
+	}
+
+	data, err := json.Marshal(values)
+	if err != nil {
+		return
+	}
+
+	if err = json.Unmarshal(data, &converted); err != nil {
+		return
+	}
+
+	setZeroForReadonlyFields(reflect.ValueOf(&converted).Elem())
+	config = &converted
+
+	return
+}
+
+// MergeHelmValues sets the keys of a Helm values file in the contents of a
+// config file, keeping the other keys and the comments as they are. Values
+// are converted the way ConfigFromHelmValues does, secrets are encrypted like
+// `config set` does.
+func MergeHelmValues(buf []byte, valuesBuf []byte) (merged []byte, unknown []string, err error) {
+	converted, unknown, err := ConfigFromHelmValues(valuesBuf)
+	if err != nil {
+		return
+	}
+
+	var values map[string]interface{}
+	if err = yaml.Unmarshal(valuesBuf, &values); err != nil {
+		return
+	}
+
+	doc := newYamlDocument(buf)
+	walkHelmValues(values, reflect.ValueOf(converted).Elem(), nil, func(path []string, value reflect.Value) {
+		if err != nil {
+			return
+		}
+
+		var encoded []byte
+		var fileValue interface{}
+		if fileValue, err = encryptSecretValue(strings.Join(path, "."), value.Interface()); err != nil {
+			return
+		}
+		if encoded, err = yaml.Marshal(fileValue); err != nil {
+			return
+		}
+		err = doc.Set(path, strings.Split(strings.TrimSuffix(string(encoded), "\n"), "\n"))
+	})
+	if err != nil {
+		return
+	}
+
+	merged = doc.Bytes()
+	return
+}
+
+// walkHelmValues visits the config field of every value set in the Helm
+// values, by its config file path. Unknown and read-only keys are skipped.
+func walkHelmValues(node interface{}, currentElem reflect.Value, path []string, visit func(path []string, value reflect.Value)) {
+	mapping, ok := node.(map[string]interface{})
+	if !ok || currentElem.Kind() != reflect.Struct {
+		visit(path, currentElem)
+		return
+	}
+
+	keys := make([]string, 0, len(mapping))
+	for key := range mapping {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		field, ok := getFieldByConfigKey(currentElem.Type(), key)
+		if !ok {
+			continue
+		}
+		if _, ok := field.Tag.Lookup(ReadonlyTag); ok {
+			continue
+		}
+
+		name := getFieldNameByTag(field)
+		if name == "" {
+			name = key
+		}
+		walkHelmValues(mapping[key], currentElem.FieldByName(field.Name), append(append([]string{}, path...), name), visit)
+	}
+}
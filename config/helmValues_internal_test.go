@@ -0,0 +1,81 @@
+package config
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestConfigFromHelmValues(t *testing.T) {
+	buf := []byte(`tap:
+  docker:
+    tag: v52.3
+  namespaces:
+  - default
+  unsupported: true
+`)
+
+	converted, unknown, err := ConfigFromHelmValues(buf)
+	if err != nil {
+		t.Fatalf("unexpected error - err: %v", err)
+	}
+
+	if converted.Tap.Docker.Tag != "v52.3" || !reflect.DeepEqual(converted.Tap.Namespaces, []string{"default"}) {
+		t.Errorf("values weren't converted - tag: %s, namespaces: %v", converted.Tap.Docker.Tag, converted.Tap.Namespaces)
+	}
+
+	if converted.Tap.Docker.Registry == "" {
+		t.Error("expected defaults for keys missing from the values")
+	}
+
+	if !reflect.DeepEqual(unknown, []string{"tap.unsupported"}) {
+		t.Errorf("unexpected unknown keys - expected: [tap.unsupported], actual: %v", unknown)
+	}
+}
+
+func TestMergeHelmValues(t *testing.T) {
+	buf := []byte(`# my cluster
+tap:
+  docker:
+    registry: registry.example.com # mirror
+    tag: v52.1
+license: my-license
+contexts:
+  prod:
+    tap:
+      storageClass: fast
+`)
+	values := []byte(`tap:
+  docker:
+    tag: v52.3
+  namespaces:
+  - default
+  unsupported: true
+`)
+
+	merged, unknown, err := MergeHelmValues(buf, values)
+	if err != nil {
+		t.Fatalf("unexpected error - err: %v", err)
+	}
+
+	expected := `# my cluster
+tap:
+  docker:
+    registry: registry.example.com # mirror
+    tag: v52.3
+  namespaces:
+  - default
+license: my-license
+contexts:
+  prod:
+    tap:
+      storageClass: fast
+`
+	if string(merged) != expected {
+		t.Errorf("unexpected merged config - expected:\n%s\nactual:\n%s", expected, merged)
+	}
+
+	if strings.Join(unknown, ",") != "tap.unsupported" {
+		t.Errorf("unexpected unknown keys - actual: %v", unknown)
+	}
+}
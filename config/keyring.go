@@ -0,0 +1,63 @@
+package config
+
+import (
+	"bytes"
+	"encoding/hex"
+	"fmt"
+	"os/exec"
+	"runtime"
+	"strings"
+
+	"github.com/kubeshark/kubeshark/misc"
+)
+
+const keyringAccount = "config-encryption-key"
+
+// keyringGet reads the config encryption key from the OS keyring, through
+// the keychain on macOS and the Secret Service (secret-tool) on Linux.
+func keyringGet() (key string, found bool, err error) {
+	var cmd *exec.Cmd
+	switch runtime.GOOS {
+	case "darwin":
+		cmd = exec.Command("security", "find-generic-password", "-s", misc.Program, "-a", keyringAccount, "-w")
+	case "linux":
+		cmd = exec.Command("secret-tool", "lookup", "service", misc.Program, "account", keyringAccount)
+	default:
+		return "", false, fmt.Errorf("the OS keyring isn't supported on %s, use encryption.passphraseFile instead", runtime.GOOS)
+	}
+
+	var stdout bytes.Buffer
+	cmd.Stdout = &stdout
+	if err := cmd.Run(); err != nil {
+		if _, ok := err.(*exec.ExitError); ok {
+			return "", false, nil
+		}
+		return "", false, fmt.Errorf("failed accessing the OS keyring, %w", err)
+	}
+
+	key = strings.TrimSpace(stdout.String())
+	return key, key != "", nil
+}
+
+// keyringSet stores the config encryption key in the OS keyring.
+func keyringSet(key string) error {
+	var cmd *exec.Cmd
+	switch runtime.GOOS {
+	case "darwin":
+		// The command is read from stdin to keep the key off the argument
+		// list of the process, hex encoded to spare quoting it.
+		cmd = exec.Command("security", "-i")
+		cmd.Stdin = strings.NewReader(fmt.Sprintf("add-generic-password -U -s %s -a %s -X %s\n", misc.Program, keyringAccount, hex.EncodeToString([]byte(key))))
+	case "linux":
+		cmd = exec.Command("secret-tool", "store", fmt.Sprintf("--label=%s config encryption key", misc.Program), "service", misc.Program, "account", keyringAccount)
+		cmd.Stdin = strings.NewReader(key)
+	default:
+		return fmt.Errorf("the OS keyring isn't supported on %s, use encryption.passphraseFile instead", runtime.GOOS)
+	}
+
+	if output, err := cmd.CombinedOutput(); err != nil {
+		return fmt.Errorf("failed storing the key in the OS keyring, %w: %s", err, strings.TrimSpace(string(output)))
+	}
+
+	return nil
+}
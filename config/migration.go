@@ -0,0 +1,266 @@
+package config
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+
+	"github.com/goccy/go-yaml"
+	"github.com/rs/zerolog/log"
+)
+
+type ConfigIssueKind string
+
+const (
+	ConfigIssueRenamed    ConfigIssueKind = "renamed"
+	ConfigIssueDeprecated ConfigIssueKind = "deprecated"
+	ConfigIssueNotice     ConfigIssueKind = "notice"
+	ConfigIssueUnknown    ConfigIssueKind = "unknown"
+)
+
+// ConfigIssue is a stale or unrecognized key found in the config file.
+type ConfigIssue struct {
+	Kind    ConfigIssueKind
+	Path    string
+	NewPath string
+	Version string
+	Message string
+}
+
+type configRename struct {
+	From string
+	To   string
+}
+
+type configDeprecation struct {
+	Path string
+	Hint string
+}
+
+// configValueNotice flags a key whose value kept its name but changed meaning.
+type configValueNotice struct {
+	Path    string
+	Value   string
+	Message string
+}
+
+// configMigration lists the config keys changed by a CLI release.
+type configMigration struct {
+	Version    string
+	Renamed    []configRename
+	Deprecated []configDeprecation
+	Notices    []configValueNotice
+}
+
+// configMigrations is ordered by release. Renames are applied in order, so a
+// key renamed twice ends up at its latest path. Every entry must match a
+// change documented in the release notes or helm-chart/README.md; leave
+// Version empty when the release can't be told. Renamed and deprecated keys
+// are fixed up in the loaded config only, the file itself is left as is.
+var configMigrations = []configMigration{
+	{
+		// helm-chart/README.md, tap.auth.type: "prior releases routed `oidc`
+		// to Descope"
+		Notices: []configValueNotice{
+			{
+				Path:    "tap.auth.type",
+				Value:   "oidc",
+				Message: "`oidc` now selects generic OIDC instead of Descope; set it to `descope` (or `default`) if you relied on Descope",
+			},
+		},
+	},
+}
+
+// MigrateConfigData applies configMigrations to a config file's contents and
+// reports every stale or unknown key it finds. Comments and ordering of the
+// untouched lines are preserved.
+func MigrateConfigData(buf []byte) ([]byte, []ConfigIssue, error) {
+	var raw map[string]interface{}
+	if err := yaml.Unmarshal(buf, &raw); err != nil {
+		return nil, nil, err
+	}
+
+	doc := newYamlDocument(buf)
+	var issues []ConfigIssue
+
+	for _, migration := range configMigrations {
+		for _, rename := range migration.Renamed {
+			if !doc.Rename(strings.Split(rename.From, "."), strings.Split(rename.To, ".")) {
+				continue
+			}
+			issues = append(issues, ConfigIssue{
+				Kind:    ConfigIssueRenamed,
+				Path:    rename.From,
+				NewPath: rename.To,
+				Version: migration.Version,
+				Message: fmt.Sprintf("renamed to %s", rename.To),
+			})
+		}
+
+		for _, deprecation := range migration.Deprecated {
+			if !doc.Remove(strings.Split(deprecation.Path, ".")) {
+				continue
+			}
+			issues = append(issues, ConfigIssue{
+				Kind:    ConfigIssueDeprecated,
+				Path:    deprecation.Path,
+				Version: migration.Version,
+				Message: fmt.Sprintf("no longer supported, %s", deprecation.Hint),
+			})
+		}
+
+		for _, notice := range migration.Notices {
+			value, ok := lookupConfigKey(raw, strings.Split(notice.Path, "."))
+			if !ok || fmt.Sprint(value) != notice.Value {
+				continue
+			}
+			issues = append(issues, ConfigIssue{
+				Kind:    ConfigIssueNotice,
+				Path:    notice.Path,
+				Version: migration.Version,
+				Message: notice.Message,
+			})
+		}
+	}
+
+	migrated := doc.Bytes()
+	var migratedRaw map[string]interface{}
+	if err := yaml.Unmarshal(migrated, &migratedRaw); err != nil {
+		return nil, nil, fmt.Errorf("migrated config is invalid, %w", err)
+	}
+
+	for _, unknown := range findUnknownConfigKeys(migratedRaw, reflect.TypeOf(ConfigStruct{}), nil) {
+		issues = append(issues, ConfigIssue{
+			Kind:    ConfigIssueUnknown,
+			Path:    unknown,
+			Message: "unknown key, it's ignored",
+		})
+	}
+
+	contexts, _ := migratedRaw[ContextsKey].(map[string]interface{})
+	contextNames := make([]string, 0, len(contexts))
+	for name := range contexts {
+		contextNames = append(contextNames, name)
+	}
+	sort.Strings(contextNames)
+
+	for _, name := range contextNames {
+		for _, unknown := range findUnknownConfigKeys(contexts[name], reflect.TypeOf(ConfigStruct{}), []string{ContextsKey, name}) {
+			issues = append(issues, ConfigIssue{
+				Kind:    ConfigIssueUnknown,
+				Path:    unknown,
+				Message: "unknown key, it's ignored",
+			})
+		}
+	}
+
+	return migrated, issues, nil
+}
+
+func logConfigIssues(issues []ConfigIssue) {
+	for _, issue := range issues {
+		event := log.Warn().Str("key", issue.Path)
+		if issue.NewPath != "" {
+			event = event.Str("new-key", issue.NewPath)
+		}
+		if issue.Version != "" {
+			event = event.Str("since", issue.Version)
+		}
+		event.Msg(fmt.Sprintf("Config file: %s", issue.Message))
+	}
+}
+
+func lookupConfigKey(raw map[string]interface{}, path []string) (interface{}, bool) {
+	var current interface{} = raw
+	for _, key := range path {
+		node, ok := current.(map[string]interface{})
+		if !ok {
+			return nil, false
+		}
+		if current, ok = node[key]; !ok {
+			return nil, false
+		}
+	}
+
+	return current, true
+}
+
+func findUnknownConfigKeys(node interface{}, t reflect.Type, path []string) (unknown []string) {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+
+	switch t.Kind() {
+	case reflect.Struct:
+		mapping, ok := node.(map[string]interface{})
+		if !ok {
+			return
+		}
+
+		keys := make([]string, 0, len(mapping))
+		for key := range mapping {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+
+		for _, key := range keys {
+			keyPath := append(append([]string{}, path...), key)
+			field, ok := getFieldByConfigKey(t, key)
+			if !ok {
+				unknown = append(unknown, strings.Join(keyPath, "."))
+				continue
+			}
+			unknown = append(unknown, findUnknownConfigKeys(mapping[key], field.Type, keyPath)...)
+		}
+	case reflect.Slice:
+		items, ok := node.([]interface{})
+		if !ok {
+			return
+		}
+
+		for i, item := range items {
+			itemPath := append([]string{}, path...)
+			itemPath[len(itemPath)-1] = fmt.Sprintf("%s[%d]", itemPath[len(itemPath)-1], i)
+			unknown = append(unknown, findUnknownConfigKeys(item, t.Elem(), itemPath)...)
+		}
+	}
+
+	return
+}
+
+// getFieldByConfigKey finds the struct field a YAML key decodes into, using
+// the yaml tag and falling back to the json tag like the decoder does.
+func getFieldByConfigKey(t reflect.Type, key string) (reflect.StructField, bool) {
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+
+		name := getFieldNameByTag(field)
+		if name == "" {
+			name = strings.Split(field.Tag.Get("json"), ",")[0]
+		}
+
+		if field.Anonymous && name == "" {
+			embedded := field.Type
+			if embedded.Kind() == reflect.Ptr {
+				embedded = embedded.Elem()
+			}
+			if embedded.Kind() == reflect.Struct {
+				if embeddedField, ok := getFieldByConfigKey(embedded, key); ok {
+					return embeddedField, true
+				}
+			}
+			continue
+		}
+
+		if name == "" {
+			name = strings.ToLower(field.Name)
+		}
+
+		if name == key {
+			return field, true
+		}
+	}
+
+	return reflect.StructField{}, false
+}
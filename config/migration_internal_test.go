@@ -0,0 +1,134 @@
+package config
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestMigrateConfigData(t *testing.T) {
+	defer func(migrations []configMigration) { configMigrations = migrations }(configMigrations)
+	configMigrations = append([]configMigration{
+		{
+			Version: "v1.0",
+			Renamed: []configRename{
+				{From: "tap.selfnamespace", To: "tap.release.namespace"},
+				{From: "tap.proxy.hub.port", To: "tap.proxy.hub.srvPort"},
+			},
+			Deprecated: []configDeprecation{
+				{Path: "tap.stopped", Hint: "use tap.capture.dissection.enabled (inverted) instead"},
+			},
+		},
+	}, configMigrations...)
+
+	buf := []byte(`# my cluster
+tap:
+  selfnamespace: monitoring # where the release lives
+  stopped: false
+  docker:
+    tag: v52.3
+  proxy:
+    hub:
+      port: 8898
+  auth:
+    type: oidc
+  unknownKey: true
+logLevel: debug
+`)
+
+	migrated, issues, err := MigrateConfigData(buf)
+	if err != nil {
+		t.Fatalf("unexpected error - err: %v", err)
+	}
+
+	expected := `# my cluster
+tap:
+  docker:
+    tag: v52.3
+  proxy:
+    hub:
+      srvPort: 8898
+  auth:
+    type: oidc
+  unknownKey: true
+  release:
+    namespace: monitoring
+logLevel: debug
+`
+	if string(migrated) != expected {
+		t.Errorf("unexpected migrated config - expected:\n%s\nactual:\n%s", expected, migrated)
+	}
+
+	kinds := map[string]ConfigIssueKind{}
+	for _, issue := range issues {
+		kinds[issue.Path] = issue.Kind
+	}
+
+	for path, kind := range map[string]ConfigIssueKind{
+		"tap.selfnamespace":  ConfigIssueRenamed,
+		"tap.proxy.hub.port": ConfigIssueRenamed,
+		"tap.stopped":        ConfigIssueDeprecated,
+		"tap.auth.type":      ConfigIssueNotice,
+		"tap.unknownKey":     ConfigIssueUnknown,
+	} {
+		if kinds[path] != kind {
+			t.Errorf("unexpected issue for %s - expected: %s, actual: %s", path, kind, kinds[path])
+		}
+	}
+
+	if len(issues) != 5 {
+		t.Errorf("unexpected number of issues - expected: 5, actual: %d", len(issues))
+	}
+}
+
+func TestMigrateConfigDataUpToDate(t *testing.T) {
+	buf := []byte("tap:\n  release:\n    namespace: monitoring\n")
+
+	migrated, issues, err := MigrateConfigData(buf)
+	if err != nil {
+		t.Fatalf("unexpected error - err: %v", err)
+	}
+
+	if string(migrated) != string(buf) {
+		t.Errorf("unexpected change - actual:\n%s", migrated)
+	}
+
+	if len(issues) != 0 {
+		t.Errorf("unexpected issues - issues: %v", issues)
+	}
+}
+
+func TestYamlDocumentSetPreservesComments(t *testing.T) {
+	doc := newYamlDocument([]byte("tap:\n  # registry comment\n  docker:\n    registry: docker.io # inline\n  namespaces:\n  - a\n"))
+
+	if err := doc.Set([]string{"tap", "docker", "registry"}, []string{"example.com"}); err != nil {
+		t.Fatalf("unexpected error - err: %v", err)
+	}
+	if err := doc.Set([]string{"tap", "namespaces"}, []string{"- b", "- c"}); err != nil {
+		t.Fatalf("unexpected error - err: %v", err)
+	}
+	if err := doc.Set([]string{"tap", "resources", "sniffer", "limits", "memory"}, []string{"4Gi"}); err != nil {
+		t.Fatalf("unexpected error - err: %v", err)
+	}
+
+	expected := strings.Join([]string{
+		"tap:",
+		"  # registry comment",
+		"  docker:",
+		"    registry: example.com # inline",
+		"  namespaces:",
+		"  - b",
+		"  - c",
+		"  resources:",
+		"    sniffer:",
+		"      limits:",
+		"        memory: 4Gi",
+		"",
+	}, "\n")
+	if string(doc.Bytes()) != expected {
+		t.Errorf("unexpected document - expected:\n%s\nactual:\n%s", expected, doc.Bytes())
+	}
+
+	if !doc.Remove([]string{"tap", "resources", "sniffer", "limits", "memory"}) || doc.Has([]string{"tap", "resources"}) {
+		t.Errorf("expected empty parents to be removed - actual:\n%s", doc.Bytes())
+	}
+}
@@ -0,0 +1,202 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"reflect"
+	"strings"
+	"sync"
+
+	"github.com/rs/zerolog/log"
+)
+
+const (
+	SecretTag = "secret"
+
+	SecretRefEnv       = "env:"
+	SecretRefFile      = "file:"
+	SecretRefK8sSecret = "k8s-secret:"
+
+	SecretMask = "********"
+)
+
+// K8sSecretGetter reads a key of a Kubernetes secret. It's set by the command
+// layer, which owns the Kubernetes provider, to resolve `k8s-secret:`
+// references.
+var K8sSecretGetter func(namespace string, name string, key string) (string, error)
+
+var (
+	resolvedSecrets   = map[string]string{}
+	resolvedSecretsMu sync.Mutex
+)
+
+// IsSecretRef reports whether value refers to a secret instead of holding it.
+func IsSecretRef(value string) bool {
+	return strings.HasPrefix(value, SecretRefEnv) ||
+		strings.HasPrefix(value, SecretRefFile) ||
+		strings.HasPrefix(value, SecretRefK8sSecret)
+}
+
+// ResolveSecret returns the value a secret reference points to:
+//
+//	env:VAR                  environment variable VAR
+//	file:/path               contents of the file, without the trailing newline
+//	k8s-secret:ns/name#key   key of the Kubernetes secret name in namespace ns
+//
+// Values that aren't references are returned as is. Resolved values are
+// cached for the lifetime of the process.
+func ResolveSecret(value string) (string, error) {
+	if !IsSecretRef(value) {
+		return value, nil
+	}
+
+	resolvedSecretsMu.Lock()
+	defer resolvedSecretsMu.Unlock()
+
+	if resolved, ok := resolvedSecrets[value]; ok {
+		return resolved, nil
+	}
+
+	var resolved string
+	switch {
+	case strings.HasPrefix(value, SecretRefEnv):
+		name := strings.TrimPrefix(value, SecretRefEnv)
+		var ok bool
+		if resolved, ok = os.LookupEnv(name); !ok {
+			return "", fmt.Errorf("environment variable %s is not set", name)
+		}
+	case strings.HasPrefix(value, SecretRefFile):
+		data, err := os.ReadFile(strings.TrimPrefix(value, SecretRefFile))
+		if err != nil {
+			return "", err
+		}
+		resolved = strings.TrimRight(string(data), "\r\n")
+	case strings.HasPrefix(value, SecretRefK8sSecret):
+		ref := strings.TrimPrefix(value, SecretRefK8sSecret)
+		namespacedName, key, hasKey := strings.Cut(ref, "#")
+		namespace, name, hasName := strings.Cut(namespacedName, "/")
+		if !hasKey || !hasName || namespace == "" || name == "" || key == "" {
+			return "", fmt.Errorf("invalid secret reference %s, expected %sns/name#key", value, SecretRefK8sSecret)
+		}
+		if K8sSecretGetter == nil {
+			return "", fmt.Errorf("can't resolve %s without access to Kubernetes", value)
+		}
+		var err error
+		if resolved, err = K8sSecretGetter(namespace, name, key); err != nil {
+			return "", err
+		}
+	}
+
+	resolvedSecrets[value] = resolved
+	return resolved, nil
+}
+
+// LicenseKey returns the license, resolving it if it's a secret reference.
+// A reference that can't be resolved is logged and yields an empty license.
+func (config *ConfigStruct) LicenseKey() string {
+	license, err := ResolveSecret(config.License)
+	if err != nil {
+		log.Error().Err(err).Msg("Failed resolving the license.")
+		return ""
+	}
+
+	return license
+}
+
+// WithResolvedSecrets returns a copy of the config where every secret field
+// holds the value its reference points to.
+func (config *ConfigStruct) WithResolvedSecrets() (resolved ConfigStruct, err error) {
+	resolved = *config
+
+	var errs []string
+	walkSecretFields(reflect.ValueOf(&resolved).Elem(), nil, func(path []string, field reflect.Value) {
+		value, err := ResolveSecret(field.String())
+		if err != nil {
+			errs = append(errs, fmt.Sprintf("%s: %v", strings.Join(path, "."), err))
+			return
+		}
+		field.SetString(value)
+	})
+
+	if len(errs) > 0 {
+		err = fmt.Errorf("failed resolving secrets, %s", strings.Join(errs, ", "))
+	}
+
+	return
+}
+
+// Masked returns a copy of the config that's safe to print: secret values
+// are masked, secret references are kept as they don't disclose anything.
+func (config *ConfigStruct) Masked() (masked ConfigStruct) {
+	masked = *config
+
+	walkSecretFields(reflect.ValueOf(&masked).Elem(), nil, func(path []string, field reflect.Value) {
+		field.SetString(MaskSecret(field.String()))
+	})
+
+	return
+}
+
+// MaskSecret masks a secret value, keeping empty values and references.
+func MaskSecret(value string) string {
+	if value == "" || IsSecretRef(value) {
+		return value
+	}
+
+	return SecretMask
+}
+
+// SecretPaths returns the dotted paths of the secret fields of the config.
+func SecretPaths() (paths []string) {
+	walkSecretFields(reflect.ValueOf(&ConfigStruct{}).Elem(), nil, func(path []string, field reflect.Value) {
+		paths = append(paths, strings.Join(path, "."))
+	})
+
+	return
+}
+
+// MaskedConfigFile returns the contents of the config file with secret
+// values masked, preserving everything else as written.
+func MaskedConfigFile() ([]byte, error) {
+	buf, err := os.ReadFile(ConfigFilePath)
+	if err != nil {
+		return nil, err
+	}
+
+	doc := newYamlDocument(buf)
+	for _, path := range SecretPaths() {
+		keyPath := strings.Split(path, ".")
+		line, ok := doc.find(keyPath)
+		if !ok {
+			continue
+		}
+
+		value := doc.extract(line)
+		if len(value) == 1 && MaskSecret(strings.Trim(value[0], `"'`)) != SecretMask {
+			continue
+		}
+
+		if err := doc.Set(keyPath, []string{SecretMask}); err != nil {
+			return nil, err
+		}
+	}
+
+	return doc.Bytes(), nil
+}
+
+func walkSecretFields(currentElem reflect.Value, path []string, visit func(path []string, field reflect.Value)) {
+	for i := 0; i < currentElem.NumField(); i++ {
+		currentField := currentElem.Type().Field(i)
+		currentFieldByName := currentElem.FieldByName(currentField.Name)
+		currentPath := append(append([]string{}, path...), getFieldNameByTag(currentField))
+
+		if currentField.Type.Kind() == reflect.Struct {
+			walkSecretFields(currentFieldByName, currentPath, visit)
+			continue
+		}
+
+		if _, ok := currentField.Tag.Lookup(SecretTag); ok && currentField.Type.Kind() == reflect.String {
+			visit(currentPath, currentFieldByName)
+		}
+	}
+}
@@ -0,0 +1,88 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestResolveSecret(t *testing.T) {
+	secretFile := filepath.Join(t.TempDir(), "license")
+	if err := os.WriteFile(secretFile, []byte("from-file\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("KUBESHARK_TEST_LICENSE", "from-env")
+
+	K8sSecretGetter = func(namespace string, name string, key string) (string, error) {
+		return namespace + "/" + name + "/" + key, nil
+	}
+	defer func() { K8sSecretGetter = nil }()
+
+	tests := []struct {
+		Value    string
+		Expected string
+	}{
+		{Value: "plain", Expected: "plain"},
+		{Value: "env:KUBESHARK_TEST_LICENSE", Expected: "from-env"},
+		{Value: "file:" + secretFile, Expected: "from-file"},
+		{Value: "k8s-secret:ns/name#key", Expected: "ns/name/key"},
+	}
+
+	for _, test := range tests {
+		resolved, err := ResolveSecret(test.Value)
+		if err != nil || resolved != test.Expected {
+			t.Errorf("unexpected result for %s - expected: %s, actual: %s, err: %v", test.Value, test.Expected, resolved, err)
+		}
+	}
+
+	for _, value := range []string{"env:KUBESHARK_TEST_UNSET", "k8s-secret:name#key", "file:/does/not/exist"} {
+		if _, err := ResolveSecret(value); err == nil {
+			t.Errorf("expected an error for %s", value)
+		}
+	}
+}
+
+func TestMaskedConfigFile(t *testing.T) {
+	ConfigFilePath = filepath.Join(t.TempDir(), "config.yaml")
+	defer func() { ConfigFilePath = "" }()
+
+	buf := []byte(`license: my-license # keep me
+tap:
+  snapshots:
+    cloud:
+      s3:
+        accessKey: env:AWS_ACCESS_KEY_ID
+        secretKey: "plaintext"
+      gcs:
+        credentialsJson: |
+          {"private_key": "..."}
+`)
+	if err := os.WriteFile(ConfigFilePath, buf, 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	masked, err := MaskedConfigFile()
+	if err != nil {
+		t.Fatalf("unexpected error - err: %v", err)
+	}
+
+	for _, line := range []string{
+		"license: ******** # keep me",
+		"        accessKey: env:AWS_ACCESS_KEY_ID",
+		"        secretKey: ********",
+		"        credentialsJson: ********",
+	} {
+		if !strings.Contains(string(masked), line+"\n") {
+			t.Errorf("expected masked config to contain %q - actual:\n%s", line, masked)
+		}
+	}
+	if strings.Contains(string(masked), "private_key") || strings.Contains(string(masked), "plaintext") {
+		t.Errorf("unexpected secret in masked config - actual:\n%s", masked)
+	}
+
+	config := ConfigStruct{License: "my-license"}
+	if config.Masked().License != SecretMask || config.License != "my-license" {
+		t.Errorf("unexpected masking - masked: %s, original: %s", config.Masked().License, config.License)
+	}
+}
@@ -0,0 +1,368 @@
+package config
+
+import (
+	"fmt"
+	"strings"
+)
+
+const yamlIndent = 2
+
+// yamlDocument is a line-oriented view of a block-style YAML file. It can
+// locate, rename, remove and insert keys without re-encoding the whole file,
+// so comments, ordering and formatting outside the edited lines survive.
+type yamlDocument struct {
+	lines []string
+}
+
+func newYamlDocument(buf []byte) *yamlDocument {
+	text := strings.ReplaceAll(string(buf), "\r\n", "\n")
+	text = strings.TrimSuffix(text, "\n")
+
+	var lines []string
+	if text != "" {
+		lines = strings.Split(text, "\n")
+	}
+
+	return &yamlDocument{lines: lines}
+}
+
+func (d *yamlDocument) Bytes() []byte {
+	if len(d.lines) == 0 {
+		return nil
+	}
+
+	return []byte(strings.Join(d.lines, "\n") + "\n")
+}
+
+// yamlKeyLine is a parsed `key: value` line.
+type yamlKeyLine struct {
+	indent  int
+	key     string
+	prefix  string // everything up to and including the colon
+	value   string // inline value without the trailing comment
+	comment string // trailing comment, including the leading '#'
+}
+
+func parseYamlKeyLine(line string) (keyLine yamlKeyLine, ok bool) {
+	trimmed := strings.TrimLeft(line, " ")
+	keyLine.indent = len(line) - len(trimmed)
+	if trimmed == "" || strings.HasPrefix(trimmed, "#") || strings.HasPrefix(trimmed, "-") {
+		return
+	}
+
+	colon := -1
+	if trimmed[0] == '"' || trimmed[0] == '\'' {
+		closing := strings.IndexByte(trimmed[1:], trimmed[0])
+		if closing < 0 {
+			return
+		}
+		keyLine.key = trimmed[1 : closing+1]
+		rest := trimmed[closing+2:]
+		if !strings.HasPrefix(rest, ":") {
+			return
+		}
+		colon = closing + 2
+	} else {
+		for i := 0; i < len(trimmed); i++ {
+			if trimmed[i] == ':' && (i+1 == len(trimmed) || trimmed[i+1] == ' ') {
+				colon = i
+				break
+			}
+		}
+		if colon <= 0 {
+			return
+		}
+		keyLine.key = strings.TrimSpace(trimmed[:colon])
+	}
+
+	keyLine.prefix = line[:keyLine.indent+colon+1]
+	keyLine.value, keyLine.comment = splitYamlComment(strings.TrimSpace(trimmed[colon+1:]))
+	ok = true
+	return
+}
+
+func splitYamlComment(value string) (string, string) {
+	if strings.HasPrefix(value, "#") {
+		return "", value
+	}
+
+	inQuote := byte(0)
+	for i := 0; i < len(value); i++ {
+		switch {
+		case inQuote != 0:
+			if value[i] == inQuote {
+				inQuote = 0
+			}
+		case value[i] == '"' || value[i] == '\'':
+			inQuote = value[i]
+		case value[i] == '#' && i > 0 && value[i-1] == ' ':
+			return strings.TrimSpace(value[:i]), value[i:]
+		}
+	}
+
+	return value, ""
+}
+
+func isYamlContentLine(line string) bool {
+	trimmed := strings.TrimSpace(line)
+	return trimmed != "" && !strings.HasPrefix(trimmed, "#")
+}
+
+func yamlLineIndent(line string) int {
+	return len(line) - len(strings.TrimLeft(line, " "))
+}
+
+// blockEnd returns the index right after the last line that belongs to the
+// key at line start (its nested mapping, sequence or block scalar).
+func (d *yamlDocument) blockEnd(start int) int {
+	keyLine, _ := parseYamlKeyLine(d.lines[start])
+
+	end := start + 1
+	for i := start + 1; i < len(d.lines); i++ {
+		if !isYamlContentLine(d.lines[i]) {
+			continue
+		}
+
+		indent := yamlLineIndent(d.lines[i])
+		isSequenceItem := strings.HasPrefix(strings.TrimSpace(d.lines[i]), "-")
+		if indent > keyLine.indent || (indent == keyLine.indent && keyLine.value == "" && isSequenceItem) {
+			end = i + 1
+			continue
+		}
+
+		break
+	}
+
+	return end
+}
+
+// findKey returns the line of key among the direct children of the mapping
+// spanning lines [from, to), or -1.
+func (d *yamlDocument) findKey(from int, to int, key string) int {
+	childIndent := -1
+	for i := from; i < to; i++ {
+		if !isYamlContentLine(d.lines[i]) {
+			continue
+		}
+
+		keyLine, ok := parseYamlKeyLine(d.lines[i])
+		if childIndent < 0 {
+			if !ok {
+				// The block is a sequence or a scalar, not a mapping.
+				return -1
+			}
+			childIndent = keyLine.indent
+		}
+
+		if ok && keyLine.indent == childIndent && keyLine.key == key {
+			return i
+		}
+	}
+
+	return -1
+}
+
+// childIndent returns the indentation used by the direct children of the
+// mapping spanning lines [from, to), or fallback if it has none.
+func (d *yamlDocument) childIndent(from int, to int, fallback int) int {
+	for i := from; i < to; i++ {
+		if keyLine, ok := parseYamlKeyLine(d.lines[i]); ok {
+			return keyLine.indent
+		}
+	}
+
+	return fallback
+}
+
+// find returns the line of the key at path.
+func (d *yamlDocument) find(path []string) (int, bool) {
+	from, to, line := 0, len(d.lines), -1
+	for _, key := range path {
+		line = d.findKey(from, to, key)
+		if line < 0 {
+			return -1, false
+		}
+		from, to = line+1, d.blockEnd(line)
+	}
+
+	return line, line >= 0
+}
+
+// Has reports whether the key at path is present in the document.
+func (d *yamlDocument) Has(path []string) bool {
+	_, ok := d.find(path)
+	return ok
+}
+
+// extract returns the value of the key at line as YAML lines, relative to
+// the key's indentation (an inline value is a single line).
+func (d *yamlDocument) extract(line int) []string {
+	keyLine, _ := parseYamlKeyLine(d.lines[line])
+	if keyLine.value != "" {
+		return []string{keyLine.value}
+	}
+
+	block := d.lines[line+1 : d.blockEnd(line)]
+	minIndent := -1
+	for _, blockLine := range block {
+		if isYamlContentLine(blockLine) && (minIndent < 0 || yamlLineIndent(blockLine) < minIndent) {
+			minIndent = yamlLineIndent(blockLine)
+		}
+	}
+
+	var value []string
+	for _, blockLine := range block {
+		strip := min(minIndent, yamlLineIndent(blockLine))
+		value = append(value, blockLine[strip:])
+	}
+
+	return value
+}
+
+// indentValue renders value lines as the value of a key line at indent.
+func indentValue(keyLinePrefix string, comment string, indent int, value []string) []string {
+	withComment := func(line string) string {
+		if comment == "" {
+			return line
+		}
+		return line + " " + comment
+	}
+
+	if len(value) == 1 && !strings.HasPrefix(value[0], "-") {
+		if _, isMapping := parseYamlKeyLine(value[0]); !isMapping {
+			return []string{withComment(keyLinePrefix + " " + value[0])}
+		}
+	}
+
+	childIndent := indent + yamlIndent
+	if len(value) > 0 && strings.HasPrefix(strings.TrimSpace(value[0]), "-") {
+		childIndent = indent
+	}
+
+	lines := []string{withComment(keyLinePrefix)}
+	for _, valueLine := range value {
+		if valueLine == "" {
+			lines = append(lines, "")
+			continue
+		}
+		lines = append(lines, strings.Repeat(" ", childIndent)+valueLine)
+	}
+
+	return lines
+}
+
+func (d *yamlDocument) splice(from int, to int, lines []string) {
+	updated := make([]string, 0, len(d.lines)-(to-from)+len(lines))
+	updated = append(updated, d.lines[:from]...)
+	updated = append(updated, lines...)
+	updated = append(updated, d.lines[to:]...)
+	d.lines = updated
+}
+
+// Set replaces the value of the key at path, creating it and any missing
+// parents if needed. value holds YAML lines as produced by an encoder.
+func (d *yamlDocument) Set(path []string, value []string) error {
+	if len(path) == 0 {
+		return fmt.Errorf("empty key")
+	}
+
+	if line, ok := d.find(path); ok {
+		keyLine, _ := parseYamlKeyLine(d.lines[line])
+		d.splice(line, d.blockEnd(line), indentValue(keyLine.prefix, keyLine.comment, keyLine.indent, value))
+		return nil
+	}
+
+	// Walk down to the deepest existing parent.
+	from, to, indent, depth := 0, len(d.lines), 0, 0
+	for ; depth < len(path)-1; depth++ {
+		line := d.findKey(from, to, path[depth])
+		if line < 0 {
+			break
+		}
+
+		keyLine, _ := parseYamlKeyLine(d.lines[line])
+		switch keyLine.value {
+		case "", "{}", "null", "~":
+			if keyLine.value != "" {
+				d.lines[line] = strings.TrimRight(keyLine.prefix+" "+keyLine.comment, " ")
+			}
+		default:
+			return fmt.Errorf("%s holds a value and cannot have nested keys", strings.Join(path[:depth+1], "."))
+		}
+
+		from, to, indent = line+1, d.blockEnd(line), keyLine.indent+yamlIndent
+	}
+
+	indent = d.childIndent(from, to, indent)
+
+	var lines []string
+	for i, key := range path[depth:] {
+		prefix := strings.Repeat(" ", indent+i*yamlIndent) + key + ":"
+		if depth+i == len(path)-1 {
+			lines = append(lines, indentValue(prefix, "", indent+i*yamlIndent, value)...)
+		} else {
+			lines = append(lines, prefix)
+		}
+	}
+
+	// Insert after the last content line of the parent block, leaving any
+	// trailing comments or blank lines below the new key.
+	insertAt := from
+	for i := from; i < to; i++ {
+		if isYamlContentLine(d.lines[i]) {
+			insertAt = i + 1
+		}
+	}
+	d.splice(insertAt, insertAt, lines)
+
+	return nil
+}
+
+// Remove deletes the key at path together with its nested block. Parents
+// left without children are removed as well, so they don't decode as null.
+func (d *yamlDocument) Remove(path []string) bool {
+	line, ok := d.find(path)
+	if !ok {
+		return false
+	}
+
+	d.splice(line, d.blockEnd(line), nil)
+
+	if len(path) > 1 {
+		parent, _ := d.find(path[:len(path)-1])
+		end := d.blockEnd(parent)
+		hasChildren := false
+		for i := parent + 1; i < end; i++ {
+			hasChildren = hasChildren || isYamlContentLine(d.lines[i])
+		}
+		if !hasChildren {
+			d.Remove(path[:len(path)-1])
+		}
+	}
+
+	return true
+}
+
+// Rename moves the key at from to the path to, keeping its value. If to is
+// already present the old key is dropped and the existing value wins.
+func (d *yamlDocument) Rename(from []string, to []string) bool {
+	line, ok := d.find(from)
+	if !ok {
+		return false
+	}
+
+	if d.Has(to) {
+		return d.Remove(from)
+	}
+
+	if strings.Join(from[:len(from)-1], ".") == strings.Join(to[:len(to)-1], ".") {
+		keyLine, _ := parseYamlKeyLine(d.lines[line])
+		d.lines[line] = strings.Repeat(" ", keyLine.indent) + to[len(to)-1] + ":" + d.lines[line][len(keyLine.prefix):]
+		return true
+	}
+
+	value := d.extract(line)
+	d.Remove(from)
+
+	return d.Set(to, value) == nil
+}
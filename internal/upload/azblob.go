@@ -0,0 +1,55 @@
+package upload
+
+import (
+	"context"
+	"fmt"
+	"os"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/storage/azblob"
+	"github.com/Azure/azure-sdk-for-go/sdk/storage/azblob/blob"
+	"github.com/kubeshark/kubeshark/config/configStructs"
+)
+
+type azblobUploader struct {
+	container string
+	client    *azblob.Client
+}
+
+// newAzblobUploader authenticates with the storage key.
+func newAzblobUploader(config configStructs.SnapshotsCloudAzblobConfig) (*azblobUploader, error) {
+	if config.StorageAccount == "" || config.Container == "" {
+		return nil, fmt.Errorf("tap.snapshots.cloud.azblob.storageAccount and tap.snapshots.cloud.azblob.container must be set")
+	}
+	if config.StorageKey == "" {
+		return nil, fmt.Errorf("tap.snapshots.cloud.azblob.storageKey is not set")
+	}
+
+	credential, err := azblob.NewSharedKeyCredential(config.StorageAccount, config.StorageKey)
+	if err != nil {
+		return nil, fmt.Errorf("invalid Azure storage key: %w", err)
+	}
+
+	client, err := azblob.NewClientWithSharedKeyCredential(fmt.Sprintf("https://%s.blob.core.windows.net/", config.StorageAccount), credential, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	return &azblobUploader{container: config.Container, client: client}, nil
+}
+
+// upload stages the file in blocks, having Azure verify the CRC-64 of every
+// block.
+func (uploader *azblobUploader) upload(ctx context.Context, file *os.File, object *Object, crc uint32) error {
+	checksum := object.SHA256
+	_, err := uploader.client.UploadFile(ctx, uploader.container, object.Key, file, &azblob.UploadFileOptions{
+		BlockSize:               PartSize,
+		Metadata:                map[string]*string{ChecksumMetadata: &checksum},
+		TransactionalValidation: blob.TransferValidationTypeComputeCRC64(),
+	})
+	if err != nil {
+		return err
+	}
+
+	object.URL = fmt.Sprintf("%s%s/%s", uploader.client.URL(), uploader.container, object.Key)
+	return nil
+}
@@ -0,0 +1,173 @@
+package upload
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/kubeshark/kubeshark/config/configStructs"
+	"golang.org/x/oauth2"
+	"golang.org/x/oauth2/google"
+)
+
+const (
+	gcsScope      = "https://www.googleapis.com/auth/devstorage.read_write"
+	gcsEndpoint   = "https://storage.googleapis.com"
+	gcsUploadPath = "/upload/storage/v1/b/%s/o?uploadType=resumable"
+
+	// statusResumeIncomplete is what GCS answers the chunks of a resumable
+	// upload before the last one with
+	statusResumeIncomplete = 308
+)
+
+type gcsUploader struct {
+	bucket   string
+	client   *http.Client
+	endpoint string
+	// chunkSize is the size of the chunks of the resumable upload, a
+	// multiple of 256 KiB
+	chunkSize int
+}
+
+// newGCSUploader authenticates with the service account credentials if set,
+// or else with the application default credentials.
+func newGCSUploader(ctx context.Context, config configStructs.SnapshotsCloudGCSConfig) (*gcsUploader, error) {
+	if config.Bucket == "" {
+		return nil, fmt.Errorf("tap.snapshots.cloud.gcs.bucket is not set")
+	}
+
+	var credentials *google.Credentials
+	var err error
+	if config.CredentialsJson != "" {
+		credentials, err = google.CredentialsFromJSON(ctx, []byte(config.CredentialsJson), gcsScope)
+	} else {
+		credentials, err = google.FindDefaultCredentials(ctx, gcsScope)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed loading the GCS credentials: %w", err)
+	}
+
+	return &gcsUploader{
+		bucket:    config.Bucket,
+		client:    oauth2.NewClient(ctx, credentials.TokenSource),
+		endpoint:  gcsEndpoint,
+		chunkSize: PartSize,
+	}, nil
+}
+
+// upload sends the file in chunks through a resumable upload, resuming every
+// chunk from the bytes GCS acknowledged, and verifies the CRC-32C it computed.
+func (uploader *gcsUploader) upload(ctx context.Context, file *os.File, object *Object, crc uint32) error {
+	metadata, err := json.Marshal(map[string]interface{}{
+		"name":     object.Key,
+		"metadata": map[string]string{ChecksumMetadata: object.SHA256},
+	})
+	if err != nil {
+		return err
+	}
+
+	request, err := http.NewRequestWithContext(ctx, http.MethodPost, uploader.endpoint+fmt.Sprintf(gcsUploadPath, url.PathEscape(uploader.bucket)), bytes.NewReader(metadata))
+	if err != nil {
+		return err
+	}
+	request.Header.Set("Content-Type", "application/json; charset=UTF-8")
+	response, err := uploader.client.Do(request)
+	if err != nil {
+		return err
+	}
+	response.Body.Close()
+	if response.StatusCode != http.StatusOK {
+		return fmt.Errorf("starting the upload failed: %s", response.Status)
+	}
+	session := response.Header.Get("Location")
+
+	var result struct {
+		Crc32c string `json:"crc32c"`
+	}
+	chunk := make([]byte, uploader.chunkSize)
+	for offset := int64(0); ; {
+		n, err := io.ReadFull(file, chunk)
+		if err != nil && err != io.ErrUnexpectedEOF && err != io.EOF {
+			return err
+		}
+
+		request, err := http.NewRequestWithContext(ctx, http.MethodPut, session, bytes.NewReader(chunk[:n]))
+		if err != nil {
+			return err
+		}
+		if n == 0 {
+			request.Header.Set("Content-Range", fmt.Sprintf("bytes */%d", object.Size))
+		} else {
+			request.Header.Set("Content-Range", fmt.Sprintf("bytes %d-%d/%d", offset, offset+int64(n)-1, object.Size))
+		}
+
+		response, err := uploader.client.Do(request)
+		if err != nil {
+			return err
+		}
+
+		if response.StatusCode == statusResumeIncomplete {
+			response.Body.Close()
+			persisted, err := gcsPersistedSize(response.Header.Get("Range"))
+			if err != nil {
+				return err
+			}
+			if persisted <= offset {
+				return fmt.Errorf("uploading made no progress at %d of %d bytes", offset, object.Size)
+			}
+			if offset, err = file.Seek(persisted, io.SeekStart); err != nil {
+				return err
+			}
+			continue
+		}
+		if response.StatusCode != http.StatusOK && response.StatusCode != http.StatusCreated {
+			response.Body.Close()
+			return fmt.Errorf("uploading failed at %d bytes: %s", offset, response.Status)
+		}
+
+		err = json.NewDecoder(response.Body).Decode(&result)
+		response.Body.Close()
+		if err != nil {
+			return fmt.Errorf("unexpected upload response: %w", err)
+		}
+		break
+	}
+
+	expected := make([]byte, 4)
+	binary.BigEndian.PutUint32(expected, crc)
+	if result.Crc32c != base64.StdEncoding.EncodeToString(expected) {
+		return fmt.Errorf("checksum mismatch, the object's CRC-32C is %s", result.Crc32c)
+	}
+
+	object.URL = fmt.Sprintf("%s/%s/%s", uploader.endpoint, uploader.bucket, object.Key)
+	return nil
+}
+
+// gcsPersistedSize returns how many bytes of a resumable upload GCS
+// persisted, from the Range header of its answer, such as "bytes=0-42". No
+// header means none.
+func gcsPersistedSize(header string) (int64, error) {
+	if header == "" {
+		return 0, nil
+	}
+
+	_, end, ok := strings.Cut(strings.TrimPrefix(header, "bytes="), "-")
+	if !ok {
+		return 0, fmt.Errorf("unexpected Range of the upload: %s", header)
+	}
+	last, err := strconv.ParseInt(end, 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("unexpected Range of the upload: %s", header)
+	}
+
+	return last + 1, nil
+}
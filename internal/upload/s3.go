@@ -0,0 +1,94 @@
+package upload
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	awsConfig "github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/credentials"
+	"github.com/aws/aws-sdk-go-v2/credentials/stscreds"
+	"github.com/aws/aws-sdk-go-v2/feature/s3/manager"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"github.com/aws/aws-sdk-go-v2/service/sts"
+	"github.com/kubeshark/kubeshark/config/configStructs"
+)
+
+// s3DefaultRegion is used with custom endpoints if no region is set, as
+// S3-compatible stores usually ignore it
+const s3DefaultRegion = "us-east-1"
+
+type s3Uploader struct {
+	bucket   string
+	uploader *manager.Uploader
+}
+
+// newS3Uploader authenticates with the access key if set, or else through
+// the default AWS credential chain, assuming the role if set. A custom
+// endpoint is addressed path-style, the way S3-compatible stores expect.
+func newS3Uploader(ctx context.Context, config configStructs.SnapshotsCloudS3Config) (*s3Uploader, error) {
+	if config.Bucket == "" {
+		return nil, fmt.Errorf("tap.snapshots.cloud.s3.bucket is not set")
+	}
+
+	region := config.Region
+	if region == "" && config.Endpoint != "" {
+		region = s3DefaultRegion
+	}
+
+	var options []func(*awsConfig.LoadOptions) error
+	if region != "" {
+		options = append(options, awsConfig.WithRegion(region))
+	}
+	if config.AccessKey != "" {
+		options = append(options, awsConfig.WithCredentialsProvider(credentials.NewStaticCredentialsProvider(config.AccessKey, config.SecretKey, "")))
+	}
+
+	awsCfg, err := awsConfig.LoadDefaultConfig(ctx, options...)
+	if err != nil {
+		return nil, fmt.Errorf("failed loading the AWS config: %w", err)
+	}
+
+	if config.RoleArn != "" {
+		provider := stscreds.NewAssumeRoleProvider(sts.NewFromConfig(awsCfg), config.RoleArn, func(options *stscreds.AssumeRoleOptions) {
+			if config.ExternalId != "" {
+				options.ExternalID = aws.String(config.ExternalId)
+			}
+		})
+		awsCfg.Credentials = aws.NewCredentialsCache(provider)
+	}
+
+	client := s3.NewFromConfig(awsCfg, func(options *s3.Options) {
+		if config.Endpoint != "" {
+			options.BaseEndpoint = aws.String(strings.TrimSuffix(config.Endpoint, "/"))
+			options.UsePathStyle = true
+		}
+	})
+
+	return &s3Uploader{
+		bucket: config.Bucket,
+		uploader: manager.NewUploader(client, func(uploader *manager.Uploader) {
+			uploader.PartSize = PartSize
+		}),
+	}, nil
+}
+
+// upload has S3 verify the CRC-32C of every part.
+func (uploader *s3Uploader) upload(ctx context.Context, file *os.File, object *Object, crc uint32) error {
+	output, err := uploader.uploader.Upload(ctx, &s3.PutObjectInput{
+		Bucket:            aws.String(uploader.bucket),
+		Key:               aws.String(object.Key),
+		Body:              file,
+		ChecksumAlgorithm: types.ChecksumAlgorithmCrc32c,
+		Metadata:          map[string]string{ChecksumMetadata: object.SHA256},
+	})
+	if err != nil {
+		return err
+	}
+
+	object.URL = output.Location
+	return nil
+}
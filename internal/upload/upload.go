@@ -0,0 +1,117 @@
+package upload
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/kubeshark/kubeshark/config/configStructs"
+	"github.com/rs/zerolog/log"
+)
+
+const (
+	ProviderS3     = "s3"
+	ProviderAzblob = "azblob"
+	ProviderGCS    = "gcs"
+
+	// PartSize is the size of the parts of multipart uploads
+	PartSize = 16 * 1024 * 1024
+
+	// ChecksumMetadata is the object metadata holding the SHA-256 of the file
+	ChecksumMetadata = "sha256"
+)
+
+// Object is a file uploaded to the bucket.
+type Object struct {
+	Key    string
+	URL    string
+	Size   int64
+	SHA256 string
+}
+
+// Uploader pushes files to the object storage the hub keeps its snapshots in.
+type Uploader interface {
+	// upload uploads the file to the key of the object, tagged with its
+	// SHA-256, and verifies the CRC-32C if the provider reports it
+	upload(ctx context.Context, file *os.File, object *Object, crc uint32) error
+}
+
+// NewUploader creates the uploader of the cloud provider of the snapshots
+// config. Secrets must be resolved already.
+func NewUploader(ctx context.Context, cloud configStructs.SnapshotsCloudConfig) (Uploader, error) {
+	switch cloud.Provider {
+	case ProviderS3:
+		return newS3Uploader(ctx, cloud.S3)
+	case ProviderAzblob:
+		return newAzblobUploader(cloud.Azblob)
+	case ProviderGCS:
+		return newGCSUploader(ctx, cloud.GCS)
+	case "":
+		return nil, fmt.Errorf("no cloud storage is configured, set tap.snapshots.cloud.provider to %s, %s or %s", ProviderS3, ProviderAzblob, ProviderGCS)
+	default:
+		return nil, fmt.Errorf("unknown cloud storage provider %s, expected %s, %s or %s", cloud.Provider, ProviderS3, ProviderAzblob, ProviderGCS)
+	}
+}
+
+// Key is where a file is uploaded to under the prefix.
+func Key(prefix string, file string) string {
+	return strings.TrimPrefix(path.Join(prefix, filepath.Base(file)), "/")
+}
+
+// File uploads the file to the key, after computing its checksums which the
+// upload is verified against.
+func File(ctx context.Context, uploader Uploader, key string, file string) (*Object, error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	sha := sha256.New()
+	crc := crc32.New(crc32.MakeTable(crc32.Castagnoli))
+	size, err := io.Copy(io.MultiWriter(sha, crc), f)
+	if err != nil {
+		return nil, fmt.Errorf("failed reading %s: %w", file, err)
+	}
+	if _, err := f.Seek(0, io.SeekStart); err != nil {
+		return nil, err
+	}
+
+	object := &Object{
+		Key:    key,
+		Size:   size,
+		SHA256: hex.EncodeToString(sha.Sum(nil)),
+	}
+	if err := uploader.upload(ctx, f, object, crc.Sum32()); err != nil {
+		return nil, fmt.Errorf("failed uploading %s: %w", file, err)
+	}
+
+	return object, nil
+}
+
+// Files uploads the files under the prefix, logging the URL of every
+// object. It stops at the first failure.
+func Files(ctx context.Context, cloud configStructs.SnapshotsCloudConfig, files []string) error {
+	uploader, err := NewUploader(ctx, cloud)
+	if err != nil {
+		return err
+	}
+
+	for _, file := range files {
+		log.Info().Str("file", file).Str("provider", cloud.Provider).Msg("Uploading...")
+		object, err := File(ctx, uploader, Key(cloud.Prefix, file), file)
+		if err != nil {
+			return err
+		}
+		log.Info().Str("url", object.URL).Str("sha256", object.SHA256).Int64("size", object.Size).Msg("Uploaded.")
+	}
+
+	return nil
+}
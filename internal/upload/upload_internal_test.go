@@ -0,0 +1,174 @@
+package upload
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/kubeshark/kubeshark/config/configStructs"
+)
+
+func writeTestFile(t *testing.T, content string) string {
+	t.Helper()
+
+	path := filepath.Join(t.TempDir(), "capture.pcap")
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestS3EndpointUpload(t *testing.T) {
+	t.Setenv("AWS_CONFIG_FILE", filepath.Join(t.TempDir(), "config"))
+	t.Setenv("AWS_SHARED_CREDENTIALS_FILE", filepath.Join(t.TempDir(), "credentials"))
+	t.Setenv("AWS_EC2_METADATA_DISABLED", "true")
+
+	var mutex sync.Mutex
+	var paths []string
+	var checksum string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mutex.Lock()
+		defer mutex.Unlock()
+
+		io.Copy(io.Discard, r.Body)
+		if r.Method != http.MethodPut {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+		paths = append(paths, r.URL.Path)
+		checksum = r.Header.Get("X-Amz-Meta-" + ChecksumMetadata)
+		w.Header().Set("ETag", `"etag"`)
+	}))
+	defer server.Close()
+
+	uploader, err := newS3Uploader(context.Background(), configStructs.SnapshotsCloudS3Config{
+		Bucket:    "snapshots",
+		AccessKey: "access",
+		SecretKey: "secret",
+		Endpoint:  server.URL + "/",
+	})
+	if err != nil {
+		t.Fatalf("unexpected error - err: %v", err)
+	}
+
+	path := writeTestFile(t, "pcap data")
+	object, err := File(context.Background(), uploader, Key("dumps", path), path)
+	if err != nil {
+		t.Fatalf("unexpected error - err: %v", err)
+	}
+
+	// Path-style, the bucket is in the path rather than in the host
+	if len(paths) != 1 || paths[0] != "/snapshots/dumps/capture.pcap" {
+		t.Errorf("unexpected requests - paths: %v", paths)
+	}
+	if checksum != object.SHA256 {
+		t.Errorf("unexpected checksum metadata - expected: %s, actual: %s", object.SHA256, checksum)
+	}
+	if object.URL != server.URL+"/snapshots/dumps/capture.pcap" {
+		t.Errorf("unexpected URL - actual: %s", object.URL)
+	}
+}
+
+// gcsTestServer persists at most persistPerChunk bytes of every chunk but
+// the last, acknowledging them in the Range header like GCS does.
+type gcsTestServer struct {
+	persistPerChunk int
+	stored          []byte
+	chunks          int
+}
+
+func (server *gcsTestServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method == http.MethodPost {
+		w.Header().Set("Location", "http://"+r.Host+"/session")
+		return
+	}
+
+	body, _ := io.ReadAll(r.Body)
+	contentRange := strings.TrimPrefix(r.Header.Get("Content-Range"), "bytes ")
+	span, totalStr, _ := strings.Cut(contentRange, "/")
+	total, _ := strconv.Atoi(totalStr)
+
+	if span != "*" {
+		server.chunks++
+		startStr, endStr, _ := strings.Cut(span, "-")
+		start, _ := strconv.Atoi(startStr)
+		end, _ := strconv.Atoi(endStr)
+		if start != len(server.stored) || end-start+1 != len(body) {
+			http.Error(w, fmt.Sprintf("unexpected range %s with %d stored", contentRange, len(server.stored)), http.StatusBadRequest)
+			return
+		}
+		if end+1 < total && len(body) > server.persistPerChunk {
+			body = body[:server.persistPerChunk]
+		}
+		server.stored = append(server.stored, body...)
+	}
+
+	if len(server.stored) < total {
+		if len(server.stored) > 0 {
+			w.Header().Set("Range", fmt.Sprintf("bytes=0-%d", len(server.stored)-1))
+		}
+		w.WriteHeader(statusResumeIncomplete)
+		return
+	}
+
+	crc := make([]byte, 4)
+	binary.BigEndian.PutUint32(crc, crc32.Checksum(server.stored, crc32.MakeTable(crc32.Castagnoli)))
+	json.NewEncoder(w).Encode(map[string]string{"crc32c": base64.StdEncoding.EncodeToString(crc)})
+}
+
+func TestGCSResumableUpload(t *testing.T) {
+	content := "0123456789abcdefghij"
+	gcs := &gcsTestServer{persistPerChunk: 3}
+	server := httptest.NewServer(gcs)
+	defer server.Close()
+
+	uploader := &gcsUploader{bucket: "snapshots", client: server.Client(), endpoint: server.URL, chunkSize: 8}
+	path := writeTestFile(t, content)
+	object, err := File(context.Background(), uploader, Key("", path), path)
+	if err != nil {
+		t.Fatalf("unexpected error - err: %v", err)
+	}
+
+	if string(gcs.stored) != content {
+		t.Errorf("unexpected object - expected: %s, actual: %s", content, gcs.stored)
+	}
+	if gcs.chunks < 4 {
+		t.Errorf("expected the chunks to be resumed from the acknowledged range - chunks: %d", gcs.chunks)
+	}
+	if object.URL != server.URL+"/snapshots/capture.pcap" {
+		t.Errorf("unexpected URL - actual: %s", object.URL)
+	}
+}
+
+func TestGCSPersistedSize(t *testing.T) {
+	tests := []struct {
+		header   string
+		expected int64
+	}{
+		{"", 0},
+		{"bytes=0-0", 1},
+		{"bytes=0-262143", 262144},
+	}
+
+	for _, test := range tests {
+		if actual, err := gcsPersistedSize(test.header); err != nil || actual != test.expected {
+			t.Errorf("unexpected persisted size of %q - expected: %d, actual: %d, err: %v", test.header, test.expected, actual, err)
+		}
+	}
+
+	if _, err := gcsPersistedSize("bytes=garbage"); err == nil {
+		t.Error("expected an error for an invalid Range")
+	}
+}
@@ -30,9 +30,9 @@ const (
 	CONFIG_SCRIPTING_SCRIPTS          = "SCRIPTING_SCRIPTS"
 	CONFIG_SCRIPTING_ACTIVE_SCRIPTS   = "SCRIPTING_ACTIVE_SCRIPTS"
 	CONFIG_PCAP_DUMP_ENABLE           = "PCAP_DUMP_ENABLE"
-	CONFIG_TIME_INTERVAL              = "TIME_INTERVAL"
-	CONFIG_MAX_TIME                   = "MAX_TIME"
-	CONFIG_MAX_SIZE                   = "MAX_SIZE"
+	CONFIG_TIME_INTERVAL              = "PCAP_TIME_INTERVAL"
+	CONFIG_MAX_TIME                   = "PCAP_MAX_TIME"
+	CONFIG_MAX_SIZE                   = "PCAP_MAX_SIZE"
 )
 
 func SetSecret(provider *Provider, key string, value string) (updated bool, err error) {
@@ -50,7 +50,7 @@ func SetSecret(provider *Provider, key string, value string) (updated bool, err
 	_, err = provider.clientSet.CoreV1().Secrets(config.Config.Tap.Release.Namespace).Update(context.TODO(), secret, metav1.UpdateOptions{})
 	if err == nil {
 		if updated {
-			log.Info().Str("secret", key).Str("value", value).Msg("Updated:")
+			log.Info().Str("secret", key).Str("value", config.MaskSecret(value)).Msg("Updated:")
 		}
 	} else {
 		log.Error().Str("secret", key).Err(err).Send()
@@ -69,6 +69,17 @@ func GetConfig(provider *Provider, key string) (value string, err error) {
 	return
 }
 
+func GetConfigMap(provider *Provider) (data map[string]string, err error) {
+	var configMap *v1.ConfigMap
+	configMap, err = provider.clientSet.CoreV1().ConfigMaps(config.Config.Tap.Release.Namespace).Get(context.TODO(), SELF_RESOURCES_PREFIX+SUFFIX_CONFIG_MAP, metav1.GetOptions{})
+	if err != nil {
+		return
+	}
+
+	data = configMap.Data
+	return
+}
+
 func SetConfig(provider *Provider, key string, value string) (updated bool, err error) {
 	var configMap *v1.ConfigMap
 	configMap, err = provider.clientSet.CoreV1().ConfigMaps(config.Config.Tap.Release.Namespace).Get(context.TODO(), SELF_RESOURCES_PREFIX+SUFFIX_CONFIG_MAP, metav1.GetOptions{})
@@ -1,7 +1,6 @@
 package helm
 
 import (
-	"encoding/json"
 	"fmt"
 	"os"
 	"path/filepath"
@@ -10,6 +9,7 @@ import (
 
 	"github.com/kubeshark/kubeshark/config"
 	"github.com/kubeshark/kubeshark/misc"
+	"github.com/kubeshark/kubeshark/utils"
 	"github.com/pkg/errors"
 	"github.com/rs/zerolog/log"
 	"helm.sh/helm/v3/pkg/action"
@@ -54,12 +54,21 @@ func parseOCIRef(chartRef string) (string, string, error) {
 	return chartRef, tag, nil
 }
 
-func (h *Helm) Install() (rel *release.Release, err error) {
+func (h *Helm) newActionConfig() (*action.Configuration, error) {
 	kubeConfigPath := config.Config.KubeConfigPath()
 	actionConfig := new(action.Configuration)
-	if err = actionConfig.Init(kube.GetConfig(kubeConfigPath, "", h.releaseNamespace), h.releaseNamespace, os.Getenv(ENV_HELM_DRIVER), func(format string, v ...interface{}) {
+	if err := actionConfig.Init(kube.GetConfig(kubeConfigPath, "", h.releaseNamespace), h.releaseNamespace, os.Getenv(ENV_HELM_DRIVER), func(format string, v ...interface{}) {
 		log.Info().Msgf(format, v...)
 	}); err != nil {
+		return nil, err
+	}
+
+	return actionConfig, nil
+}
+
+func (h *Helm) Install() (rel *release.Release, err error) {
+	var actionConfig *action.Configuration
+	if actionConfig, err = h.newActionConfig(); err != nil {
 		return
 	}
 
@@ -149,19 +158,19 @@ func (h *Helm) Install() (rel *release.Release, err error) {
 		Str("kube-version", chart.Metadata.KubeVersion).
 		Msg("Installing using Helm:")
 
-	var configMarshalled []byte
-	configMarshalled, err = json.Marshal(config.Config)
+	var resolvedConfig config.ConfigStruct
+	resolvedConfig, err = config.Config.WithResolvedSecrets()
 	if err != nil {
 		return
 	}
 
-	var configUnmarshalled map[string]interface{}
-	err = json.Unmarshal(configMarshalled, &configUnmarshalled)
+	var values map[string]interface{}
+	values, err = utils.ToValues(resolvedConfig)
 	if err != nil {
 		return
 	}
 
-	rel, err = client.Run(chart, configUnmarshalled)
+	rel, err = client.Run(chart, values)
 	if err != nil {
 		return
 	}
@@ -170,11 +179,8 @@ func (h *Helm) Install() (rel *release.Release, err error) {
 }
 
 func (h *Helm) Uninstall() (resp *release.UninstallReleaseResponse, err error) {
-	kubeConfigPath := config.Config.KubeConfigPath()
-	actionConfig := new(action.Configuration)
-	if err = actionConfig.Init(kube.GetConfig(kubeConfigPath, "", h.releaseNamespace), h.releaseNamespace, os.Getenv(ENV_HELM_DRIVER), func(format string, v ...interface{}) {
-		log.Info().Msgf(format, v...)
-	}); err != nil {
+	var actionConfig *action.Configuration
+	if actionConfig, err = h.newActionConfig(); err != nil {
 		return
 	}
 
@@ -187,3 +193,18 @@ func (h *Helm) Uninstall() (resp *release.UninstallReleaseResponse, err error) {
 
 	return
 }
+
+// GetValues returns the computed values of the deployed release, i.e. the
+// chart defaults merged with the values it was installed with.
+func (h *Helm) GetValues() (values map[string]interface{}, err error) {
+	var actionConfig *action.Configuration
+	if actionConfig, err = h.newActionConfig(); err != nil {
+		return
+	}
+
+	client := action.NewGetValues(actionConfig)
+	client.AllValues = true
+
+	values, err = client.Run(h.releaseName)
+	return
+}
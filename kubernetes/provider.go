@@ -58,6 +58,15 @@ func NewProvider(kubeConfigPath string, contextName string) (*Provider, error) {
 			"you can set alternative kube config file path by adding the kube-config-path field to the %s config file, err:  %w", kubeConfigPath, misc.Program, err)
 	}
 
+	if rawConfig, err := kubernetesConfig.RawConfig(); err == nil {
+		if contextName == "" {
+			contextName = rawConfig.CurrentContext
+		}
+		if err := config.ApplyContextOverrides(contextName); err != nil {
+			return nil, err
+		}
+	}
+
 	log.Debug().
 		Str("host", restClientConfig.Host).
 		Str("api-path", restClientConfig.APIPath).
@@ -130,6 +139,29 @@ func (provider *Provider) ListAllRunningPodsMatchingRegex(ctx context.Context, r
 	return matchingPods, nil
 }
 
+func (provider *Provider) ListAllServices(ctx context.Context, namespaces []string) ([]core.Service, error) {
+	var services []core.Service
+	for _, namespace := range namespaces {
+		namespaceServices, err := provider.clientSet.CoreV1().Services(namespace).List(ctx, metav1.ListOptions{})
+		if err != nil {
+			return nil, fmt.Errorf("failed to get services in ns: [%s], %w", namespace, err)
+		}
+
+		services = append(services, namespaceServices.Items...)
+	}
+
+	return services, nil
+}
+
+func (provider *Provider) ListNodes(ctx context.Context) ([]core.Node, error) {
+	nodes, err := provider.clientSet.CoreV1().Nodes().List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return nil, err
+	}
+
+	return nodes.Items, nil
+}
+
 func (provider *Provider) ListPodsByAppLabel(ctx context.Context, namespaces string, labels map[string]string) ([]core.Pod, error) {
 	pods, err := provider.clientSet.CoreV1().Pods(namespaces).List(ctx, metav1.ListOptions{
 		LabelSelector: metav1.FormatLabelSelector(
@@ -247,10 +279,28 @@ func (provider *Provider) GetNamespaces() (namespaces []string) {
 	return
 }
 
+func (provider *Provider) GetSecretValue(ctx context.Context, namespace string, name string, key string) (string, error) {
+	secret, err := provider.clientSet.CoreV1().Secrets(namespace).Get(ctx, name, metav1.GetOptions{})
+	if err != nil {
+		return "", fmt.Errorf("failed to get secret %s/%s, %w", namespace, name, err)
+	}
+
+	value, ok := secret.Data[key]
+	if !ok {
+		return "", fmt.Errorf("key %s not found in secret %s/%s", key, namespace, name)
+	}
+
+	return string(value), nil
+}
+
 func (provider *Provider) GetClientSet() *kubernetes.Clientset {
 	return provider.clientSet
 }
 
+func (provider *Provider) GetRestConfig() *rest.Config {
+	return &provider.clientConfig
+}
+
 func getClientSet(config *rest.Config) (*kubernetes.Clientset, error) {
 	clientSet, err := kubernetes.NewForConfig(config)
 	if err != nil {
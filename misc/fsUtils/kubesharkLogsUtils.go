@@ -5,6 +5,7 @@ import (
 	"context"
 	"fmt"
 	"os"
+	"path/filepath"
 	"regexp"
 
 	"github.com/kubeshark/kubeshark/config"
@@ -73,7 +74,9 @@ func DumpLogs(ctx context.Context, provider *kubernetes.Provider, filePath strin
 		log.Debug().Str("namespace", config.Config.Tap.Release.Namespace).Msg("Successfully added events.")
 	}
 
-	if err := AddFileToZip(zipWriter, config.ConfigFilePath); err != nil {
+	if maskedConfig, err := config.MaskedConfigFile(); err != nil {
+		log.Error().Err(err).Msg("Failed reading config file!")
+	} else if err := AddStrToZip(zipWriter, string(maskedConfig), filepath.Base(config.ConfigFilePath)); err != nil {
 		log.Error().Err(err).Msg("Failed write file!")
 	} else {
 		log.Debug().Str("file-path", config.ConfigFilePath).Msg("Successfully added file.")
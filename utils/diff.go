@@ -0,0 +1,102 @@
+package utils
+
+import (
+	"fmt"
+	"strings"
+)
+
+const diffContextLines = 3
+
+// LineDiff returns a unified diff of the lines of a and b, or an empty string
+// if they're identical.
+func LineDiff(fromName string, toName string, a string, b string) string {
+	aLines := splitDiffLines(a)
+	bLines := splitDiffLines(b)
+
+	// Longest common subsequence table, filled from the end.
+	lcs := make([][]int, len(aLines)+1)
+	for i := range lcs {
+		lcs[i] = make([]int, len(bLines)+1)
+	}
+	for i := len(aLines) - 1; i >= 0; i-- {
+		for j := len(bLines) - 1; j >= 0; j-- {
+			if aLines[i] == bLines[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else {
+				lcs[i][j] = max(lcs[i+1][j], lcs[i][j+1])
+			}
+		}
+	}
+
+	type diffLine struct {
+		op   byte
+		text string
+		a, b int
+	}
+
+	var lines []diffLine
+	i, j := 0, 0
+	for i < len(aLines) || j < len(bLines) {
+		switch {
+		case i < len(aLines) && j < len(bLines) && aLines[i] == bLines[j]:
+			lines = append(lines, diffLine{' ', aLines[i], i, j})
+			i++
+			j++
+		case j < len(bLines) && (i == len(aLines) || lcs[i][j+1] >= lcs[i+1][j]):
+			lines = append(lines, diffLine{'+', bLines[j], i, j})
+			j++
+		default:
+			lines = append(lines, diffLine{'-', aLines[i], i, j})
+			i++
+		}
+	}
+
+	var out strings.Builder
+	for start := 0; start < len(lines); {
+		if lines[start].op == ' ' {
+			start++
+			continue
+		}
+
+		// Grow the hunk while changes are closer than twice the context.
+		from := max(0, start-diffContextLines)
+		end := start
+		for k := start; k < len(lines) && k-end <= 2*diffContextLines; k++ {
+			if lines[k].op != ' ' {
+				end = k
+			}
+		}
+		to := min(len(lines), end+diffContextLines+1)
+
+		if out.Len() == 0 {
+			out.WriteString(fmt.Sprintf("--- %s\n+++ %s\n", fromName, toName))
+		}
+
+		aCount, bCount := 0, 0
+		for _, line := range lines[from:to] {
+			if line.op != '+' {
+				aCount++
+			}
+			if line.op != '-' {
+				bCount++
+			}
+		}
+		out.WriteString(fmt.Sprintf("@@ -%d,%d +%d,%d @@\n", lines[from].a+1, aCount, lines[from].b+1, bCount))
+		for _, line := range lines[from:to] {
+			out.WriteString(fmt.Sprintf("%c%s\n", line.op, line.text))
+		}
+
+		start = to
+	}
+
+	return out.String()
+}
+
+func splitDiffLines(text string) []string {
+	text = strings.TrimSuffix(text, "\n")
+	if text == "" {
+		return nil
+	}
+
+	return strings.Split(text, "\n")
+}
@@ -1,6 +1,7 @@
 package utils
 
 import (
+	"encoding/json"
 	"strconv"
 	"strings"
 
@@ -15,3 +16,14 @@ func UnescapeUnicodeCharacters(raw string) string {
 	}
 	return str
 }
+
+// ToValues converts v to Helm values through its JSON representation.
+func ToValues(v interface{}) (values map[string]interface{}, err error) {
+	var marshalled []byte
+	if marshalled, err = json.Marshal(v); err != nil {
+		return
+	}
+
+	err = json.Unmarshal(marshalled, &values)
+	return
+}